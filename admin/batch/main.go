@@ -0,0 +1,461 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"gotable"
+	"importers/onesite"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kardianos/osext"
+)
+
+// App is the global application structure used for batch importer
+var App struct {
+	Manifest    string // manifest file which lists the imports
+	OneSite     string // onesite importer executable
+	RoomKey     string // roomkey importer executable
+	Concurrency int    // how many businesses are imported at once
+	TestMode    int    // used for test purpose?
+	NoAuth      bool   // if true then skip authentication
+}
+
+// Import holds one entry of manifest, all the options
+// for importing source files of a property
+type Import struct {
+	Type           string // onesite or roomkey
+	CSV            string // source report
+	GuestInfo      string // roomkey guest export, optional
+	BUD            string // business unit designation
+	PropertyMap    string // onesite all subproperties csv, BUD comes from it
+	Frequency      string // rent cycle
+	Proration      string // proration cycle
+	GSRPC          string // GSRPC
+	Country        string // default country of contacts
+	CreateBusiness bool   // create business if BUD doesn't exist
+	Reload         bool   // onesite business is loaded again rather than changed
+	DBUser         string // database user name (-B), default from manifest
+	DBName         string // rentroll database (-M), default from manifest
+	DirectoryDB    string // directory database (-N), default from manifest
+}
+
+// Manifest holds the imports to run in batch
+type Manifest struct {
+	Concurrency int    // overridden by command line if passed
+	ReportDir   string // where detailed reports are written
+	DBUser      string // database options of imports which don't set them,
+	DBName      string // importers' defaults are taken if blank
+	DirectoryDB string
+	Imports     []Import
+}
+
+// ImportResult holds the status of an import after it has been run
+type ImportResult struct {
+	Import   Import
+	Status   string // imported, issues or failed
+	Report   string // detailed report file
+	Duration time.Duration
+	Message  string // reason of failure
+}
+
+// import status
+const (
+	statusImported = "imported"
+	statusIssues   = "issues"
+	statusFailed   = "failed"
+)
+
+// notImportedText is printed by importers when csv has issues
+const notImportedText = "did not import properly"
+
+func readCommandLineArgs() []string {
+	inputErrors := []string{}
+
+	// a manifest file must be passed
+	manifest := flag.String("manifest", "", "json file which lists the imports")
+
+	// importers are built next to batch importer in admin folder
+	oneSite := flag.String("onesite", "", "path of onesite importer (default ../onesite/onesite)")
+	roomKey := flag.String("roomkey", "", "path of roomkey importer (default ../roomkey/roomkey)")
+
+	// how many businesses are imported at once
+	concurrency := flag.Int("j", 0, "number of businesses imported at once (default from manifest, else 2)")
+
+	// is it for testing purpose
+	testmode := flag.Int("testmode", 0, "testing")
+	noauth := flag.Bool("noauth", false, "if specified, inhibit authentication")
+
+	// parse the values from command line
+	flag.Parse()
+
+	if *manifest == "" {
+		inputErrors = append(inputErrors, "Please, pass manifest file")
+	}
+	if len(inputErrors) > 0 {
+		return inputErrors
+	}
+
+	App.Manifest = *manifest
+	App.OneSite = *oneSite
+	App.RoomKey = *roomKey
+	App.Concurrency = *concurrency
+	App.TestMode = *testmode
+	App.NoAuth = *noauth
+
+	return inputErrors
+}
+
+// readManifest loads manifest, paths of files in it are
+// taken relative to the folder of manifest
+func readManifest(manifestPath string) (Manifest, []string) {
+	var manifest Manifest
+	manifestErrors := []string{}
+
+	data, err := ioutil.ReadFile(manifestPath)
+	if err != nil {
+		return manifest, append(manifestErrors, err.Error())
+	}
+	if err = json.Unmarshal(data, &manifest); err != nil {
+		return manifest, append(manifestErrors, err.Error())
+	}
+
+	manifestDir, _ := filepath.Abs(filepath.Dir(manifestPath))
+	resolve := func(p string) string {
+		if p == "" || filepath.IsAbs(p) {
+			return p
+		}
+		return filepath.Join(manifestDir, p)
+	}
+
+	if manifest.ReportDir == "" {
+		manifest.ReportDir = "reports"
+	}
+	manifest.ReportDir = resolve(manifest.ReportDir)
+
+	// every import deletes data of its business first,
+	// so a BUD can be imported only once in a batch
+	seenBUD := map[string]int{}
+	checkBUD := func(i int, bud string) {
+		if j, ok := seenBUD[bud]; ok {
+			manifestErrors = append(manifestErrors, fmt.Sprintf("Import %d: BUD %s is already imported by Import %d", i+1, bud, j+1))
+			return
+		}
+		seenBUD[bud] = i
+	}
+
+	for i := range manifest.Imports {
+		imp := &manifest.Imports[i]
+		entry := fmt.Sprintf("Import %d", i+1)
+
+		imp.Type = strings.ToLower(strings.TrimSpace(imp.Type))
+		imp.CSV = resolve(imp.CSV)
+		imp.GuestInfo = resolve(imp.GuestInfo)
+		imp.PropertyMap = resolve(imp.PropertyMap)
+		if imp.DBUser == "" {
+			imp.DBUser = manifest.DBUser
+		}
+		if imp.DBName == "" {
+			imp.DBName = manifest.DBName
+		}
+		if imp.DirectoryDB == "" {
+			imp.DirectoryDB = manifest.DirectoryDB
+		}
+
+		switch imp.Type {
+		case "onesite":
+			if imp.GuestInfo != "" {
+				manifestErrors = append(manifestErrors, entry+": GuestInfo is only for roomkey")
+			}
+		case "roomkey":
+			if imp.PropertyMap != "" {
+				manifestErrors = append(manifestErrors, entry+": PropertyMap is only for onesite")
+			}
+			if imp.Reload {
+				manifestErrors = append(manifestErrors, entry+": Reload is only for onesite")
+			}
+		default:
+			manifestErrors = append(manifestErrors, entry+": Type must be onesite or roomkey")
+		}
+
+		if imp.CSV == "" {
+			manifestErrors = append(manifestErrors, entry+": CSV is missing")
+		}
+		if imp.BUD == "" && imp.PropertyMap == "" {
+			manifestErrors = append(manifestErrors, entry+": BUD is missing")
+		}
+		if imp.BUD != "" {
+			checkBUD(i, imp.BUD)
+		}
+
+		// BUDs of property map, a business can have many properties
+		if imp.Type == "onesite" && imp.PropertyMap != "" {
+			propertyMap, err := onesite.GetPropertyMap(imp.PropertyMap)
+			if err != nil {
+				manifestErrors = append(manifestErrors, entry+": "+err.Error())
+				continue
+			}
+			mapBUDs := map[string]bool{imp.BUD: true}
+			for _, rule := range propertyMap.Properties {
+				if !mapBUDs[rule.BUD] {
+					mapBUDs[rule.BUD] = true
+					checkBUD(i, rule.BUD)
+				}
+			}
+		}
+	}
+
+	return manifest, manifestErrors
+}
+
+// getImporterArgs returns command line of importer for the entry
+func getImporterArgs(imp Import) []string {
+	args := []string{"-csv", imp.CSV}
+
+	if imp.BUD != "" {
+		args = append(args, "-bud", imp.BUD)
+	}
+	if imp.GuestInfo != "" {
+		args = append(args, "-guestinfo", imp.GuestInfo)
+	}
+	if imp.PropertyMap != "" {
+		args = append(args, "-propertymap", imp.PropertyMap)
+	}
+	if imp.Frequency != "" {
+		args = append(args, "-frequency", imp.Frequency)
+	}
+	if imp.Proration != "" {
+		args = append(args, "-proration", imp.Proration)
+	}
+	if imp.GSRPC != "" {
+		args = append(args, "-gsrpc", imp.GSRPC)
+	}
+	if imp.Country != "" {
+		args = append(args, "-country", imp.Country)
+	}
+	if imp.CreateBusiness {
+		args = append(args, "-create-business")
+	}
+	if imp.Reload {
+		args = append(args, "-reload")
+	}
+	if imp.DBUser != "" {
+		args = append(args, "-B", imp.DBUser)
+	}
+	if imp.DBName != "" {
+		args = append(args, "-M", imp.DBName)
+	}
+	if imp.DirectoryDB != "" {
+		args = append(args, "-N", imp.DirectoryDB)
+	}
+	if App.NoAuth {
+		args = append(args, "-noauth")
+	}
+	if App.TestMode != 0 {
+		args = append(args, "-testmode", strconv.Itoa(App.TestMode))
+	}
+	return args
+}
+
+// getReportName returns file name of detailed report of the entry
+func getReportName(index int, imp Import) string {
+	name := imp.BUD
+	if name == "" {
+		name = strings.TrimSuffix(filepath.Base(imp.PropertyMap), filepath.Ext(imp.PropertyMap))
+	}
+	return fmt.Sprintf("%02d_%s_%s.txt", index+1, imp.Type, name)
+}
+
+// runImport runs importer of the entry and writes its output in detailed report
+func runImport(index int, imp Import, reportDir string) ImportResult {
+	result := ImportResult{
+		Import: imp,
+		Report: filepath.Join(reportDir, getReportName(index, imp)),
+	}
+	start := time.Now()
+
+	importer := App.OneSite
+	if imp.Type == "roomkey" {
+		importer = App.RoomKey
+	}
+
+	cmd := exec.Command(importer, getImporterArgs(imp)...)
+	// importers look for their config and json files next to them
+	cmd.Dir = filepath.Dir(importer)
+	output, err := cmd.CombinedOutput()
+	result.Duration = time.Since(start)
+
+	if werr := ioutil.WriteFile(result.Report, output, 0644); werr != nil {
+		result.Status, result.Message = statusFailed, werr.Error()
+		return result
+	}
+
+	switch {
+	case err != nil:
+		result.Status, result.Message = statusFailed, err.Error()
+		// last line of output tells the reason
+		lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+		if last := strings.TrimSpace(lines[len(lines)-1]); last != "" {
+			result.Message = last
+		}
+	case strings.Contains(string(output), notImportedText):
+		result.Status = statusIssues
+	default:
+		result.Status = statusImported
+	}
+	return result
+}
+
+// runImports runs imports with at most concurrency of them at once,
+// results are in the order of manifest
+func runImports(manifest Manifest, concurrency int) []ImportResult {
+	results := make([]ImportResult, len(manifest.Imports))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+
+	for i, imp := range manifest.Imports {
+		wg.Add(1)
+		go func(i int, imp Import) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			results[i] = runImport(i, imp, manifest.ReportDir)
+			fmt.Printf("[%d/%d] %s: %s\n", i+1, len(manifest.Imports), filepath.Base(results[i].Report), results[i].Status)
+		}(i, imp)
+	}
+
+	wg.Wait()
+	return results
+}
+
+// getSummaryReport returns consolidated summary of all imports
+// with status of each property and path of its detailed report
+func getSummaryReport(results []ImportResult, started time.Time) string {
+	counts := map[string]int{}
+
+	var tbl gotable.Table
+	tbl.Init()
+	tbl.SetTitle("Accord RentRoll Batch Importer\n")
+
+	section1 := "Date: " + started.Format("1/2/2006") + "\n"
+	section1 += "Time: " + started.Format(time.Kitchen) + "\n"
+	section1 += "Manifest: " + App.Manifest + "\n"
+	tbl.SetSection1(section1)
+	tbl.SetSection2("Summary")
+
+	tbl.AddColumn("#", 3, gotable.CELLINT, gotable.COLJUSTIFYLEFT)
+	tbl.AddColumn("Type", 8, gotable.CELLSTRING, gotable.COLJUSTIFYLEFT)
+	tbl.AddColumn("BUD", 10, gotable.CELLSTRING, gotable.COLJUSTIFYLEFT)
+	tbl.AddColumn("Status", 8, gotable.CELLSTRING, gotable.COLJUSTIFYLEFT)
+	tbl.AddColumn("Duration", 9, gotable.CELLSTRING, gotable.COLJUSTIFYLEFT)
+	tbl.AddColumn("Source", 40, gotable.CELLSTRING, gotable.COLJUSTIFYLEFT)
+	tbl.AddColumn("Report", 40, gotable.CELLSTRING, gotable.COLJUSTIFYLEFT)
+	tbl.AddColumn("Error", 40, gotable.CELLSTRING, gotable.COLJUSTIFYLEFT)
+
+	for i, r := range results {
+		bud := r.Import.BUD
+		if bud == "" {
+			// BUDs come from property map
+			bud = filepath.Base(r.Import.PropertyMap)
+		}
+
+		tbl.AddRow()
+		tbl.Puti(-1, 0, int64(i+1))
+		tbl.Puts(-1, 1, r.Import.Type)
+		tbl.Puts(-1, 2, bud)
+		tbl.Puts(-1, 3, r.Status)
+		tbl.Puts(-1, 4, (r.Duration - r.Duration%time.Second).String())
+		tbl.Puts(-1, 5, r.Import.CSV)
+		tbl.Puts(-1, 6, r.Report)
+		tbl.Puts(-1, 7, r.Message)
+
+		counts[r.Status]++
+	}
+
+	tbl.SetSection3(fmt.Sprintf("Imported: %d, With issues: %d, Failed: %d, Total: %d\n",
+		counts[statusImported], counts[statusIssues], counts[statusFailed], len(results)))
+
+	s, err := tbl.SprintTable()
+	if err != nil {
+		fmt.Printf("getSummaryReport: error = %s\n", err.Error())
+	}
+	return s
+}
+
+func main() {
+
+	// ================================
+	// COMMAND LINE OPTIONS VALIDATION
+	// ================================
+	inputErrors := readCommandLineArgs()
+	if len(inputErrors) > 0 {
+		for _, errText := range inputErrors {
+			fmt.Println(errText)
+		}
+		os.Exit(1)
+	}
+
+	manifest, manifestErrors := readManifest(App.Manifest)
+	if len(manifestErrors) > 0 {
+		for _, errText := range manifestErrors {
+			fmt.Println(errText)
+		}
+		os.Exit(1)
+	}
+
+	// importers are next to batch importer by default
+	folderPath, err := osext.ExecutableFolder()
+	if err != nil {
+		fmt.Printf("Unable to find folder of batch importer: %s\n", err.Error())
+		os.Exit(1)
+	}
+	if App.OneSite == "" {
+		App.OneSite = path.Join(folderPath, "..", "onesite", "onesite")
+	}
+	if App.RoomKey == "" {
+		App.RoomKey = path.Join(folderPath, "..", "roomkey", "roomkey")
+	}
+	App.OneSite, _ = filepath.Abs(App.OneSite)
+	App.RoomKey, _ = filepath.Abs(App.RoomKey)
+
+	concurrency := App.Concurrency
+	if concurrency <= 0 {
+		concurrency = manifest.Concurrency
+	}
+	if concurrency <= 0 {
+		concurrency = 2
+	}
+
+	if err = os.MkdirAll(manifest.ReportDir, 0700); err != nil {
+		fmt.Printf("Unable to create report folder: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	// ===========
+	// RUN IMPORTS
+	// ===========
+	started := time.Now()
+	results := runImports(manifest, concurrency)
+
+	summary := getSummaryReport(results, started)
+	summaryPath := filepath.Join(manifest.ReportDir, "summary.txt")
+	if err = ioutil.WriteFile(summaryPath, []byte(summary), 0644); err != nil {
+		fmt.Printf("Unable to write summary report: %s\n", err.Error())
+	}
+	fmt.Printf("\n%s", summary)
+
+	for _, r := range results {
+		if r.Status == statusFailed {
+			os.Exit(1)
+		}
+	}
+}
@@ -13,6 +13,8 @@ import (
 	"path"
 	"phonebook/lib"
 	"rentroll/rlib"
+	"strings"
+	"time"
 
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/kardianos/osext"
@@ -20,16 +22,23 @@ import (
 
 // App is the global application structure used for onesite csv importer
 var App struct {
-	dbdir    *sql.DB  // phonebook db
-	dbrr     *sql.DB  // rentroll db
-	DBDir    string   // phonebook database
-	DBRR     string   // rentroll database
-	DBUser   string   // user for all databases
-	LogFile  *os.File // where to log messages
-	TestMode int      // used for test purpose?
-	CSV      string   // csv filename that needs to be load
-	debug    int      // debug records
-	NoAuth   bool     // if true then skip authentication
+	dbdir        *sql.DB  // phonebook db
+	dbrr         *sql.DB  // rentroll db
+	DBDir        string   // phonebook database
+	DBRR         string   // rentroll database
+	DBUser       string   // user for all databases
+	LogFile      *os.File // where to log messages
+	TestMode     int      // used for test purpose?
+	CSV          string   // csv filename that needs to be load
+	debug        int      // debug records
+	NoAuth       bool     // if true then skip authentication
+	PropMap      string   // json file which maps properties of csv to BUD
+	CreateBiz    bool     // create business if it doesn't exist
+	UndoImportID string   // import to undo instead of importing
+	Diff         bool     // compare csv with business instead of importing
+	Reload       bool     // delete and load business again instead of applying changes
+	HTMLReport   string   // html file where import report is written
+	AnnotatedCSV string   // copy of csv with import status of rows
 }
 
 // userRRValues holds the values passed by user for rentroll attributes
@@ -77,6 +86,24 @@ func readCommandLineArgs() []string {
 	// gsrpc should default to daily
 	gsrpc := flag.String("gsrpc", "", "GSRPC")
 
+	// property map to import all subproperties csv in multiple businesses
+	propMap := flag.String("propertymap", "", "json file which maps properties of all subproperties csv to BUD")
+
+	// create business from report if BUD doesn't exist
+	createBiz := flag.Bool("create-business", false, "create the business from report header if BUD does not exist")
+
+	// business imported before gets changes only unless it is reloaded
+	reload := flag.Bool("reload", false, "delete and load business again rather than applying changes since last import")
+
+	// html report of import, it can be sent to the property as it is
+	htmlReport := flag.String("html", "", "write import report in this html file as well")
+
+	// copy of csv with status and issues of each row, rows are fixed in it
+	annotatedCSV := flag.String("annotate", "", "write copy of csv with import status and issues of rows in this file")
+
+	// country of contacts which have none, used to format phone numbers
+	country := flag.String("country", core.DefaultCountry, "Default country of contacts")
+
 	// is it for testing purpose
 	testmode := flag.Int("testmode", 0, "testing")
 
@@ -96,11 +123,19 @@ func readCommandLineArgs() []string {
 	// parse the values from command line
 	flag.Parse()
 
+	// undo needs only import id
+	if App.UndoImportID != "" {
+		App.NoAuth = *noauth
+		return inputErrors
+	}
+
 	if *fp == "" {
 		inputErrors = append(inputErrors, "Please, pass onesite csv input file")
 	}
 
-	if *bud == "" {
+	// BUD of each property comes from property map, diff is
+	// made with one business only
+	if *bud == "" && (*propMap == "" || App.Diff) {
 		inputErrors = append(inputErrors, "Please, pass business unit designation")
 	}
 
@@ -118,18 +153,49 @@ func readCommandLineArgs() []string {
 	App.CSV = *fp
 	App.debug = *debug
 	App.NoAuth = *noauth
+	App.PropMap = *propMap
+	App.CreateBiz = *createBiz
+	App.Reload = *reload
+	App.HTMLReport = *htmlReport
+	App.AnnotatedCSV = *annotatedCSV
 
 	// get user values
 	userRRValues["RentCycle"] = *frequency
 	userRRValues["Proration"] = *proration
 	userRRValues["GSRPC"] = *gsrpc
 	userRRValues["BUD"] = *bud
+	userRRValues["DefaultCountry"] = *country
 
 	return inputErrors
 }
 
 func main() {
 
+	// ================================
+	// SUBCOMMANDS
+	// ================================
+	// history lists past imports or shows one of them
+	if len(os.Args) > 1 && os.Args[1] == "history" {
+		os.Exit(core.RunHistoryCommand(os.Args[2:]))
+	}
+
+	// undo removes records of an import, it is run once database is open
+	if len(os.Args) > 1 && os.Args[1] == "undo" {
+		if len(os.Args) < 3 || strings.HasPrefix(os.Args[2], "-") {
+			fmt.Println("Please, pass import id to undo")
+			os.Exit(1)
+		}
+		App.UndoImportID = os.Args[2]
+		// rest of the options are parsed as usual
+		os.Args = append(os.Args[:1], os.Args[3:]...)
+	}
+
+	// diff reports changes of csv from business, nothing is imported
+	if len(os.Args) > 1 && os.Args[1] == "diff" {
+		App.Diff = true
+		os.Args = append(os.Args[:1], os.Args[2:]...)
+	}
+
 	// ================================
 	// COMMAND LINE OPTIONS VALIDATION
 	// ================================
@@ -217,6 +283,19 @@ func main() {
 	// create background context
 	ctx := context.Background()
 
+	// ===========================
+	// UNDO IMPORT, NOTHING TO LOAD
+	// ===========================
+	if App.UndoImportID != "" {
+		report, err := core.UndoImport(ctx, App.UndoImportID)
+		fmt.Println(report)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+
 	// ==================================
 	// AFTER DB SETUP DO VALIDATION OVER
 	// USER SUPPLIED VALUES WITH DB VALUES
@@ -225,13 +304,51 @@ func main() {
 	// merge user supplied values with default one
 	MergeSuppliedAndDefaultValues()
 
+	// ===============================
+	// DIFF WITH BUSINESS, NO IMPORT
+	// ===============================
+	if App.Diff {
+		if !diffCSV(ctx, App.CSV) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	// ===========================================
+	// ALL SUBPROPERTIES CSV, IMPORT EACH PROPERTY
+	// ===========================================
+	if App.PropMap != "" {
+		if !importAllProperties(ctx) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if onesite.IsAllSubpropertiesCSV(App.CSV) {
+		fmt.Printf("Onesite CSV contains all subproperties, all of them are imported in business %s. Pass -propertymap to import each property in its own business.\n\n", userRRValues["BUD"])
+	}
+
+	if !importCSV(ctx, App.CSV, onesite.GetBusinessName(App.CSV)) {
+		os.Exit(1)
+	}
+}
+
+// importCSV imports onesite csv in business of BUD in userRRValues
+// and prints the report, it returns false if csv could not be imported.
+// businessName is used if business has to be created.
+func importCSV(ctx context.Context, csvPath string, businessName string) bool {
+
+	if !createBusiness(ctx, businessName) {
+		return false
+	}
+
 	// now validation on user supplied values
 	validateErrs, business := core.ValidateUserSuppliedValues(ctx, userRRValues)
 	if len(validateErrs) > 0 {
 		for _, err := range validateErrs {
 			fmt.Println(err.Error())
 		}
-		os.Exit(1)
+		return false
 	}
 
 	// =======================
@@ -241,10 +358,13 @@ func main() {
 	// call onesite loader
 	report, internalErr, done := onesite.CSVHandler(
 		ctx,
-		App.CSV,
+		csvPath,
 		App.TestMode,
 		userRRValues,
 		business,
+		App.Reload,
+		getReportPath(App.HTMLReport),
+		getReportPath(App.AnnotatedCSV),
 		App.debug,
 	)
 
@@ -252,7 +372,7 @@ func main() {
 		var oneSiteErrText string
 		oneSiteErrText = core.ErrInternal.Error()
 		fmt.Println(oneSiteErrText)
-		os.Exit(1)
+		return false
 	}
 
 	if !done {
@@ -262,4 +382,93 @@ func main() {
 		// SUCCESS THEN REPORT IT
 		fmt.Println(report)
 	}
+	return true
+}
+
+// getReportPath returns report file of business of BUD in userRRValues,
+// each business of property map gets its own file
+func getReportPath(filePath string) string {
+	if filePath == "" || App.PropMap == "" {
+		return filePath
+	}
+	ext := path.Ext(filePath)
+	return strings.TrimSuffix(filePath, ext) + "_" + userRRValues["BUD"] + ext
+}
+
+// importAllProperties splits all subproperties csv by property and
+// imports each part in business mapped in property map independently,
+// it returns false if any of them could not be imported
+func importAllProperties(ctx context.Context) bool {
+	propertyMap, err := onesite.GetPropertyMap(App.PropMap)
+	if err != nil {
+		fmt.Printf("Unable to read property map %s: %s\n", App.PropMap, err.Error())
+		return false
+	}
+
+	timestamp := time.Now().Format(time.RFC3339Nano)
+	propertyCSVs, warnings, err := onesite.SplitCSVByProperty(App.CSV, propertyMap, timestamp)
+	for _, warning := range warnings {
+		fmt.Println("Warning: " + warning)
+	}
+	if err != nil {
+		fmt.Println(err.Error())
+		return false
+	}
+	if len(warnings) > 0 {
+		fmt.Println()
+	}
+
+	allDone := true
+	for _, propertyCSV := range propertyCSVs {
+		fmt.Printf("==================== BUSINESS %s ====================\n", propertyCSV.BUD)
+		fmt.Printf("Properties: %s (%d rows)\n\n", strings.Join(propertyCSV.Properties, ", "), propertyCSV.RowCount)
+
+		// other user values are same for every business
+		userRRValues["BUD"] = propertyCSV.BUD
+
+		// business gets name of property given in property map
+		if !importCSV(ctx, propertyCSV.CSVPath, propertyCSV.Name) {
+			allDone = false
+		}
+
+		// testmode is not enabled then only remove splitted csv
+		if App.TestMode != 1 {
+			os.Remove(propertyCSV.CSVPath)
+		}
+	}
+	return allDone
+}
+
+// diffCSV prints changes of onesite csv from the current state of
+// business of BUD in userRRValues, nothing is written to the database
+func diffCSV(ctx context.Context, csvPath string) bool {
+	validateErrs, business := core.ValidateUserSuppliedValues(ctx, userRRValues)
+	if len(validateErrs) > 0 {
+		for _, err := range validateErrs {
+			fmt.Println(err.Error())
+		}
+		return false
+	}
+
+	report, done := onesite.DiffHandler(ctx, csvPath, business)
+	fmt.Println(report)
+	return done
+}
+
+// createBusiness creates business of BUD in userRRValues with name
+// if it doesn't exist yet and user has asked for it
+func createBusiness(ctx context.Context, name string) bool {
+	if !App.CreateBiz {
+		return true
+	}
+
+	created, err := core.CreateBusinessIfNotExists(ctx, userRRValues, name)
+	if err != nil {
+		fmt.Printf("Unable to create business %s: %s\n", userRRValues["BUD"], err.Error())
+		return false
+	}
+	if created {
+		fmt.Printf("Business %s (%s) has been created\n\n", userRRValues["BUD"], name)
+	}
+	return true
 }
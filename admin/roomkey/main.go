@@ -13,6 +13,7 @@ import (
 	"path"
 	"phonebook/lib"
 	"rentroll/rlib"
+	"strings"
 
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/kardianos/osext"
@@ -31,6 +32,11 @@ var App struct {
 	GuestInfoCSV string   // csv filename containing guest info
 	debug        int      // debug records
 	NoAuth       bool     // noauth flag
+	CreateBiz    bool     // create business if it doesn't exist
+	UndoImportID string   // import to undo instead of importing
+	Diff         bool     // compare csv with business instead of importing
+	HTMLReport   string   // html file where import report is written
+	AnnotatedCSV string   // copy of csv with import status of rows
 }
 
 // userRRValues holds the values passed by user for rentroll attributes
@@ -81,6 +87,18 @@ func readCommandLineArgs() []string {
 	// gsrpc should default to daily
 	gsrpc := flag.String("gsrpc", "", "GSRPC")
 
+	// create business from report if BUD doesn't exist
+	createBiz := flag.Bool("create-business", false, "create the business from report header if BUD does not exist")
+
+	// html report of import, it can be sent to the property as it is
+	htmlReport := flag.String("html", "", "write import report in this html file as well")
+
+	// copy of csv with status and issues of each row, rows are fixed in it
+	annotatedCSV := flag.String("annotate", "", "write copy of csv with import status and issues of rows in this file")
+
+	// country of contacts which have none, used to format phone numbers
+	country := flag.String("country", core.DefaultCountry, "Default country of contacts")
+
 	// is it for testing purpose
 	testmode := flag.Int("testmode", 0, "testing")
 
@@ -100,6 +118,12 @@ func readCommandLineArgs() []string {
 	// parse the values from command line
 	flag.Parse()
 
+	// undo needs only import id
+	if App.UndoImportID != "" {
+		App.NoAuth = *noauth
+		return inputErrors
+	}
+
 	if *fp == "" {
 		inputErrors = append(inputErrors, "Please, pass roomkey csv input file")
 	}
@@ -123,18 +147,47 @@ func readCommandLineArgs() []string {
 	App.GuestInfoCSV = *guestInfoFp
 	App.debug = *debug
 	App.NoAuth = *noauth
+	App.CreateBiz = *createBiz
+	App.HTMLReport = *htmlReport
+	App.AnnotatedCSV = *annotatedCSV
 
 	// get user values
 	userRRValues["RentCycle"] = *frequency
 	userRRValues["Proration"] = *proration
 	userRRValues["GSRPC"] = *gsrpc
 	userRRValues["BUD"] = *bud
+	userRRValues["DefaultCountry"] = *country
 
 	return inputErrors
 }
 
 func main() {
 
+	// ================================
+	// SUBCOMMANDS
+	// ================================
+	// history lists past imports or shows one of them
+	if len(os.Args) > 1 && os.Args[1] == "history" {
+		os.Exit(core.RunHistoryCommand(os.Args[2:]))
+	}
+
+	// undo removes records of an import, it is run once database is open
+	if len(os.Args) > 1 && os.Args[1] == "undo" {
+		if len(os.Args) < 3 || strings.HasPrefix(os.Args[2], "-") {
+			fmt.Println("Please, pass import id to undo")
+			os.Exit(1)
+		}
+		App.UndoImportID = os.Args[2]
+		// rest of the options are parsed as usual
+		os.Args = append(os.Args[:1], os.Args[3:]...)
+	}
+
+	// diff reports changes of csv from business, nothing is imported
+	if len(os.Args) > 1 && os.Args[1] == "diff" {
+		App.Diff = true
+		os.Args = append(os.Args[:1], os.Args[2:]...)
+	}
+
 	// ================================
 	// COMMAND LINE OPTIONS VALIDATION
 	// ================================
@@ -222,6 +275,19 @@ func main() {
 	// create background context
 	ctx := context.Background()
 
+	// ===========================
+	// UNDO IMPORT, NOTHING TO LOAD
+	// ===========================
+	if App.UndoImportID != "" {
+		report, err := core.UndoImport(ctx, App.UndoImportID)
+		fmt.Println(report)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+
 	// ==================================
 	// AFTER DB SETUP DO VALIDATION OVER
 	// USER SUPPLIED VALUES WITH DB VALUES
@@ -230,6 +296,12 @@ func main() {
 	// merge user supplied values with default one
 	MergeSuppliedAndDefaultValues()
 
+	// create business from report header if asked, diff
+	// compares with existing business only
+	if !App.Diff && !createBusiness(ctx, roomkey.GetBusinessName(App.CSV)) {
+		os.Exit(1)
+	}
+
 	// now validation on user supplied values
 	validateErrs, business := core.ValidateUserSuppliedValues(ctx, userRRValues)
 	if len(validateErrs) > 0 {
@@ -239,6 +311,18 @@ func main() {
 		os.Exit(1)
 	}
 
+	// ===============================
+	// DIFF WITH BUSINESS, NO IMPORT
+	// ===============================
+	if App.Diff {
+		report, done := roomkey.DiffHandler(ctx, App.CSV, App.GuestInfoCSV, business)
+		fmt.Println(report)
+		if !done {
+			os.Exit(1)
+		}
+		return
+	}
+
 	// =======================
 	// CALL ONSITE CSV HANDLER
 	// =======================
@@ -251,6 +335,8 @@ func main() {
 		App.TestMode,
 		userRRValues,
 		business,
+		App.HTMLReport,
+		App.AnnotatedCSV,
 		App.debug,
 	)
 
@@ -269,3 +355,21 @@ func main() {
 		fmt.Println(report)
 	}
 }
+
+// createBusiness creates business of BUD in userRRValues with name
+// if it doesn't exist yet and user has asked for it
+func createBusiness(ctx context.Context, name string) bool {
+	if !App.CreateBiz {
+		return true
+	}
+
+	created, err := core.CreateBusinessIfNotExists(ctx, userRRValues, name)
+	if err != nil {
+		fmt.Printf("Unable to create business %s: %s\n", userRRValues["BUD"], err.Error())
+		return false
+	}
+	if created {
+		fmt.Printf("Business %s (%s) has been created\n\n", userRRValues["BUD"], name)
+	}
+	return true
+}
@@ -0,0 +1,122 @@
+package core
+
+import (
+	"encoding/csv"
+	"os"
+	"rentroll/rlib"
+	"strings"
+)
+
+// import status of rows in annotated csv
+const (
+	RowStatusImported = "Imported"
+	RowStatusWarning  = "Imported with warnings"
+	RowStatusError    = "Not imported"
+	RowStatusSkipped  = "Skipped"
+	RowStatusMerged   = "Merged"
+)
+
+// annotated columns appended to source csv
+var annotatedHeaders = []string{"Import Status", "Issues"}
+
+// RowNote tells why row, or a part of it, has not been imported as it is
+type RowNote struct {
+	Status string // skipped or merged
+	Reason string
+}
+
+// getRowStatus returns import status and issues of line, errors come first
+// then warnings and notes of the row
+func getRowStatus(reasons []string, notes []RowNote) (string, string) {
+	status := RowStatusImported
+	issues := []string{}
+
+	for _, severity := range []string{"error", "warning"} {
+		for _, reason := range reasons {
+			issue := parseIssue(reason)
+			if issue.Severity != severity {
+				continue
+			}
+			text := strings.Title(severity) + ": " + issue.Message
+			if StringInSlice(text, issues) {
+				continue
+			}
+			issues = append(issues, text)
+
+			if severity == "error" {
+				status = RowStatusError
+			} else if status == RowStatusImported {
+				status = RowStatusWarning
+			}
+		}
+	}
+
+	for _, note := range notes {
+		issues = append(issues, note.Status+": "+note.Reason)
+		// skipped row is not imported, merged row is
+		if status == RowStatusImported || (status == RowStatusMerged && note.Status == RowStatusSkipped) {
+			status = note.Status
+		}
+	}
+	return status, strings.Join(issues, "; ")
+}
+
+// WriteAnnotatedCSV writes copy of source csv with import status and issues
+// of each data line appended, so that rows can be fixed in the source and
+// imported again. Header lines get names of the columns, other lines
+// are left blank unless they have issues.
+func WriteAnnotatedCSV(
+	filePath string,
+	sourceFile string,
+	headerLines []int,
+	dataLines []int,
+	csvErrors map[int][]string,
+	rowNotes map[int][]RowNote,
+) error {
+	t := rlib.LoadCSV(sourceFile)
+
+	// columns are appended after the widest row so that they line up
+	width := 0
+	for _, row := range t {
+		if len(row) > width {
+			width = len(row)
+		}
+	}
+
+	isHeader, isData := map[int]bool{}, map[int]bool{}
+	for _, line := range headerLines {
+		isHeader[line] = true
+	}
+	for _, line := range dataLines {
+		isData[line] = true
+	}
+
+	f, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	for i, row := range t {
+		line := i + 1
+		annotated := make([]string, width, width+len(annotatedHeaders))
+		copy(annotated, row)
+
+		switch {
+		case isHeader[line]:
+			annotated = append(annotated, annotatedHeaders...)
+		case isData[line] || len(csvErrors[line]) > 0 || len(rowNotes[line]) > 0:
+			status, issues := getRowStatus(csvErrors[line], rowNotes[line])
+			annotated = append(annotated, status, issues)
+		default:
+			annotated = append(annotated, "", "")
+		}
+
+		if err = w.Write(annotated); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
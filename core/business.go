@@ -0,0 +1,63 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"rentroll/rlib"
+	"strconv"
+	"strings"
+)
+
+// GetReportTitle returns the first text found at the top of source report,
+// which is the name of property in reports exported by onesite and roomkey
+func GetReportTitle(t [][]string) string {
+	for _, row := range t {
+		for _, cell := range row {
+			if text := strings.TrimSpace(cell); text != "" {
+				return text
+			}
+		}
+	}
+	return ""
+}
+
+// CreateBusinessIfNotExists creates the business of BUD in userValues with name and
+// default cycles supplied by user if it doesn't exist yet, it returns true if business
+// has been created. Business is not created for invalid cycles, error names the cycle.
+func CreateBusinessIfNotExists(ctx context.Context, userValues map[string]string, name string) (bool, error) {
+	BUD := userValues["BUD"]
+	business, err := rlib.GetBusinessByDesignation(ctx, BUD)
+	if err == nil && business.BID > 0 {
+		return false, nil
+	}
+
+	RentCycle, err := strconv.ParseInt(userValues["RentCycle"], 10, 64)
+	if err != nil {
+		return false, fmt.Errorf("Invalid rent cycle %q", userValues["RentCycle"])
+	}
+	Proration, err := strconv.ParseInt(userValues["Proration"], 10, 64)
+	if err != nil {
+		return false, fmt.Errorf("Invalid proration cycle %q", userValues["Proration"])
+	}
+	GSRPC, err := strconv.ParseInt(userValues["GSRPC"], 10, 64)
+	if err != nil {
+		return false, fmt.Errorf("Invalid GSRPC %q", userValues["GSRPC"])
+	}
+
+	if name == "" {
+		name = BUD
+	}
+
+	business = rlib.Business{
+		Designation:           BUD,
+		Name:                  name,
+		DefaultRentCycle:      RentCycle,
+		DefaultProrationCycle: Proration,
+		DefaultGSRPC:          GSRPC,
+	}
+	_, err = rlib.InsertBusiness(ctx, &business)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -35,6 +35,7 @@ const (
 	DBPeople          = iota
 	DBRentable        = iota
 	DBRentalAgreement = iota
+	DBVehicle         = iota
 )
 
 // DBTypeMapStrings holds dbtype int to string format
@@ -45,6 +46,7 @@ var DBTypeMapStrings = map[int]string{
 	DBPeople:          strconv.Itoa(DBPeople),
 	DBRentable:        strconv.Itoa(DBRentable),
 	DBRentalAgreement: strconv.Itoa(DBRentalAgreement),
+	DBVehicle:         strconv.Itoa(DBVehicle),
 	-1:                "",
 }
 
@@ -56,8 +58,12 @@ var DBTypeMap = map[int]string{
 	DBPeople:          "Transactants",
 	DBRentable:        "Rentables",
 	DBRentalAgreement: "Rental Agreements",
+	DBVehicle:         "Vehicles",
 }
 
+// TCIDPrefix is put before TCID of transactant in reports
+const TCIDPrefix = "TC000"
+
 // SpecialCharsReplacer used to replace this all chars with blank
 var SpecialCharsReplacer = strings.NewReplacer(
 	"`", "", "~", "", "!", "", "@", "", "#", "", "$", "", "%", "", "^", "", "&", "", "*", "", "(", "", ")", "", "-", "", "_", "", "+", "", "=", "", //line1
@@ -8,6 +8,9 @@ type CSVFieldMap struct {
 	RentableCSV        RentableCSV
 	RentalAgreementCSV RentalAgreementCSV
 	CustomAttributeCSV CustomAttributeCSV
+
+	// transforms by csv type, they override the mapping of fields
+	Transforms map[string]FieldTransforms
 }
 
 // RentableTypeCSV is struct that is used
@@ -0,0 +1,104 @@
+package core
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"os"
+	"rentroll/rlib"
+	"strconv"
+)
+
+// =========
+// value type
+// =========
+// 0 - string, a collection of characters
+// 1 - 64-bit integer
+// 2 - 64-bit unsigned integer
+// 3 - 64-bit floating point
+// 4 - Date
+
+// CustomAttributeValue holds a custom attribute which importer loads
+// and references with an element once the element is loaded
+type CustomAttributeValue struct {
+	Name      string
+	ValueType string
+	Value     string
+	Units     string
+}
+
+// CreateCustomAttributesCSV creates temporary custom attribute csv of file path
+// with headers of struct, it returns file pointer and writer to call program
+func CreateCustomAttributesCSV(
+	filePath string,
+	customAttributeStruct *CustomAttributeCSV,
+) (*os.File, *csv.Writer, bool) {
+
+	var done = false
+
+	// try to create file and return with error if occurs any
+	customAttributeCSVFile, err := os.Create(filePath)
+	if err != nil {
+		rlib.Ulog("Error <CUSTOM ATTRIBUTES CSV>: %s\n", err.Error())
+		return nil, nil, done
+	}
+
+	// create csv writer
+	customAttributeCSVWriter := csv.NewWriter(customAttributeCSVFile)
+
+	// parse headers of customAttributeCSV using reflect
+	customAttributeCSVHeaders, ok := GetStructFields(customAttributeStruct)
+	if !ok {
+		rlib.Ulog("Error <CUSTOM ATTRIBUTES CSV>: Unable to get struct fields for customAttributeCSV\n")
+		return nil, nil, done
+	}
+
+	customAttributeCSVWriter.Write(customAttributeCSVHeaders)
+	customAttributeCSVWriter.Flush()
+
+	done = true
+
+	return customAttributeCSVFile, customAttributeCSVWriter, done
+}
+
+// GetCustomAttributeCSVRow returns custom attribute csv row of value for business
+func GetCustomAttributeCSVRow(BUD string, ca CustomAttributeValue) []string {
+	return []string{BUD, ca.Name, ca.ValueType, ca.Value, ca.Units}
+}
+
+// InsertCustomAttributeRef references the loaded custom attribute of value
+// with element, it returns id of reference or 0 if element has it already
+func InsertCustomAttributeRef(
+	ctx context.Context,
+	BID int64,
+	elementType int64,
+	ID int64,
+	ca CustomAttributeValue,
+) (int64, error) {
+
+	t, _ := strconv.ParseInt(ca.ValueType, 10, 64)
+	c, err := rlib.GetCustomAttributeByVals(ctx, t, ca.Name, ca.Value, ca.Units)
+	if err != nil {
+		return 0, err
+	}
+	if c.CID == 0 {
+		return 0, errors.New("custom attribute " + ca.Name + " is not found in db")
+	}
+
+	var a rlib.CustomAttributeRef
+	a.ElementType = elementType
+	a.BID = BID
+	a.ID = ID
+	a.CID = c.CID
+
+	// reference which exists already is not an error
+	ref, err := rlib.GetCustomAttributeRef(ctx, a.ElementType, a.ID, a.CID)
+	if err != nil {
+		return 0, err
+	}
+	if ref.ElementType == a.ElementType && ref.CID == a.CID && ref.ID == a.ID {
+		return 0, nil
+	}
+
+	return rlib.InsertCustomAttributeRef(ctx, &a)
+}
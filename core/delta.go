@@ -0,0 +1,389 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"rentroll/rlib"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// deltaDateLayout is the format of dates written by delta import
+const deltaDateLayout = "2006-01-02"
+
+// RecordChange holds a change made by import in a record which existed
+// before it, it is reverted when import is undone. Column is blank
+// if the row has been inserted by import.
+type RecordChange struct {
+	Table     string
+	KeyColumn string
+	Key       int64
+	Column    string
+	Old       string
+	New       string
+	Unit      string // unit of which change is made, blank if not known
+}
+
+// RecordUpdater makes dated changes in records of business in one
+// transaction and keeps what it has changed
+type RecordUpdater struct {
+	BID     int64
+	Changes []RecordChange
+	ctx     context.Context
+	tx      *sql.Tx
+}
+
+// NewRecordUpdater starts transaction for changes in business
+func NewRecordUpdater(ctx context.Context, BID int64) (*RecordUpdater, error) {
+	tx, err := rlib.RRdb.Dbrr.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &RecordUpdater{BID: BID, Changes: []RecordChange{}, ctx: ctx, tx: tx}, nil
+}
+
+// Commit saves the changes
+func (u *RecordUpdater) Commit() error {
+	return u.tx.Commit()
+}
+
+// Rollback discards the changes
+func (u *RecordUpdater) Rollback() {
+	u.tx.Rollback()
+	u.Changes = []RecordChange{}
+}
+
+// setColumn sets value of column in record, old value is kept in changes
+func (u *RecordUpdater) setColumn(table, keyColumn string, key int64, column, value string) error {
+	var old sql.NullString
+	q := "SELECT CAST(" + column + " AS CHAR) FROM " + table + " WHERE BID=? AND " + keyColumn + "=?"
+	if err := u.tx.QueryRowContext(u.ctx, q, u.BID, key).Scan(&old); err != nil {
+		return fmt.Errorf("Unable to read %s of %s %d: %s", column, table, key, err.Error())
+	}
+	if isSameColumnValue(old.String, value) {
+		return nil
+	}
+
+	q = "UPDATE " + table + " SET " + column + "=? WHERE BID=? AND " + keyColumn + "=?"
+	if _, err := u.tx.ExecContext(u.ctx, q, value, u.BID, key); err != nil {
+		return fmt.Errorf("Unable to update %s of %s %d: %s", column, table, key, err.Error())
+	}
+
+	u.Changes = append(u.Changes, RecordChange{
+		Table: table, KeyColumn: keyColumn, Key: key,
+		Column: column, Old: old.String, New: value,
+	})
+	return nil
+}
+
+// layouts of dates which CAST of date and datetime columns gives
+var columnDateLayouts = []string{"2006-01-02 15:04:05", "2006-01-02"}
+
+// isSameColumnValue checks value read from column is the same as new one,
+// dates and numbers are compared parsed as CAST doesn't format them the
+// way they are written, e.g. "2018-01-01 00:00:00" or "1200.0000"
+func isSameColumnValue(old, value string) bool {
+	old, value = strings.TrimSpace(old), strings.TrimSpace(value)
+	if old == value {
+		return true
+	}
+
+	for _, oldLayout := range columnDateLayouts {
+		oldDate, err := time.Parse(oldLayout, old)
+		if err != nil {
+			continue
+		}
+		for _, layout := range columnDateLayouts {
+			if date, err := time.Parse(layout, value); err == nil {
+				return oldDate.Equal(date)
+			}
+		}
+		return false
+	}
+
+	oldNumber, err := strconv.ParseFloat(old, 64)
+	if err != nil {
+		return false
+	}
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return false
+	}
+	return math.Abs(oldNumber-number) < 0.005
+}
+
+// insert inserts row in table, it is kept in changes with its key
+func (u *RecordUpdater) insert(table, keyColumn string, values map[string]interface{}) (int64, error) {
+	columns := []string{"BID"}
+	marks := []string{"?"}
+	args := []interface{}{u.BID}
+	for column, value := range values {
+		columns = append(columns, column)
+		marks = append(marks, "?")
+		args = append(args, value)
+	}
+
+	q := "INSERT INTO " + table + " (" + strings.Join(columns, ",") + ") VALUES (" + strings.Join(marks, ",") + ")"
+	res, err := u.tx.ExecContext(u.ctx, q, args...)
+	if err != nil {
+		return 0, fmt.Errorf("Unable to insert in %s: %s", table, err.Error())
+	}
+	key, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	u.Changes = append(u.Changes, RecordChange{Table: table, KeyColumn: keyColumn, Key: key})
+	return key, nil
+}
+
+// getKeys returns keys selected by query in transaction
+func (u *RecordUpdater) getKeys(q string, args ...interface{}) ([]int64, error) {
+	rows, err := u.tx.QueryContext(u.ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []int64{}
+	for rows.Next() {
+		var key int64
+		if err = rows.Scan(&key); err != nil {
+			return keys, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// StopRentalAgreement ends agreement with its rentables and payors on
+// stop date, dates which end earlier already are kept as they are
+func (u *RecordUpdater) StopRentalAgreement(RAID int64, stop time.Time) error {
+	d := stop.Format(deltaDateLayout)
+
+	for _, column := range []string{"AgreementStop", "PossessionStop", "RentStop"} {
+		keys, err := u.getKeys("SELECT RAID FROM RentalAgreement WHERE BID=? AND RAID=? AND "+column+">?", u.BID, RAID, d)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if err = u.setColumn("RentalAgreement", "RAID", key, column, d); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, item := range []struct {
+		table, keyColumn, stopColumn string
+	}{
+		{"RentalAgreementRentables", "RARID", "RARDtStop"},
+		{"RentalAgreementPayors", "RAPID", "DtStop"},
+	} {
+		keys, err := u.getKeys("SELECT "+item.keyColumn+" FROM "+item.table+" WHERE BID=? AND RAID=? AND "+item.stopColumn+">?", u.BID, RAID, d)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if err = u.setColumn(item.table, item.keyColumn, key, item.stopColumn, d); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// FindRentalAgreements returns agreements of rentable of which possession
+// starts on the date
+func (u *RecordUpdater) FindRentalAgreements(rentableName string, possessionStart time.Time) ([]int64, error) {
+	return u.getKeys(
+		`SELECT DISTINCT RentalAgreement.RAID FROM RentalAgreement
+		JOIN RentalAgreementRentables ON RentalAgreementRentables.RAID = RentalAgreement.RAID
+		JOIN Rentable ON Rentable.RID = RentalAgreementRentables.RID
+		WHERE RentalAgreement.BID=? AND Rentable.RentableName=? AND DATE(RentalAgreement.PossessionStart)=?`,
+		u.BID, rentableName, possessionStart.Format(deltaDateLayout))
+}
+
+// SetRentalAgreementStop sets stop dates of agreement to the date, earlier
+// or later than they are. Rentables and payors which end with agreement
+// or after the date are stopped on it too.
+func (u *RecordUpdater) SetRentalAgreementStop(RAID int64, stop time.Time) error {
+	d := stop.Format(deltaDateLayout)
+
+	var old string
+	err := u.tx.QueryRowContext(u.ctx,
+		"SELECT DATE_FORMAT(AgreementStop, '%Y-%m-%d') FROM RentalAgreement WHERE BID=? AND RAID=?",
+		u.BID, RAID).Scan(&old)
+	if err != nil {
+		return fmt.Errorf("Unable to read rental agreement %d: %s", RAID, err.Error())
+	}
+
+	for _, column := range []string{"AgreementStop", "PossessionStop", "RentStop"} {
+		if err = u.setColumn("RentalAgreement", "RAID", RAID, column, d); err != nil {
+			return err
+		}
+	}
+
+	for _, item := range []struct {
+		table, keyColumn, stopColumn string
+	}{
+		{"RentalAgreementRentables", "RARID", "RARDtStop"},
+		{"RentalAgreementPayors", "RAPID", "DtStop"},
+	} {
+		keys, err := u.getKeys("SELECT "+item.keyColumn+" FROM "+item.table+
+			" WHERE BID=? AND RAID=? AND ("+item.stopColumn+">? OR DATE("+item.stopColumn+")=?)", u.BID, RAID, d, old)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if err = u.setColumn(item.table, item.keyColumn, key, item.stopColumn, d); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// CancelRentalAgreement cancels agreement which has not taken effect, it
+// ends on the day it starts with its rentables and payors
+func (u *RecordUpdater) CancelRentalAgreement(RAID int64, start time.Time) error {
+	return u.StopRentalAgreement(RAID, start)
+}
+
+// ChangeContractRent changes rent of rentable in agreement from the date,
+// rent before the date is kept so the change is dated
+func (u *RecordUpdater) ChangeContractRent(RAID, RID int64, rent float64, from time.Time) error {
+	d := from.Format(deltaDateLayout)
+
+	rows, err := u.tx.QueryContext(u.ctx,
+		`SELECT RARID, CLID, DATE_FORMAT(RARDtStart, '%Y-%m-%d'), DATE_FORMAT(RARDtStop, '%Y-%m-%d')
+		FROM RentalAgreementRentables
+		WHERE BID=? AND RAID=? AND RID=? AND RARDtStart<=? AND RARDtStop>?`,
+		u.BID, RAID, RID, d, d)
+	if err != nil {
+		return err
+	}
+	type rar struct {
+		RARID, CLID int64
+		Start, Stop string
+	}
+	current := []rar{}
+	for rows.Next() {
+		var r rar
+		if err = rows.Scan(&r.RARID, &r.CLID, &r.Start, &r.Stop); err != nil {
+			rows.Close()
+			return err
+		}
+		current = append(current, r)
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return err
+	}
+
+	for _, r := range current {
+		// rent which starts today is just corrected
+		if r.Start == d {
+			if err = u.setColumn("RentalAgreementRentables", "RARID", r.RARID, "ContractRent", strconv.FormatFloat(rent, 'f', 2, 64)); err != nil {
+				return err
+			}
+			continue
+		}
+		if err = u.setColumn("RentalAgreementRentables", "RARID", r.RARID, "RARDtStop", d); err != nil {
+			return err
+		}
+		_, err = u.insert("RentalAgreementRentables", "RARID", map[string]interface{}{
+			"RAID":         RAID,
+			"RID":          RID,
+			"CLID":         r.CLID,
+			"ContractRent": rent,
+			"RARDtStart":   d,
+			"RARDtStop":    r.Stop,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ChangeRentableType changes rentable type of rentable from the date
+func (u *RecordUpdater) ChangeRentableType(RID, RTID int64, from time.Time) error {
+	d := from.Format(deltaDateLayout)
+
+	keys, err := u.getKeys("SELECT RTRID FROM RentableTypeRef WHERE BID=? AND RID=? AND DtStop>?", u.BID, RID, d)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err = u.setColumn("RentableTypeRef", "RTRID", key, "DtStop", d); err != nil {
+			return err
+		}
+	}
+
+	_, err = u.insert("RentableTypeRef", "RTRID", map[string]interface{}{
+		"RID":     RID,
+		"RTID":    RTID,
+		"DtStart": d,
+		"DtStop":  "9999-12-31",
+	})
+	return err
+}
+
+// ChangeRentableUseStatus changes use status of rentable from the date
+func (u *RecordUpdater) ChangeRentableUseStatus(RID, useStatus int64, from time.Time) error {
+	d := from.Format(deltaDateLayout)
+
+	keys, err := u.getKeys("SELECT RSID FROM RentableStatus WHERE BID=? AND RID=? AND DtStop>?", u.BID, RID, d)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err = u.setColumn("RentableStatus", "RSID", key, "DtStop", d); err != nil {
+			return err
+		}
+	}
+
+	_, err = u.insert("RentableStatus", "RSID", map[string]interface{}{
+		"RID":       RID,
+		"UseStatus": useStatus,
+		"DtStart":   d,
+		"DtStop":    "9999-12-31",
+	})
+	return err
+}
+
+// revertRecordChanges reverts changes of import in reverse order,
+// inserted rows are deleted and old values are set back
+func revertRecordChanges(ctx context.Context, tx *sql.Tx, BID int64, changes []RecordChange) (int, error) {
+	for i := len(changes) - 1; i >= 0; i-- {
+		c := changes[i]
+		var err error
+		if c.Column == "" {
+			_, err = tx.ExecContext(ctx, "DELETE FROM "+c.Table+" WHERE BID=? AND "+c.KeyColumn+"=?", BID, c.Key)
+		} else {
+			_, err = tx.ExecContext(ctx, "UPDATE "+c.Table+" SET "+c.Column+"=? WHERE BID=? AND "+c.KeyColumn+"=?", c.Old, BID, c.Key)
+		}
+		if err != nil {
+			return len(changes) - 1 - i, fmt.Errorf("Unable to revert change of %s %d: %s", c.Table, c.Key, err.Error())
+		}
+	}
+	return len(changes), nil
+}
+
+// RevertRecordChanges reverts changes made in records of business
+// in one transaction
+func RevertRecordChanges(ctx context.Context, BID int64, changes []RecordChange) error {
+	tx, err := rlib.RRdb.Dbrr.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if _, err = revertRecordChanges(ctx, tx, BID, changes); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,31 @@
+package core
+
+import "testing"
+
+func TestIsSameColumnValue(t *testing.T) {
+	tests := []struct {
+		name  string
+		old   string
+		value string
+		want  bool
+	}{
+		{name: "same text", old: "A1", value: "A1", want: true},
+		{name: "other text", old: "A1", value: "B1", want: false},
+		{name: "datetime and date", old: "2018-01-01 00:00:00", value: "2018-01-01", want: true},
+		{name: "datetime and other date", old: "2018-01-01 00:00:00", value: "2018-02-01", want: false},
+		{name: "datetime with time", old: "2018-01-01 12:00:00", value: "2018-01-01", want: false},
+		{name: "date and datetime", old: "2018-01-01", value: "2018-01-01 00:00:00", want: true},
+		{name: "date and text", old: "2018-01-01", value: "open", want: false},
+		{name: "decimal and number", old: "1200.0000", value: "1200", want: true},
+		{name: "decimal and rent", old: "1200.0000", value: "1200.00", want: true},
+		{name: "decimal and other rent", old: "1200.0000", value: "1250.00", want: false},
+		{name: "status", old: "7", value: "1", want: false},
+		{name: "number and text", old: "0", value: "", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := isSameColumnValue(tt.old, tt.value); got != tt.want {
+			t.Errorf("%s: isSameColumnValue(%q, %q) = %v, want %v", tt.name, tt.old, tt.value, got, tt.want)
+		}
+	}
+}
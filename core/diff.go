@@ -0,0 +1,488 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"gotable"
+	"math"
+	"rentroll/rlib"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// change kinds reported by diff
+const (
+	ChangeNewUnit      = "New unit"
+	ChangeUnitMissing  = "Unit not in file"
+	ChangeNewFloorPlan = "New floor plan"
+	ChangeFloorPlan    = "Floor plan change"
+	ChangeStatus       = "Status change"
+	ChangeMoveIn       = "Move-in"
+	ChangeMoveOut      = "Move-out"
+	ChangeRenewal      = "Renewal"
+	ChangeLeaseDates   = "Lease dates change"
+	ChangeRent         = "Rent change"
+	ChangeContact      = "Contact change"
+)
+
+// unit status compared by diff
+const (
+	UnitOccupied = "occupied"
+	UnitVacant   = "vacant"
+	UnitModel    = "model"
+)
+
+// TenantState holds a person living in unit with contact,
+// ids are set only for the people of business
+type TenantState struct {
+	Name  string
+	Email string
+	Phone string
+	TCID  int64
+	RAID  int64 // agreement of which person is payor
+}
+
+// UnitState holds what is known about a unit, either read from source
+// report or loaded from business in rentroll
+type UnitState struct {
+	Unit         string
+	RID          int64 // set only for the units of business
+	RentableType string
+	Status       string // occupied, vacant or model
+	Rent         float64
+	LeaseStart   string // 2006-01-02
+	LeaseEnd     string
+	Tenants      map[string]TenantState // key is normalised name
+}
+
+// BusinessState holds units and rentable types of a business
+type BusinessState struct {
+	Units         map[string]*UnitState
+	RentableTypes []string
+}
+
+// UnitChange holds a change found for a unit
+type UnitChange struct {
+	Unit    string
+	Change  string
+	Current string
+	New     string
+}
+
+// NewBusinessState returns empty state
+func NewBusinessState() *BusinessState {
+	return &BusinessState{Units: map[string]*UnitState{}}
+}
+
+// GetUnit returns state of unit, it is added if not there yet
+func (b *BusinessState) GetUnit(unit string) *UnitState {
+	if u, ok := b.Units[unit]; ok {
+		return u
+	}
+	u := &UnitState{Unit: unit, Tenants: map[string]TenantState{}}
+	b.Units[unit] = u
+	return u
+}
+
+// AddRentableType keeps rentable type once
+func (b *BusinessState) AddRentableType(style string) {
+	if style != "" && !StringInSlice(style, b.RentableTypes) {
+		b.RentableTypes = append(b.RentableTypes, style)
+	}
+}
+
+// GetTenantKey returns key of person in tenants of unit, names
+// are compared without case and special chars
+func GetTenantKey(firstName, lastName string) string {
+	return normalizeMatchText(firstName + lastName)
+}
+
+// GetLeaseKey returns key of lease of unit which starts on the date
+func GetLeaseKey(unit, leaseStart string) string {
+	return normalizeMatchText(unit) + "@" + normalizeMatchDate(leaseStart)
+}
+
+// MatchTenants returns key of current tenant for key of each incoming tenant
+// who is the same person. People are matched by name first, if one person of
+// each side is left over on the same lease of unit they are taken as same
+// person whose name is written differently, e.g. after marriage.
+func MatchTenants(current, incoming *UnitState) map[string]string {
+	matched := map[string]string{}
+	if current == nil || incoming == nil {
+		return matched
+	}
+
+	leftIncoming := []string{}
+	for key := range incoming.Tenants {
+		if _, ok := current.Tenants[key]; ok {
+			matched[key] = key
+		} else {
+			leftIncoming = append(leftIncoming, key)
+		}
+	}
+	leftCurrent := []string{}
+	for key := range current.Tenants {
+		if _, ok := incoming.Tenants[key]; !ok {
+			leftCurrent = append(leftCurrent, key)
+		}
+	}
+
+	if len(leftIncoming) != 1 || len(leftCurrent) != 1 || current.LeaseStart == "" {
+		return matched
+	}
+	if GetLeaseKey(current.Unit, current.LeaseStart) == GetLeaseKey(incoming.Unit, incoming.LeaseStart) {
+		matched[leftIncoming[0]] = leftCurrent[0]
+	}
+	return matched
+}
+
+// AddTenant adds person to unit, it returns the key of person
+func (u *UnitState) AddTenant(firstName, lastName, email, phone string) string {
+	name := strings.TrimSpace(firstName + " " + lastName)
+	key := GetTenantKey(firstName, lastName)
+	if key == "" {
+		return key
+	}
+	u.Tenants[key] = TenantState{Name: name, Email: email, Phone: phone}
+	return key
+}
+
+// SetLease sets rent and lease dates of unit, dates are normalised
+func (u *UnitState) SetLease(rent string, start string, end string) {
+	rent = strings.NewReplacer("$", "", ",", "").Replace(strings.TrimSpace(rent))
+	u.Rent, _ = strconv.ParseFloat(rent, 64)
+	u.LeaseStart = normalizeMatchDate(start)
+	u.LeaseEnd = normalizeMatchDate(end)
+}
+
+// LoadBusinessState loads current units of business with their type, status,
+// agreement which has not ended yet and its payors
+func LoadBusinessState(ctx context.Context, BID int64) (*BusinessState, error) {
+	state := NewBusinessState()
+
+	// rentable types
+	rows, err := rlib.RRdb.Dbrr.QueryContext(ctx, "SELECT Style FROM RentableTypes WHERE BID=?", BID)
+	if err != nil {
+		return state, err
+	}
+	for rows.Next() {
+		var style string
+		if err = rows.Scan(&style); err != nil {
+			rows.Close()
+			return state, err
+		}
+		state.AddRentableType(style)
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return state, err
+	}
+
+	// rentables with latest type and use status
+	q := `SELECT Rentable.RID, Rentable.RentableName,
+		IFNULL((SELECT RentableTypes.Style FROM RentableTypeRef
+			JOIN RentableTypes ON RentableTypes.RTID = RentableTypeRef.RTID
+			WHERE RentableTypeRef.RID = Rentable.RID
+			ORDER BY RentableTypeRef.DtStart DESC LIMIT 1), ''),
+		IFNULL((SELECT RentableStatus.UseStatus FROM RentableStatus
+			WHERE RentableStatus.RID = Rentable.RID
+			ORDER BY RentableStatus.DtStart DESC LIMIT 1), 0)
+		FROM Rentable WHERE Rentable.BID = ?`
+	rows, err = rlib.RRdb.Dbrr.QueryContext(ctx, q, BID)
+	if err != nil {
+		return state, err
+	}
+	ridUnits := map[int64]*UnitState{}
+	for rows.Next() {
+		var rid, useStatus int64
+		var name, style string
+		if err = rows.Scan(&rid, &name, &style, &useStatus); err != nil {
+			rows.Close()
+			return state, err
+		}
+		u := state.GetUnit(name)
+		u.RID = rid
+		u.RentableType = style
+		u.Status = UnitVacant
+		if useStatus == rlib.USESTATUSmodel {
+			u.Status = UnitModel
+		}
+		ridUnits[rid] = u
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return state, err
+	}
+
+	// agreements which have not ended, latest ones are kept for unit,
+	// people of a unit may have agreements of their own with same dates
+	q = `SELECT RentalAgreementRentables.RID, RentalAgreement.RAID,
+		DATE_FORMAT(RentalAgreement.AgreementStart, '%Y-%m-%d'),
+		DATE_FORMAT(RentalAgreement.AgreementStop, '%Y-%m-%d'), RentalAgreementRentables.ContractRent
+		FROM RentalAgreementRentables
+		JOIN RentalAgreement ON RentalAgreement.RAID = RentalAgreementRentables.RAID
+		WHERE RentalAgreementRentables.BID = ? AND RentalAgreement.AgreementStop > CURDATE()
+		ORDER BY RentalAgreement.AgreementStart`
+	rows, err = rlib.RRdb.Dbrr.QueryContext(ctx, q, BID)
+	if err != nil {
+		return state, err
+	}
+	raidUnits := map[int64]*UnitState{}
+	for rows.Next() {
+		var rid, raid int64
+		var start, stop sql.NullString
+		var rent float64
+		if err = rows.Scan(&rid, &raid, &start, &stop, &rent); err != nil {
+			rows.Close()
+			return state, err
+		}
+		u, ok := ridUnits[rid]
+		if !ok {
+			continue
+		}
+		// later agreement replaces tenants of former one
+		if normalizeMatchDate(start.String) != u.LeaseStart {
+			for k, r := range raidUnits {
+				if r == u {
+					delete(raidUnits, k)
+				}
+			}
+			u.Tenants = map[string]TenantState{}
+		}
+		u.SetLease(strconv.FormatFloat(rent, 'f', 2, 64), start.String, stop.String)
+		if u.Status != UnitModel {
+			u.Status = UnitOccupied
+		}
+		raidUnits[raid] = u
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return state, err
+	}
+
+	// payors of agreements
+	q = `SELECT RentalAgreementPayors.RAID, Transactant.TCID, Transactant.FirstName, Transactant.LastName,
+		Transactant.PrimaryEmail, Transactant.CellPhone, Transactant.WorkPhone
+		FROM RentalAgreementPayors
+		JOIN Transactant ON Transactant.TCID = RentalAgreementPayors.TCID
+		WHERE RentalAgreementPayors.BID = ?`
+	rows, err = rlib.RRdb.Dbrr.QueryContext(ctx, q, BID)
+	if err != nil {
+		return state, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var raid, tcid int64
+		var firstName, lastName, email, cellPhone, workPhone string
+		if err = rows.Scan(&raid, &tcid, &firstName, &lastName, &email, &cellPhone, &workPhone); err != nil {
+			return state, err
+		}
+		if u, ok := raidUnits[raid]; ok {
+			phone := cellPhone
+			if phone == "" {
+				phone = workPhone
+			}
+			if key := u.AddTenant(firstName, lastName, email, phone); key != "" {
+				t := u.Tenants[key]
+				t.TCID, t.RAID = tcid, raid
+				u.Tenants[key] = t
+			}
+		}
+	}
+
+	return state, rows.Err()
+}
+
+// formatRent returns rent for report
+func formatRent(rent float64) string {
+	return strconv.FormatFloat(rent, 'f', 2, 64)
+}
+
+// formatLease returns lease dates for report
+func formatLease(u *UnitState) string {
+	return u.LeaseStart + " - " + u.LeaseEnd
+}
+
+// getTenantNames returns sorted names of tenants
+func getTenantNames(tenants map[string]TenantState) string {
+	names := []string{}
+	for _, t := range tenants {
+		names = append(names, t.Name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, "; ")
+}
+
+// diffUnit returns changes of unit which is in both states
+func diffUnit(current, incoming *UnitState) []UnitChange {
+	changes := []UnitChange{}
+	add := func(change, from, to string) {
+		changes = append(changes, UnitChange{Unit: incoming.Unit, Change: change, Current: from, New: to})
+	}
+
+	if incoming.RentableType != "" && current.RentableType != incoming.RentableType {
+		add(ChangeFloorPlan, current.RentableType, incoming.RentableType)
+	}
+	if current.Status != incoming.Status {
+		add(ChangeStatus, current.Status, incoming.Status)
+	}
+
+	// people who moved in and out
+	common := 0
+	matched := MatchTenants(current, incoming)
+	staying := map[string]bool{}
+	keys := []string{}
+	for key := range incoming.Tenants {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		t := incoming.Tenants[key]
+		currentKey, ok := matched[key]
+		if !ok {
+			add(ChangeMoveIn, "", t.Name)
+			continue
+		}
+		c := current.Tenants[currentKey]
+		staying[currentKey] = true
+		common++
+
+		// contact of same person
+		if t.Email != "" && !strings.EqualFold(t.Email, c.Email) {
+			add(ChangeContact, c.Name+" email "+c.Email, t.Email)
+		}
+		if t.Phone != "" && normalizeMatchPhone(t.Phone) != normalizeMatchPhone(c.Phone) {
+			add(ChangeContact, c.Name+" phone "+c.Phone, t.Phone)
+		}
+	}
+	keys = []string{}
+	for key := range current.Tenants {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if !staying[key] {
+			add(ChangeMoveOut, current.Tenants[key].Name, "")
+		}
+	}
+
+	// lease and rent are compared only for same people
+	if common > 0 {
+		if current.LeaseEnd != incoming.LeaseEnd && incoming.LeaseEnd > current.LeaseEnd && current.LeaseStart != incoming.LeaseStart {
+			add(ChangeRenewal, formatLease(current), formatLease(incoming))
+		} else if current.LeaseStart != incoming.LeaseStart || current.LeaseEnd != incoming.LeaseEnd {
+			add(ChangeLeaseDates, formatLease(current), formatLease(incoming))
+		}
+		if math.Abs(current.Rent-incoming.Rent) >= 0.005 {
+			add(ChangeRent, formatRent(current.Rent), formatRent(incoming.Rent))
+		}
+	}
+
+	return changes
+}
+
+// DiffBusinessStates returns changes from current state of business
+// to the state read from source file, grouped by unit
+func DiffBusinessStates(current, incoming *BusinessState) []UnitChange {
+	changes := []UnitChange{}
+
+	// floor plans of business
+	for _, style := range incoming.RentableTypes {
+		if !StringInSlice(style, current.RentableTypes) {
+			changes = append(changes, UnitChange{Change: ChangeNewFloorPlan, New: style})
+		}
+	}
+
+	units := []string{}
+	for unit := range incoming.Units {
+		units = append(units, unit)
+	}
+	for unit := range current.Units {
+		if _, ok := incoming.Units[unit]; !ok {
+			units = append(units, unit)
+		}
+	}
+	sort.Strings(units)
+
+	for _, unit := range units {
+		c, inCurrent := current.Units[unit]
+		i, inIncoming := incoming.Units[unit]
+
+		switch {
+		case !inCurrent:
+			changes = append(changes, UnitChange{Unit: unit, Change: ChangeNewUnit, New: i.RentableType + " " + i.Status})
+			if len(i.Tenants) > 0 {
+				changes = append(changes, UnitChange{Unit: unit, Change: ChangeMoveIn, New: getTenantNames(i.Tenants)})
+			}
+		case !inIncoming:
+			changes = append(changes, UnitChange{Unit: unit, Change: ChangeUnitMissing, Current: c.RentableType + " " + c.Status})
+		default:
+			changes = append(changes, diffUnit(c, i)...)
+		}
+	}
+
+	return changes
+}
+
+// GetDiffReport returns change report grouped by unit
+func GetDiffReport(business *rlib.Business, csvFile string, changes []UnitChange) string {
+	return getChangeReport("CHANGES SINCE LAST IMPORT\n",
+		"Nothing has been written to the database.\n",
+		business, csvFile, changes)
+}
+
+// GetDeltaReport returns report of changes applied by delta import
+func GetDeltaReport(business *rlib.Business, csvFile string, changes []UnitChange) string {
+	return getChangeReport("CHANGES APPLIED\n",
+		"Contact changes, lease date corrections and units not in file are not applied.\n",
+		business, csvFile, changes)
+}
+
+// getChangeReport returns report of changes grouped by unit
+func getChangeReport(title string, note string, business *rlib.Business, csvFile string, changes []UnitChange) string {
+	var tbl gotable.Table
+	tbl.Init()
+	tbl.SetTitle(title)
+
+	counts := map[string]int{}
+	for _, c := range changes {
+		counts[c.Change]++
+	}
+	kinds := []string{}
+	for kind := range counts {
+		kinds = append(kinds, fmt.Sprintf("%s: %d", kind, counts[kind]))
+	}
+	sort.Strings(kinds)
+
+	section1 := "Date: " + time.Now().Format("1/2/2006") + "\n"
+	section1 += "Business: " + business.Designation + "\n"
+	section1 += "Compared File: " + csvFile + "\n"
+	section1 += note
+	tbl.SetSection1(section1)
+	tbl.SetSection2(fmt.Sprintf("%d change(s) %s", len(changes), strings.Join(kinds, ", ")))
+
+	tbl.AddColumn("Unit", 20, gotable.CELLSTRING, gotable.COLJUSTIFYLEFT)
+	tbl.AddColumn("Change", 20, gotable.CELLSTRING, gotable.COLJUSTIFYLEFT)
+	tbl.AddColumn("Current", 40, gotable.CELLSTRING, gotable.COLJUSTIFYLEFT)
+	tbl.AddColumn("New", 40, gotable.CELLSTRING, gotable.COLJUSTIFYLEFT)
+
+	for _, c := range changes {
+		tbl.AddRow()
+		tbl.Puts(-1, 0, c.Unit)
+		tbl.Puts(-1, 1, c.Change)
+		tbl.Puts(-1, 2, c.Current)
+		tbl.Puts(-1, 3, c.New)
+	}
+
+	s, err := tbl.SprintTable()
+	if err != nil {
+		rlib.Ulog("getChangeReport: error = %s", err.Error())
+	}
+	return s
+}
@@ -0,0 +1,591 @@
+package core
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"gotable"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path"
+	"path/filepath"
+	"reflect"
+	"rentroll/rlib"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kardianos/osext"
+)
+
+// ImportHistoryDirName is the folder next to importers' folders where
+// records of imports are kept, shared by all importers. The folder is on
+// the host which runs the importers, imports run from another install or
+// host are not in its history and can't be undone from here.
+const ImportHistoryDirName = "import_history"
+
+// ImportHistoryDir overrides the folder of import records if set
+var ImportHistoryDir string
+
+// import status
+const (
+	ImportStatusImported = "imported"
+	ImportStatusIssues   = "issues"
+	ImportStatusFailed   = "failed"
+)
+
+// import modes, business is loaded again or only
+// the changes since last import are applied
+const (
+	ImportModeReload = "reload"
+	ImportModeDelta  = "delta"
+)
+
+// ImportFile holds source file of import with its checksum
+type ImportFile struct {
+	Name   string
+	SHA256 string
+}
+
+// ImportIssue holds an error or warning reported for a line of source file
+type ImportIssue struct {
+	Line     int
+	Unit     string
+	DataType string
+	Severity string // error or warning
+	Message  string
+}
+
+// ImportRecord holds everything about one import run. Rentroll tables have no
+// field to carry import id, so ids of created records are kept in it instead.
+// They are found after each load by business and by keys of the rows import
+// wrote, so records which imports of other businesses insert meanwhile are
+// not taken. Imports of the same business must not run at the same time,
+// their records of same keys can't be told apart.
+type ImportRecord struct {
+	ImportID string
+	Source   string // onesite or roomkey
+	Files    []ImportFile
+	BUD      string
+	BID      int64
+	Operator string
+	Host     string
+	Options  map[string]string
+	Start    time.Time
+	End      time.Time
+	Mode     string
+	Status   string
+	Counts   map[string]map[string]int // data type to imported, possible, issues
+	Issues   []ImportIssue
+	Created  map[string][]int64 // data type to ids of created records
+	Changes  []RecordChange     // changes made in records which existed before
+	UndoneAt time.Time          // set once import has been undone
+	UndoneBy string
+
+	// highest id of each data type before its loader ran
+	loadStart map[int]int64
+}
+
+// loadedRecordQuery finds records which a loader inserted in business,
+// query selects id and key of records inserted after an id, key tells
+// the record is one written by import and not one inserted meanwhile
+type loadedRecordQuery struct {
+	Table    string
+	IDColumn string
+	Query    string
+}
+
+// loadedRecordQueries are for data types which rcsv loaders insert,
+// rcsv doesn't return ids of records it inserts
+var loadedRecordQueries = map[int]loadedRecordQuery{
+	DBRentableType: {Table: "RentableTypes", IDColumn: "RTID",
+		Query: "SELECT RTID, Style FROM RentableTypes WHERE BID=? AND RTID>?"},
+	DBCustomAttr: {Table: "CustomAttr", IDColumn: "CID",
+		Query: "SELECT CID, CONCAT(Name, '=', Value) FROM CustomAttr WHERE BID=? AND CID>?"},
+	DBPeople: {Table: "Transactant", IDColumn: "TCID",
+		Query: "SELECT TCID, TCID FROM Transactant WHERE BID=? AND TCID>?"},
+	DBRentable: {Table: "Rentable", IDColumn: "RID",
+		Query: "SELECT RID, RentableName FROM Rentable WHERE BID=? AND RID>?"},
+	DBRentalAgreement: {Table: "RentalAgreement", IDColumn: "RAID",
+		Query: "SELECT RA.RAID, CONCAT(R.RentableName, '=', DATE_FORMAT(RA.AgreementStart, '%Y-%m-%d')) FROM RentalAgreement RA " +
+			"JOIN RentalAgreementRentables RAR ON RAR.RAID=RA.RAID " +
+			"JOIN Rentable R ON R.RID=RAR.RID WHERE RA.BID=? AND RA.RAID>?"},
+}
+
+// currentOperator returns name of user who runs the importer
+func currentOperator() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return "unknown"
+}
+
+// getImportHistoryDir returns folder of import records
+func getImportHistoryDir() (string, error) {
+	if ImportHistoryDir != "" {
+		return ImportHistoryDir, nil
+	}
+	folderPath, err := osext.ExecutableFolder()
+	if err != nil {
+		return "", err
+	}
+	return path.Join(folderPath, "..", ImportHistoryDirName), nil
+}
+
+// getFileSHA256 returns checksum of file in hex
+func getFileSHA256(filePath string) (string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// NewImportRecord starts the record of import, checksum of files
+// is blank if file can't be read
+func NewImportRecord(source string, BUD string, files []string, options map[string]string, start time.Time) *ImportRecord {
+	r := &ImportRecord{
+		ImportID: BUD + "-" + start.Format("20060102T150405.000000"),
+		Source:   source,
+		BUD:      BUD,
+		Mode:     ImportModeReload,
+		Operator: currentOperator(),
+		Options:  map[string]string{},
+		Start:    start,
+		Counts:   map[string]map[string]int{},
+		Issues:   []ImportIssue{},
+		Created:  map[string][]int64{},
+	}
+	r.Host, _ = os.Hostname()
+
+	for _, f := range files {
+		if f == "" {
+			continue
+		}
+		sum, err := getFileSHA256(f)
+		if err != nil {
+			rlib.Ulog("NewImportRecord: error = %s\n", err.Error())
+		}
+		absPath, _ := filepath.Abs(f)
+		r.Files = append(r.Files, ImportFile{Name: absPath, SHA256: sum})
+	}
+
+	for k, v := range options {
+		r.Options[k] = v
+	}
+	return r
+}
+
+// setIssues keeps errors and warnings of source file in the record,
+// lineUnits gives unit of line if source has units
+func (r *ImportRecord) setIssues(csvErrors map[int][]string, lineUnits map[int]string) {
+	lines := []int{}
+	for line := range csvErrors {
+		lines = append(lines, line)
+	}
+	sort.Ints(lines)
+
+	for _, line := range lines {
+		for _, reason := range csvErrors[line] {
+			issue := parseIssue(reason)
+			issue.Line, issue.Unit = line, lineUnits[line]
+			r.Issues = append(r.Issues, issue)
+		}
+	}
+}
+
+// parseIssue returns issue of "E:<dbtype>:message" or "W:<dbtype>:message"
+// text of csv errors, line and unit are not set
+func parseIssue(reason string) ImportIssue {
+	issue := ImportIssue{Severity: "error"}
+
+	switch {
+	case strings.HasPrefix(reason, "E:"):
+		reason = strings.TrimPrefix(reason, "E:")
+	case strings.HasPrefix(reason, "W:"):
+		reason = strings.TrimPrefix(reason, "W:")
+		issue.Severity = "warning"
+	}
+
+	// "<dbtype>:message"
+	if parts := strings.SplitN(reason, ">:", 2); len(parts) == 2 && strings.HasPrefix(parts[0], "<") {
+		if dbType, err := strconv.Atoi(strings.TrimPrefix(parts[0], "<")); err == nil {
+			issue.DataType = DBTypeMap[dbType]
+		}
+		reason = parts[1]
+	}
+	issue.Message = reason
+	return issue
+}
+
+// GetCSVRowKeys returns keys of rows written in csv of struct type, key of
+// row is made of values of fields joined by "=", as loaded records are
+// looked up in EndLoad
+func GetCSVRowKeys(structType reflect.Type, rows [][]string, fields ...string) []string {
+	keys := []string{}
+	for _, row := range rows {
+		values := []string{}
+		for _, field := range fields {
+			value := ""
+			if f, ok := structType.FieldByName(field); ok && f.Index[0] < len(row) {
+				value = row[f.Index[0]]
+			}
+			values = append(values, value)
+		}
+		keys = append(keys, strings.Join(values, "="))
+	}
+	return keys
+}
+
+// GetAgreementRowKeys returns keys of rows of rental agreement csv, key
+// is unit of rentable spec with agreement start, e.g. "101=2018-05-01"
+func GetAgreementRowKeys(structType reflect.Type, rows [][]string) []string {
+	keys := GetCSVRowKeys(structType, rows, "RentableSpec", "AgreementStart")
+	for i, key := range keys {
+		// rentable spec is "<unit>,<contract rent>"
+		spec, start := key, ""
+		if j := strings.LastIndex(key, "="); j != -1 {
+			spec, start = key[:j], key[j+1:]
+		}
+		keys[i] = strings.SplitN(spec, ",", 2)[0] + "=" + normalizeMatchDate(start)
+	}
+	return keys
+}
+
+// BeginLoad notes the highest id of data type before its loader inserts
+// records, ids are of all businesses and EndLoad keeps those of business only
+func (r *ImportRecord) BeginLoad(ctx context.Context, dbType int) error {
+	q, ok := loadedRecordQueries[dbType]
+	if !ok {
+		return fmt.Errorf("records of %s can't be traced", DBTypeMap[dbType])
+	}
+
+	var id int64
+	err := rlib.RRdb.Dbrr.QueryRowContext(ctx,
+		"SELECT COALESCE(MAX("+q.IDColumn+"), 0) FROM "+q.Table).Scan(&id)
+	if err != nil {
+		return err
+	}
+
+	if r.loadStart == nil {
+		r.loadStart = map[int]int64{}
+	}
+	r.loadStart[dbType] = id
+	return nil
+}
+
+// EndLoad keeps ids of records of data type which are inserted in business
+// since BeginLoad and have one of the keys written by import
+func (r *ImportRecord) EndLoad(ctx context.Context, BID int64, dbType int, keys []string) error {
+	q, ok := loadedRecordQueries[dbType]
+	if !ok {
+		return fmt.Errorf("records of %s can't be traced", DBTypeMap[dbType])
+	}
+	start, ok := r.loadStart[dbType]
+	if !ok {
+		return fmt.Errorf("load of %s has not begun", DBTypeMap[dbType])
+	}
+	delete(r.loadStart, dbType)
+
+	written := map[string]bool{}
+	for _, key := range keys {
+		written[key] = true
+	}
+
+	rows, err := rlib.RRdb.Dbrr.QueryContext(ctx, q.Query, BID, start)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	// agreement of many rentables comes once for each of them
+	found := map[int64]bool{}
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		var key string
+		if err = rows.Scan(&id, &key); err != nil {
+			return err
+		}
+		if written[key] && !found[id] {
+			found[id] = true
+			ids = append(ids, id)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	r.AddCreated(dbType, ids...)
+	return nil
+}
+
+// AddCreated keeps ids of records of data type created by import
+func (r *ImportRecord) AddCreated(dbType int, ids ...int64) {
+	if len(ids) == 0 {
+		return
+	}
+	dataType := DBTypeMap[dbType]
+	r.Created[dataType] = append(r.Created[dataType], ids...)
+}
+
+// Finish completes the record with status, counts and issues
+// of the business and saves it in import history
+func (r *ImportRecord) Finish(
+	ctx context.Context,
+	BID int64,
+	status string,
+	summaryCount map[int]map[string]int,
+	csvErrors map[int][]string,
+	lineUnits map[int]string,
+) {
+	r.End = time.Now()
+	r.BID = BID
+	r.Status = status
+
+	for dbType, counts := range summaryCount {
+		r.Counts[DBTypeMap[dbType]] = counts
+	}
+	r.setIssues(csvErrors, lineUnits)
+
+	if err := r.Save(); err != nil {
+		rlib.Ulog("ImportRecord.Finish: error = %s\n", err.Error())
+	}
+}
+
+// Save writes the record in import history folder
+func (r *ImportRecord) Save() error {
+	historyDir, err := getImportHistoryDir()
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(historyDir, 0700); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(r, "", "    ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path.Join(historyDir, r.ImportID+".json"), data, 0600)
+}
+
+// GetImportRecord reads the record of import from import history
+func GetImportRecord(importID string) (ImportRecord, error) {
+	var r ImportRecord
+
+	historyDir, err := getImportHistoryDir()
+	if err != nil {
+		return r, err
+	}
+	data, err := ioutil.ReadFile(path.Join(historyDir, filepath.Base(importID)+".json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return r, fmt.Errorf("Import %s is not found in import history", importID)
+		}
+		return r, err
+	}
+	err = json.Unmarshal(data, &r)
+	return r, err
+}
+
+// ListImportRecords returns records of all imports, latest first
+func ListImportRecords() ([]ImportRecord, error) {
+	records := []ImportRecord{}
+
+	historyDir, err := getImportHistoryDir()
+	if err != nil {
+		return records, err
+	}
+	files, err := filepath.Glob(path.Join(historyDir, "*.json"))
+	if err != nil {
+		return records, err
+	}
+
+	for _, f := range files {
+		r, err := GetImportRecord(strings.TrimSuffix(filepath.Base(f), ".json"))
+		if err != nil {
+			rlib.Ulog("ListImportRecords: %s: error = %s\n", f, err.Error())
+			continue
+		}
+		records = append(records, r)
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Start.After(records[j].Start)
+	})
+	return records, nil
+}
+
+// getImportHistoryReport returns list of imports
+func getImportHistoryReport(records []ImportRecord) string {
+	var tbl gotable.Table
+	tbl.Init()
+	tbl.SetTitle("IMPORT HISTORY")
+
+	tbl.AddColumn("Import ID", 30, gotable.CELLSTRING, gotable.COLJUSTIFYLEFT)
+	tbl.AddColumn("Source", 8, gotable.CELLSTRING, gotable.COLJUSTIFYLEFT)
+	tbl.AddColumn("BUD", 10, gotable.CELLSTRING, gotable.COLJUSTIFYLEFT)
+	tbl.AddColumn("Started", 20, gotable.CELLSTRING, gotable.COLJUSTIFYLEFT)
+	tbl.AddColumn("Operator", 12, gotable.CELLSTRING, gotable.COLJUSTIFYLEFT)
+	tbl.AddColumn("Status", 10, gotable.CELLSTRING, gotable.COLJUSTIFYLEFT)
+	tbl.AddColumn("Issues", 6, gotable.CELLINT, gotable.COLJUSTIFYLEFT)
+	tbl.AddColumn("File", 40, gotable.CELLSTRING, gotable.COLJUSTIFYLEFT)
+
+	for _, r := range records {
+		file := ""
+		if len(r.Files) > 0 {
+			file = filepath.Base(r.Files[0].Name)
+		}
+
+		tbl.AddRow()
+		tbl.Puts(-1, 0, r.ImportID)
+		tbl.Puts(-1, 1, r.Source)
+		tbl.Puts(-1, 2, r.BUD)
+		tbl.Puts(-1, 3, r.Start.Format("2006-01-02 15:04:05"))
+		tbl.Puts(-1, 4, r.Operator)
+		tbl.Puts(-1, 5, r.Status)
+		tbl.Puti(-1, 6, int64(len(r.Issues)))
+		tbl.Puts(-1, 7, file)
+	}
+
+	s, err := tbl.SprintTable()
+	if err != nil {
+		rlib.Ulog("getImportHistoryReport: error = %s", err.Error())
+	}
+	return s
+}
+
+// getImportRecordReport returns details of an import
+func getImportRecordReport(r ImportRecord) string {
+	var report string
+	report += "Import ID: " + r.ImportID + "\n"
+	report += "Source: " + r.Source + "\n"
+	if r.Mode != "" {
+		report += "Mode: " + r.Mode + "\n"
+	}
+	report += fmt.Sprintf("Business: %s (BID %d)\n", r.BUD, r.BID)
+	report += "Operator: " + r.Operator + " on " + r.Host + "\n"
+	report += "Started: " + r.Start.Format(time.RFC1123) + "\n"
+	report += "Ended: " + r.End.Format(time.RFC1123) + "\n"
+	report += "Status: " + r.Status + "\n"
+	if len(r.Changes) > 0 {
+		report += fmt.Sprintf("Changed Records: %d\n", len(r.Changes))
+	}
+	if r.Status == ImportStatusUndone {
+		report += "Undone: " + r.UndoneAt.Format(time.RFC1123) + " by " + r.UndoneBy + "\n"
+	}
+	for _, f := range r.Files {
+		report += "File: " + f.Name + "\n"
+		report += "  SHA-256: " + f.SHA256 + "\n"
+	}
+
+	options := []string{}
+	for k, v := range r.Options {
+		options = append(options, k+"="+v)
+	}
+	sort.Strings(options)
+	report += "Options: " + strings.Join(options, ", ") + "\n\n"
+
+	var tbl gotable.Table
+	tbl.Init()
+	tbl.SetTitle("Summary")
+	tbl.AddColumn("Data Type", 30, gotable.CELLSTRING, gotable.COLJUSTIFYLEFT)
+	tbl.AddColumn("Total Possible", 10, gotable.CELLINT, gotable.COLJUSTIFYLEFT)
+	tbl.AddColumn("Total Imported", 10, gotable.CELLINT, gotable.COLJUSTIFYLEFT)
+	tbl.AddColumn("Issues", 10, gotable.CELLINT, gotable.COLJUSTIFYLEFT)
+	tbl.AddColumn("Created Records", 10, gotable.CELLINT, gotable.COLJUSTIFYLEFT)
+
+	dataTypes := []string{}
+	for dataType := range r.Counts {
+		dataTypes = append(dataTypes, dataType)
+	}
+	sort.Strings(dataTypes)
+	for _, dataType := range dataTypes {
+		tbl.AddRow()
+		tbl.Puts(-1, 0, dataType)
+		tbl.Puti(-1, 1, int64(r.Counts[dataType]["possible"]))
+		tbl.Puti(-1, 2, int64(r.Counts[dataType]["imported"]))
+		tbl.Puti(-1, 3, int64(r.Counts[dataType]["issues"]))
+		tbl.Puti(-1, 4, int64(len(r.Created[dataType])))
+	}
+	s, err := tbl.SprintTable()
+	if err != nil {
+		rlib.Ulog("getImportRecordReport: error = %s", err.Error())
+	}
+	report += s + "\n"
+
+	if len(r.Issues) == 0 {
+		return report
+	}
+
+	tbl = gotable.Table{}
+	tbl.Init()
+	tbl.SetTitle("Issues")
+	tbl.AddColumn("Input Line", 6, gotable.CELLINT, gotable.COLJUSTIFYLEFT)
+	tbl.AddColumn("Unit", 20, gotable.CELLSTRING, gotable.COLJUSTIFYLEFT)
+	tbl.AddColumn("Data Type", 20, gotable.CELLSTRING, gotable.COLJUSTIFYLEFT)
+	tbl.AddColumn("Severity", 8, gotable.CELLSTRING, gotable.COLJUSTIFYLEFT)
+	tbl.AddColumn("Description", 100, gotable.CELLSTRING, gotable.COLJUSTIFYLEFT)
+	for _, issue := range r.Issues {
+		tbl.AddRow()
+		tbl.Puti(-1, 0, int64(issue.Line))
+		tbl.Puts(-1, 1, issue.Unit)
+		tbl.Puts(-1, 2, issue.DataType)
+		tbl.Puts(-1, 3, issue.Severity)
+		tbl.Puts(-1, 4, issue.Message)
+	}
+	s, err = tbl.SprintTable()
+	if err != nil {
+		rlib.Ulog("getImportRecordReport: error = %s", err.Error())
+	}
+	return report + s
+}
+
+// RunHistoryCommand runs "history" subcommand of importer, it lists past imports
+// or shows one of them if import id is passed. It returns exit code.
+func RunHistoryCommand(args []string) int {
+	fs := flag.NewFlagSet("history", flag.ContinueOnError)
+	bud := fs.String("bud", "", "list imports of this business unit designation only")
+	source := fs.String("source", "", "list imports of this source only (onesite, roomkey)")
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+
+	if fs.NArg() > 0 {
+		r, err := GetImportRecord(fs.Arg(0))
+		if err != nil {
+			fmt.Println(err.Error())
+			return 1
+		}
+		fmt.Println(getImportRecordReport(r))
+		return 0
+	}
+
+	records, err := ListImportRecords()
+	if err != nil {
+		fmt.Println(err.Error())
+		return 1
+	}
+
+	filtered := []ImportRecord{}
+	for _, r := range records {
+		if (*bud == "" || strings.EqualFold(r.BUD, *bud)) && (*source == "" || strings.EqualFold(r.Source, *source)) {
+			filtered = append(filtered, r)
+		}
+	}
+	fmt.Println(getImportHistoryReport(filtered))
+	return 0
+}
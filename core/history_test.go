@@ -0,0 +1,59 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGetAgreementRowKeys(t *testing.T) {
+	structType := reflect.TypeOf(RentalAgreementCSV{})
+	getRow := func(spec, start string) []string {
+		row := make([]string, structType.NumField())
+		f, _ := structType.FieldByName("RentableSpec")
+		row[f.Index[0]] = spec
+		f, _ = structType.FieldByName("AgreementStart")
+		row[f.Index[0]] = start
+		return row
+	}
+
+	rows := [][]string{
+		getRow("6301-001,700", "11/10/2017"),
+		getRow("1204,109.00", "2018-05-01"),
+		getRow("1204", ""),
+	}
+	want := []string{"6301-001=2017-11-10", "1204=2018-05-01", "1204="}
+
+	if got := GetAgreementRowKeys(structType, rows); !reflect.DeepEqual(got, want) {
+		t.Errorf("keys = %v, want %v", got, want)
+	}
+}
+
+func TestParseIssue(t *testing.T) {
+	tests := []struct {
+		name   string
+		reason string
+		want   ImportIssue
+	}{
+		{
+			name:   "error",
+			reason: "E:<" + DBTypeMapStrings[DBRentalAgreement] + ">:Unable to insert",
+			want:   ImportIssue{DataType: DBTypeMap[DBRentalAgreement], Severity: "error", Message: "Unable to insert"},
+		},
+		{
+			name:   "warning",
+			reason: "W:<" + DBTypeMapStrings[DBPeople] + ">:Merged with line 19",
+			want:   ImportIssue{DataType: DBTypeMap[DBPeople], Severity: "warning", Message: "Merged with line 19"},
+		},
+		{
+			name:   "no data type",
+			reason: "Unable to read row",
+			want:   ImportIssue{Severity: "error", Message: "Unable to read row"},
+		},
+	}
+
+	for _, tt := range tests {
+		if got := parseIssue(tt.reason); got != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,280 @@
+package core
+
+import (
+	"html/template"
+	"os"
+	"rentroll/rlib"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// noUnitGroup is the group of issues which are not about a unit
+const noUnitGroup = "(no unit)"
+
+// htmlCell holds a cell of source row with its header
+type htmlCell struct {
+	Header string
+	Value  string
+}
+
+// htmlIssue holds issue with the source row it is about
+type htmlIssue struct {
+	ImportIssue
+	Source []htmlCell
+}
+
+// htmlUnitGroup holds issues of a unit
+type htmlUnitGroup struct {
+	Unit     string
+	Issues   []htmlIssue
+	Errors   int
+	Warnings int
+}
+
+// htmlCount holds counts of a data type for summary
+type htmlCount struct {
+	DataType string
+	Possible int
+	Imported int
+	Issues   int
+}
+
+// htmlReportData is passed to html report template
+type htmlReportData struct {
+	Record    *ImportRecord
+	Generated string
+	Counts    []htmlCount
+	Errors    int
+	Warnings  int
+	DataTypes []string
+	Groups    []htmlUnitGroup
+	Sections  []string
+}
+
+// getSourceCells returns cells of source line with headers of the
+// nearest header line above it, blank cells are left out
+func getSourceCells(t [][]string, line int, headerLines []int) []htmlCell {
+	if line < 1 || line > len(t) {
+		return nil
+	}
+
+	header := []string{}
+	for _, h := range headerLines {
+		if h >= 1 && h <= line && h <= len(t) {
+			header = t[h-1]
+		}
+	}
+
+	cells := []htmlCell{}
+	for i, value := range t[line-1] {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		name := "Column " + strconv.Itoa(i+1)
+		if i < len(header) && strings.TrimSpace(header[i]) != "" {
+			name = strings.Join(strings.Fields(header[i]), " ")
+		}
+		cells = append(cells, htmlCell{Header: name, Value: value})
+	}
+	return cells
+}
+
+// getHTMLReportData groups issues of import by unit with their source rows
+func getHTMLReportData(r *ImportRecord, headerLines []int, sections []string) htmlReportData {
+	data := htmlReportData{
+		Record:    r,
+		Generated: time.Now().Format("1/2/2006 3:04 PM"),
+		Sections:  sections,
+	}
+	sort.Ints(headerLines)
+
+	dataTypes := []string{}
+	for dataType := range r.Counts {
+		dataTypes = append(dataTypes, dataType)
+	}
+	sort.Strings(dataTypes)
+	for _, dataType := range dataTypes {
+		count := r.Counts[dataType]
+		data.Counts = append(data.Counts, htmlCount{
+			DataType: dataType,
+			Possible: count["possible"],
+			Imported: count["imported"],
+			Issues:   count["issues"],
+		})
+	}
+
+	// source file is read again to show the rows of issues
+	var t [][]string
+	if len(r.Files) > 0 {
+		t = rlib.LoadCSV(r.Files[0].Name)
+	}
+
+	groups := map[string]*htmlUnitGroup{}
+	issueTypes := map[string]bool{}
+	for _, issue := range r.Issues {
+		unit := issue.Unit
+		if unit == "" {
+			unit = noUnitGroup
+		}
+		g, ok := groups[unit]
+		if !ok {
+			g = &htmlUnitGroup{Unit: unit}
+			groups[unit] = g
+		}
+		g.Issues = append(g.Issues, htmlIssue{
+			ImportIssue: issue,
+			Source:      getSourceCells(t, issue.Line, headerLines),
+		})
+		if issue.Severity == "warning" {
+			g.Warnings++
+			data.Warnings++
+		} else {
+			g.Errors++
+			data.Errors++
+		}
+		if issue.DataType != "" {
+			issueTypes[issue.DataType] = true
+		}
+	}
+
+	for dataType := range issueTypes {
+		data.DataTypes = append(data.DataTypes, dataType)
+	}
+	sort.Strings(data.DataTypes)
+
+	units := []string{}
+	for unit := range groups {
+		units = append(units, unit)
+	}
+	sort.Strings(units)
+	for _, unit := range units {
+		data.Groups = append(data.Groups, *groups[unit])
+	}
+	return data
+}
+
+// WriteHTMLReport writes report of import as one html file which has
+// everything in it, so it can be sent on as it is. Source rows of issues
+// are shown with the headers of the nearest header line above them.
+func WriteHTMLReport(filePath string, r *ImportRecord, headerLines []int, sections ...string) error {
+	f, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return htmlReportTemplate.Execute(f, getHTMLReportData(r, headerLines, sections))
+}
+
+// htmlReportTemplate is the page of html report, styles and script are
+// inline so that it doesn't need anything from network
+var htmlReportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Import {{.Record.ImportID}} - {{.Record.BUD}}</title>
+<style>
+body { font-family: Arial, Helvetica, sans-serif; font-size: 14px; margin: 20px; color: #222; }
+h1 { font-size: 20px; }
+h2 { font-size: 16px; margin-top: 24px; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; vertical-align: top; }
+th { background: #f0f0f0; }
+.meta td:first-child { font-weight: bold; }
+.filters { margin: 12px 0; padding: 8px; background: #f7f7f7; border: 1px solid #ddd; }
+.filters label { margin-right: 16px; }
+details.unit { margin: 6px 0; border: 1px solid #ddd; padding: 4px 8px; }
+details.unit summary { cursor: pointer; font-weight: bold; }
+.error { color: #b00020; }
+.warning { color: #b36b00; }
+.source td { background: #fafafa; font-size: 12px; }
+.source span { display: inline-block; margin: 0 12px 2px 0; }
+.source b { color: #555; }
+pre { background: #fafafa; border: 1px solid #ddd; padding: 8px; overflow-x: auto; }
+</style>
+</head>
+<body>
+<h1>Import Report - {{.Record.Source}}</h1>
+<table class="meta">
+<tr><td>Import ID</td><td>{{.Record.ImportID}}</td></tr>
+<tr><td>Business</td><td>{{.Record.BUD}}</td></tr>
+<tr><td>Status</td><td>{{.Record.Status}}</td></tr>
+<tr><td>Mode</td><td>{{.Record.Mode}}</td></tr>
+{{range .Record.Files}}<tr><td>File</td><td>{{.Name}}</td></tr>
+{{end}}<tr><td>Started</td><td>{{.Record.Start.Format "1/2/2006 3:04:05 PM"}}</td></tr>
+<tr><td>Generated</td><td>{{.Generated}}</td></tr>
+</table>
+
+<h2>Summary</h2>
+<table>
+<tr><th>Data Type</th><th>Total Possible</th><th>Total Imported</th><th>Issues</th></tr>
+{{range .Counts}}<tr><td>{{.DataType}}</td><td>{{.Possible}}</td><td>{{.Imported}}</td><td>{{.Issues}}</td></tr>
+{{end}}</table>
+<p><span class="error">{{.Errors}} error(s)</span>, <span class="warning">{{.Warnings}} warning(s)</span> in {{len .Groups}} unit(s)</p>
+
+{{if .Groups}}<h2>Issues by Unit</h2>
+<div class="filters">
+<label><input type="checkbox" id="f-error" checked onchange="applyFilters()"> Errors</label>
+<label><input type="checkbox" id="f-warning" checked onchange="applyFilters()"> Warnings</label>
+<label>Data type <select id="f-type" onchange="applyFilters()">
+<option value="">All</option>
+{{range .DataTypes}}<option value="{{.}}">{{.}}</option>
+{{end}}</select></label>
+<label><input type="checkbox" id="f-open" onchange="toggleAll()"> Expand all</label>
+<span id="f-count"></span>
+</div>
+{{range .Groups}}<details class="unit">
+<summary>{{.Unit}} - <span class="error">{{.Errors}} error(s)</span>, <span class="warning">{{.Warnings}} warning(s)</span></summary>
+<table>
+<tr><th>Line</th><th>Severity</th><th>Data Type</th><th>Message</th></tr>
+{{range .Issues}}<tbody class="issue" data-severity="{{.Severity}}" data-type="{{.DataType}}">
+<tr><td>{{if gt .Line 0}}{{.Line}}{{end}}</td><td class="{{.Severity}}">{{.Severity}}</td><td>{{.DataType}}</td><td>{{.Message}}</td></tr>
+{{if .Source}}<tr class="source"><td colspan="4">{{range .Source}}<span><b>{{.Header}}:</b> {{.Value}}</span>{{end}}</td></tr>
+{{end}}</tbody>
+{{end}}</table>
+</details>
+{{end}}{{end}}
+{{range .Sections}}{{if .}}<pre>{{.}}</pre>
+{{end}}{{end}}
+<script>
+function applyFilters() {
+	var severity = {
+		error: document.getElementById("f-error").checked,
+		warning: document.getElementById("f-warning").checked
+	};
+	var type = document.getElementById("f-type").value;
+	var units = document.querySelectorAll("details.unit");
+	var shown = 0;
+	for (var i = 0; i < units.length; i++) {
+		var issues = units[i].querySelectorAll("tbody.issue");
+		var visible = 0;
+		for (var j = 0; j < issues.length; j++) {
+			var show = severity[issues[j].getAttribute("data-severity")] &&
+				(type === "" || issues[j].getAttribute("data-type") === type);
+			issues[j].style.display = show ? "" : "none";
+			if (show) {
+				visible++;
+			}
+		}
+		units[i].style.display = visible > 0 ? "" : "none";
+		shown += visible;
+	}
+	document.getElementById("f-count").textContent = shown + " issue(s) shown";
+}
+function toggleAll() {
+	var open = document.getElementById("f-open").checked;
+	var units = document.querySelectorAll("details.unit");
+	for (var i = 0; i < units.length; i++) {
+		units[i].open = open;
+	}
+}
+if (document.getElementById("f-type")) {
+	applyFilters();
+}
+</script>
+</body>
+</html>
+`))
@@ -0,0 +1,168 @@
+package core
+
+import (
+	"fmt"
+	"gotable"
+	"rentroll/rlib"
+	"sort"
+	"time"
+)
+
+// UnitDown is the status of units which can't be rented, counted by kpis only
+const UnitDown = "down"
+
+// days of lease expiration buckets
+var kpiExpirationDays = []int{30, 60, 90}
+
+// KPIUnit holds what kpis need of a unit in source report
+type KPIUnit struct {
+	FloorPlan  string
+	Status     string // occupied, vacant, model or down
+	MarketRent float64
+	LeaseRent  float64
+	LeaseEnd   string // 2006-01-02, blank if lease has no end
+}
+
+// RentRollKPI holds units of source report from which kpis are computed.
+// Market rent is shown only if source has it.
+type RentRollKPI struct {
+	AsOf       time.Time
+	MarketRent bool
+	Units      map[string]*KPIUnit
+}
+
+// NewRentRollKPI returns empty kpis as of date
+func NewRentRollKPI(asOf time.Time) *RentRollKPI {
+	return &RentRollKPI{
+		AsOf:  time.Date(asOf.Year(), asOf.Month(), asOf.Day(), 0, 0, 0, 0, time.UTC),
+		Units: map[string]*KPIUnit{},
+	}
+}
+
+// GetUnit returns unit, found is false if it has been added now
+func (k *RentRollKPI) GetUnit(unit string) (*KPIUnit, bool) {
+	u, found := k.Units[unit]
+	if !found {
+		u = &KPIUnit{}
+		k.Units[unit] = u
+	}
+	return u, found
+}
+
+// SetLeaseEnd sets lease end of unit from date of source
+func (u *KPIUnit) SetLeaseEnd(d string) {
+	u.LeaseEnd = normalizeMatchDate(d)
+}
+
+// floorPlanKPI holds sums of a floor plan
+type floorPlanKPI struct {
+	Units, Occupied         int
+	MarketRent, LeaseRent   float64
+	MarketUnits, LeaseUnits int
+}
+
+// average returns sum divided by count, zero if count is zero
+func average(sum float64, count int) float64 {
+	if count == 0 {
+		return 0
+	}
+	return sum / float64(count)
+}
+
+// GetKPIReport returns occupancy, average rents by floor plan,
+// lease expirations and month-to-month count of source
+func GetKPIReport(k *RentRollKPI) string {
+	statusCounts := map[string]int{}
+	floorPlans := map[string]*floorPlanKPI{}
+	expiring := make([]int, len(kpiExpirationDays))
+	monthToMonth := 0
+
+	for _, u := range k.Units {
+		statusCounts[u.Status]++
+
+		fp, ok := floorPlans[u.FloorPlan]
+		if !ok {
+			fp = &floorPlanKPI{}
+			floorPlans[u.FloorPlan] = fp
+		}
+		fp.Units++
+		if u.MarketRent != 0 {
+			fp.MarketRent += u.MarketRent
+			fp.MarketUnits++
+		}
+		if u.Status != UnitOccupied {
+			continue
+		}
+		fp.Occupied++
+		if u.LeaseRent != 0 {
+			fp.LeaseRent += u.LeaseRent
+			fp.LeaseUnits++
+		}
+
+		// lease which has ended or has no end goes on month to month
+		end, err := time.Parse("2006-01-02", u.LeaseEnd)
+		if err != nil || end.Before(k.AsOf) {
+			monthToMonth++
+			continue
+		}
+		days := int(end.Sub(k.AsOf).Hours() / 24)
+		for i, limit := range kpiExpirationDays {
+			if days <= limit {
+				expiring[i]++
+				break
+			}
+		}
+	}
+
+	var tbl gotable.Table
+	tbl.Init()
+	tbl.SetTitle("Rent Roll KPIs")
+	tbl.SetSection1("As of: " + k.AsOf.Format("1/2/2006") + "\n")
+
+	occupancy := 0.0
+	if len(k.Units) > 0 {
+		occupancy = float64(statusCounts[UnitOccupied]) * 100 / float64(len(k.Units))
+	}
+	section2 := fmt.Sprintf("Occupancy: %.1f%% (occupied %d, vacant %d, model %d, down %d of %d units)\n",
+		occupancy, statusCounts[UnitOccupied], statusCounts[UnitVacant],
+		statusCounts[UnitModel], statusCounts[UnitDown], len(k.Units))
+	section2 += "Leases expiring:"
+	from := 0
+	for i, limit := range kpiExpirationDays {
+		if i > 0 {
+			section2 += ","
+		}
+		section2 += fmt.Sprintf(" %d-%d days %d", from, limit, expiring[i])
+		from = limit + 1
+	}
+	section2 += fmt.Sprintf("\nMonth-to-month: %d\n", monthToMonth)
+	tbl.SetSection2(section2)
+
+	tbl.AddColumn("Floor Plan", 20, gotable.CELLSTRING, gotable.COLJUSTIFYLEFT)
+	tbl.AddColumn("Units", 10, gotable.CELLINT, gotable.COLJUSTIFYLEFT)
+	tbl.AddColumn("Occupied", 10, gotable.CELLINT, gotable.COLJUSTIFYLEFT)
+	tbl.AddColumn("Avg Market Rent", 12, gotable.CELLSTRING, gotable.COLJUSTIFYRIGHT)
+	tbl.AddColumn("Avg Lease Rent", 12, gotable.CELLSTRING, gotable.COLJUSTIFYRIGHT)
+
+	names := []string{}
+	for name := range floorPlans {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fp := floorPlans[name]
+		tbl.AddRow()
+		tbl.Puts(-1, 0, name)
+		tbl.Puti(-1, 1, int64(fp.Units))
+		tbl.Puti(-1, 2, int64(fp.Occupied))
+		tbl.Puts(-1, 3, formatAmount(average(fp.MarketRent, fp.MarketUnits), k.MarketRent))
+		tbl.Puts(-1, 4, formatAmount(average(fp.LeaseRent, fp.LeaseUnits), true))
+	}
+
+	s, err := tbl.SprintTable()
+	if err != nil {
+		rlib.Ulog("GetKPIReport: error = %s", err.Error())
+	}
+	return s
+}
@@ -0,0 +1,120 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"syscall"
+	"time"
+)
+
+// ImportLockDir holds lock files of businesses being imported on this host
+var ImportLockDir = path.Join(os.TempDir(), "rentroll_import_locks")
+
+// ImportLock is held on a business for the whole import so that
+// two imports can't delete and load the same business at once.
+// Lock file is locked with flock, so lock of an import which has
+// crashed or been killed is released by the system.
+type ImportLock struct {
+	BUD   string
+	Owner string // user who runs the import
+	Host  string
+	PID   int
+	Since time.Time
+	path  string
+	file  *os.File
+}
+
+// String tells who holds the lock and since when
+func (l *ImportLock) String() string {
+	return fmt.Sprintf("%s on %s (pid %d) since %s", l.Owner, l.Host, l.PID, l.Since.Format(time.RFC1123))
+}
+
+// getImportLockPath returns path of lock file of business
+func getImportLockPath(BUD string) string {
+	return path.Join(ImportLockDir, SpecialCharsReplacer.Replace(BUD)+".lock")
+}
+
+// readImportLock reads the holder of lock from lock file
+func readImportLock(lockPath string) (*ImportLock, error) {
+	data, err := ioutil.ReadFile(lockPath)
+	if err != nil {
+		return nil, err
+	}
+	var l ImportLock
+	err = json.Unmarshal(data, &l)
+	l.path = lockPath
+	return &l, err
+}
+
+// AcquireImportLock locks business of BUD for import, it returns an error which
+// names the holder of lock if business is being imported already
+func AcquireImportLock(BUD string) (*ImportLock, error) {
+	if err := os.MkdirAll(ImportLockDir, 0777); err != nil {
+		return nil, err
+	}
+
+	l := &ImportLock{
+		BUD:   BUD,
+		Owner: currentOperator(),
+		PID:   os.Getpid(),
+		Since: time.Now(),
+		path:  getImportLockPath(BUD),
+	}
+	l.Host, _ = os.Hostname()
+
+	data, err := json.Marshal(l)
+	if err != nil {
+		return nil, err
+	}
+
+	// lock file is never removed, so that all imports lock the same file
+	f, err := os.OpenFile(l.path, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, err
+	}
+	err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err == syscall.EWOULDBLOCK {
+		f.Close()
+		// holder may not have written itself in lock file yet
+		holder, err := readImportLock(l.path)
+		if err != nil {
+			return nil, fmt.Errorf("Business %s is being imported, please try again once it is done", BUD)
+		}
+		return nil, fmt.Errorf("Business %s is being imported by %s, please try again once it is done", BUD, holder.String())
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	// tell who holds the lock to imports which can't get it
+	if err = f.Truncate(0); err == nil {
+		_, err = f.WriteAt(data, 0)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	l.file = f
+	return l, nil
+}
+
+// Release unlocks the business so that it can be imported again
+func (l *ImportLock) Release() error {
+	if l.file == nil {
+		return fmt.Errorf("Lock of business %s is released already", l.BUD)
+	}
+	f := l.file
+	l.file = nil
+
+	// holder is cleared before unlock, lock is released on close anyway
+	f.Truncate(0)
+	err := syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,382 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"gotable"
+	"io/ioutil"
+	"rentroll/rlib"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PersonMatchRules holds weights of fields and thresholds by which
+// duplicate people are found, loaded from match.json
+type PersonMatchRules struct {
+	Weights        map[string]float64 // Name, Email, Phone, Address, DateOfBirth
+	AutoMergeScore float64            // people at or above it are merged
+	ReviewScore    float64            // people at or above it are reported for review
+}
+
+// PersonRecord holds the values of a person used for matching,
+// either a row of source file or an existing transactant
+type PersonRecord struct {
+	Row         int   // key of row in importer, -1 for transactant
+	Line        int   // line of source file to report
+	TCID        int64 // existing transactant, 0 for row of source file
+	FirstName   string
+	LastName    string
+	Email       string
+	Phone       string
+	Address     string
+	PostalCode  string
+	DateOfBirth string
+
+	// transactant of business which is deleted before it is loaded again,
+	// it is only reported as it can't be merged with
+	Deleted bool
+}
+
+// PersonMatch holds the candidate found for a person with its score
+type PersonMatch struct {
+	Candidate PersonRecord
+	Score     float64
+	Fields    []string // fields which matched
+}
+
+// PersonDuplicate holds person of a row and the candidate found for it
+type PersonDuplicate struct {
+	Person PersonRecord
+	Match  PersonMatch
+	Merged bool
+}
+
+// PersonMatcher finds duplicates of people among rows of source file
+// and existing transactants
+type PersonMatcher struct {
+	rules      PersonMatchRules
+	records    []PersonRecord
+	index      map[string][]int // blocking key to records
+	duplicates map[int]PersonDuplicate
+}
+
+// GetPersonMatchRules reads json file of person match rules
+func GetPersonMatchRules(matchFilePath string) (PersonMatchRules, error) {
+	var rules PersonMatchRules
+
+	data, err := ioutil.ReadFile(matchFilePath)
+	if err != nil {
+		return rules, err
+	}
+	err = json.Unmarshal(data, &rules)
+	return rules, err
+}
+
+// NewPersonMatcher returns matcher with the rules
+func NewPersonMatcher(rules PersonMatchRules) *PersonMatcher {
+	return &PersonMatcher{
+		rules:      rules,
+		index:      map[string][]int{},
+		duplicates: map[int]PersonDuplicate{},
+	}
+}
+
+// normalizeMatchText makes text comparable, lower case
+// without special chars and spaces
+func normalizeMatchText(s string) string {
+	return strings.ToLower(SpecialCharsReplacer.Replace(s))
+}
+
+// normalizeMatchPhone returns last ten digits of phone
+func normalizeMatchPhone(s string) string {
+	digits := nonDigitRe.ReplaceAllString(s, "")
+	if len(digits) > 10 {
+		digits = digits[len(digits)-10:]
+	}
+	if len(digits) < 7 {
+		return ""
+	}
+	return digits
+}
+
+// normalizeMatchDate returns date in one format so that dates
+// of source file and database can be compared
+func normalizeMatchDate(s string) string {
+	s = strings.TrimSpace(s)
+	for _, layout := range []string{"2006-01-02", "01/02/2006", "1/2/2006", "2006-01-02 15:04:05", time.RFC3339} {
+		if d, err := time.Parse(layout, s); err == nil {
+			return d.Format("2006-01-02")
+		}
+	}
+	return s
+}
+
+// blockingKeys returns keys by which candidates of person are looked up
+func (r PersonRecord) blockingKeys() []string {
+	keys := []string{}
+	if email := strings.ToLower(strings.TrimSpace(r.Email)); email != "" {
+		keys = append(keys, "email:"+email)
+	}
+	if phone := normalizeMatchPhone(r.Phone); phone != "" {
+		keys = append(keys, "phone:"+phone)
+	}
+	if last := normalizeMatchText(r.LastName); last != "" {
+		keys = append(keys, "last:"+last)
+	}
+	return keys
+}
+
+// Add puts person in matcher so that next people are matched with it
+func (m *PersonMatcher) Add(r PersonRecord) {
+	m.records = append(m.records, r)
+	for _, key := range r.blockingKeys() {
+		m.index[key] = append(m.index[key], len(m.records)-1)
+	}
+}
+
+// Score returns how likely two people are the same with the fields matched,
+// date of birth which differs lowers the score
+func (m *PersonMatcher) Score(a, b PersonRecord) (float64, []string) {
+	score := 0.0
+	fields := []string{}
+
+	// name matches fully or with initial of first name
+	aLast, bLast := normalizeMatchText(a.LastName), normalizeMatchText(b.LastName)
+	aFirst, bFirst := normalizeMatchText(a.FirstName), normalizeMatchText(b.FirstName)
+	if aLast != "" && aLast == bLast {
+		switch {
+		case aFirst != "" && aFirst == bFirst:
+			score += m.rules.Weights["Name"]
+			fields = append(fields, "name")
+		case aFirst != "" && bFirst != "" && aFirst[0] == bFirst[0]:
+			score += m.rules.Weights["Name"] * 0.7
+			fields = append(fields, "name initial")
+		}
+	}
+
+	aEmail, bEmail := strings.ToLower(strings.TrimSpace(a.Email)), strings.ToLower(strings.TrimSpace(b.Email))
+	if aEmail != "" && aEmail == bEmail {
+		score += m.rules.Weights["Email"]
+		fields = append(fields, "email")
+	}
+
+	aPhone, bPhone := normalizeMatchPhone(a.Phone), normalizeMatchPhone(b.Phone)
+	if aPhone != "" && aPhone == bPhone {
+		score += m.rules.Weights["Phone"]
+		fields = append(fields, "phone")
+	}
+
+	aAddress, bAddress := normalizeMatchText(a.Address), normalizeMatchText(b.Address)
+	if aAddress != "" && aAddress == bAddress {
+		if normalizeMatchText(a.PostalCode) == normalizeMatchText(b.PostalCode) {
+			score += m.rules.Weights["Address"]
+		} else {
+			score += m.rules.Weights["Address"] * 0.7
+		}
+		fields = append(fields, "address")
+	}
+
+	aDOB, bDOB := normalizeMatchDate(a.DateOfBirth), normalizeMatchDate(b.DateOfBirth)
+	if aDOB != "" && bDOB != "" {
+		if aDOB == bDOB {
+			score += m.rules.Weights["DateOfBirth"]
+			fields = append(fields, "date of birth")
+		} else {
+			score -= m.rules.Weights["DateOfBirth"]
+		}
+	}
+
+	if score > 1 {
+		score = 1
+	}
+	return score, fields
+}
+
+// Match returns the best candidate of person which is scored
+// at or above review score, ok is false if there is none.
+// Candidate found is kept for report of duplicates by line.
+func (m *PersonMatcher) Match(r PersonRecord) (PersonMatch, bool) {
+	best := PersonMatch{}
+	seen := map[int]bool{}
+
+	for _, key := range r.blockingKeys() {
+		for _, i := range m.index[key] {
+			if seen[i] {
+				continue
+			}
+			seen[i] = true
+
+			score, fields := m.Score(r, m.records[i])
+			if score > best.Score {
+				best = PersonMatch{Candidate: m.records[i], Score: score, Fields: fields}
+			}
+		}
+	}
+
+	if len(best.Fields) == 0 || best.Score < m.rules.ReviewScore {
+		return best, false
+	}
+	m.duplicates[r.Line] = PersonDuplicate{Person: r, Match: best, Merged: m.IsAutoMerge(best)}
+	return best, true
+}
+
+// IsAutoMerge checks the match is good enough to merge people without review,
+// transactant which is deleted is never merged with
+func (m *PersonMatcher) IsAutoMerge(match PersonMatch) bool {
+	return !match.Candidate.Deleted &&
+		m.rules.AutoMergeScore > 0 && match.Score >= m.rules.AutoMergeScore
+}
+
+// SetTransactantsDeleted marks transactants loaded in matcher as deleted,
+// business is deleted after they are loaded so that they are only reported
+func (m *PersonMatcher) SetTransactantsDeleted() {
+	for i := range m.records {
+		if m.records[i].TCID > 0 {
+			m.records[i].Deleted = true
+		}
+	}
+}
+
+// GetDuplicates returns people found as duplicates by line
+func (m *PersonMatcher) GetDuplicates() map[int]PersonDuplicate {
+	return m.duplicates
+}
+
+// GetPersonRecord returns record for matching from people csv row
+func GetPersonRecord(row []string, rowKey int, line int) PersonRecord {
+	fields, _ := GetStructFields(&PeopleCSV{})
+	values := map[string]string{}
+	for i, field := range fields {
+		if i < len(row) {
+			values[field] = strings.TrimSpace(row[i])
+		}
+	}
+
+	phone := values["CellPhone"]
+	if phone == "" {
+		phone = values["WorkPhone"]
+	}
+
+	return PersonRecord{
+		Row:         rowKey,
+		Line:        line,
+		FirstName:   values["FirstName"],
+		LastName:    values["LastName"],
+		Email:       values["PrimaryEmail"],
+		Phone:       phone,
+		Address:     values["Address"],
+		PostalCode:  values["PostalCode"],
+		DateOfBirth: values["DateofBirth"],
+	}
+}
+
+// LoadTransactantRecords adds existing transactants of business in matcher
+func (m *PersonMatcher) LoadTransactantRecords(ctx context.Context, BID int64) error {
+	q := `SELECT Transactant.TCID, Transactant.FirstName, Transactant.LastName,
+		Transactant.PrimaryEmail, Transactant.CellPhone, Transactant.WorkPhone,
+		Transactant.Address, Transactant.PostalCode, User.DateofBirth
+		FROM Transactant LEFT JOIN User ON User.TCID = Transactant.TCID
+		WHERE Transactant.BID = ?`
+
+	rows, err := rlib.RRdb.Dbrr.QueryContext(ctx, q, BID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r PersonRecord
+		var cellPhone, workPhone, dob sql.NullString
+		err = rows.Scan(&r.TCID, &r.FirstName, &r.LastName, &r.Email,
+			&cellPhone, &workPhone, &r.Address, &r.PostalCode, &dob)
+		if err != nil {
+			return err
+		}
+
+		r.Row = -1
+		r.Phone = cellPhone.String
+		if r.Phone == "" {
+			r.Phone = workPhone.String
+		}
+		// zero date means date of birth is not known
+		if !strings.HasPrefix(dob.String, "0000") {
+			r.DateOfBirth = dob.String
+		}
+		m.Add(r)
+	}
+
+	return rows.Err()
+}
+
+// describe returns text to refer the candidate in report
+func (r PersonRecord) describe() string {
+	name := strings.TrimSpace(r.FirstName + " " + r.LastName)
+	if r.TCID > 0 && r.Deleted {
+		return fmt.Sprintf("transactant %s \"%s\" of business before reload", TCIDPrefix+strconv.FormatInt(r.TCID, 10), name)
+	}
+	if r.TCID > 0 {
+		return fmt.Sprintf("existing transactant %s \"%s\"", TCIDPrefix+strconv.FormatInt(r.TCID, 10), name)
+	}
+	return fmt.Sprintf("\"%s\" at line %d", name, r.Line)
+}
+
+// GetPersonMatchWarning returns row warning for merged person
+// or possible duplicate which needs review
+func (m *PersonMatcher) GetPersonMatchWarning(match PersonMatch) string {
+	warnPrefix := "W:<" + DBTypeMapStrings[DBPeople] + ">:"
+	if m.IsAutoMerge(match) {
+		return warnPrefix + fmt.Sprintf(
+			"Merged with %s (score %.0f%%, matched on %s)",
+			match.Candidate.describe(), match.Score*100, strings.Join(match.Fields, ", "),
+		)
+	}
+	return warnPrefix + fmt.Sprintf(
+		"Possible duplicate of %s (score %.0f%%, matched on %s), please review",
+		match.Candidate.describe(), match.Score*100, strings.Join(match.Fields, ", "),
+	)
+}
+
+// GetPersonDuplicateReport returns possible duplicates with their scores by line
+func GetPersonDuplicateReport(duplicates map[int]PersonDuplicate) string {
+	var tbl gotable.Table
+	tbl.Init()
+	tbl.SetTitle("POSSIBLE DUPLICATES")
+
+	tbl.AddColumn("Input Line", 6, gotable.CELLSTRING, gotable.COLJUSTIFYLEFT)
+	tbl.AddColumn("Person", 30, gotable.CELLSTRING, gotable.COLJUSTIFYLEFT)
+	tbl.AddColumn("Candidate", 50, gotable.CELLSTRING, gotable.COLJUSTIFYLEFT)
+	tbl.AddColumn("Score", 6, gotable.CELLSTRING, gotable.COLJUSTIFYLEFT)
+	tbl.AddColumn("Matched On", 30, gotable.CELLSTRING, gotable.COLJUSTIFYLEFT)
+	tbl.AddColumn("Action", 10, gotable.CELLSTRING, gotable.COLJUSTIFYLEFT)
+
+	lines := []int{}
+	for line := range duplicates {
+		lines = append(lines, line)
+	}
+	sort.Ints(lines)
+
+	for _, line := range lines {
+		d := duplicates[line]
+		action := "Review"
+		if d.Merged {
+			action = "Merged"
+		}
+		tbl.AddRow()
+		tbl.Puts(-1, 0, strconv.Itoa(line))
+		tbl.Puts(-1, 1, strings.TrimSpace(d.Person.FirstName+" "+d.Person.LastName))
+		tbl.Puts(-1, 2, d.Match.Candidate.describe())
+		tbl.Puts(-1, 3, fmt.Sprintf("%.0f%%", d.Match.Score*100))
+		tbl.Puts(-1, 4, strings.Join(d.Match.Fields, ", "))
+		tbl.Puts(-1, 5, action)
+	}
+
+	s, err := tbl.SprintTable()
+	if err != nil {
+		rlib.Ulog("GetPersonDuplicateReport: error = %s", err.Error())
+	}
+	return s
+}
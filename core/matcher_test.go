@@ -0,0 +1,155 @@
+package core
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+// rules of person matching used by importers
+const sampleMatchJSON = "../admin/roomkey/match.json"
+
+// people of guest.csv sample by line, placeholder values
+// are removed as importer normalises rows before matching
+var sampleGuests = map[int]PersonRecord{
+	19:  {FirstName: "Tommy", LastName: "Beddell", Email: "tbeddell@nxutilities.com", Phone: "9182023030", Address: "205 Pebble Court", PostalCode: "77868"},
+	30:  {FirstName: "Jason", LastName: "Breazeale", Email: "john.walker@avedaenergy.com", Phone: "4057212194", PostalCode: "73132"},
+	31:  {FirstName: "Jason", LastName: "Breazeale", Phone: "4057212194", PostalCode: "73132"},
+	32:  {FirstName: "Bobby", LastName: "Brown", Email: "tbeddell@nxutilities.com", Phone: "9182023030", Address: "205 Pebble Court", PostalCode: "77868"},
+	221: {FirstName: "Briatt", LastName: "Vann", Phone: "4057212194", PostalCode: "73132"},
+	222: {FirstName: "Briatt", LastName: "Vann", Email: "okball@ymail.com", Phone: "4059219780", Address: "11212 nw 98th st", PostalCode: "73099"},
+	228: {FirstName: "Bill", LastName: "Walker", Email: "william.a.walker@faa.gov", Phone: "304-904-9894", Address: "83 Aviation Way", PostalCode: "25405"},
+	229: {FirstName: "John", LastName: "Walker", Email: "JOHN.WALKER@AVEDAENERGY.COM", Phone: "7015707129", Address: "3701 PRAIRIE COM", PostalCode: "58801"},
+	230: {FirstName: "John", LastName: "Walker", Phone: "4057212194", PostalCode: "73132"},
+}
+
+// getSampleGuest returns person of guest.csv sample at line
+func getSampleGuest(line int) PersonRecord {
+	r := sampleGuests[line]
+	r.Row, r.Line = line, line
+	return r
+}
+
+func TestPersonMatcherScore(t *testing.T) {
+	rules, err := GetPersonMatchRules(sampleMatchJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := NewPersonMatcher(rules)
+
+	adams := PersonRecord{FirstName: "Andrew", LastName: "Adams", Email: "adamsdrew1029@gmail.com", Phone: "3174602146", Address: "115 NW St", PostalCode: "46052"}
+	with := func(r PersonRecord, change func(*PersonRecord)) PersonRecord {
+		change(&r)
+		return r
+	}
+
+	tests := []struct {
+		name   string
+		a, b   PersonRecord
+		score  float64
+		fields string
+	}{
+		{"same person", adams, with(adams, func(r *PersonRecord) {
+			r.Email, r.Phone, r.Address = "ADAMSDREW1029@gmail.com ", "+1 (317) 460-2146", "115 N.W. St"
+		}), 1, "name, email, phone, address"},
+		{"initial of first name", adams, with(adams, func(r *PersonRecord) { r.FirstName, r.Phone, r.Address = "A.", "", "" }), 0.68, "name initial, email"},
+		{"other postal code", adams, with(adams, func(r *PersonRecord) { r.Email, r.Phone, r.PostalCode = "", "", "46053" }), 0.54, "name, address"},
+		{"date of birth differs", with(adams, func(r *PersonRecord) { r.DateOfBirth = "1990-10-29" }), with(adams, func(r *PersonRecord) {
+			r.Phone, r.Address, r.DateOfBirth = "", "", "10/28/1990"
+		}), 0.5, "name, email"},
+		{"date of birth matches", with(adams, func(r *PersonRecord) { r.Email, r.Phone, r.Address, r.DateOfBirth = "", "", "", "1990-10-29" }), with(adams, func(r *PersonRecord) {
+			r.DateOfBirth = "10/29/1990"
+		}), 0.7, "name, date of birth"},
+		{"same name only", getSampleGuest(229), getSampleGuest(230), 0.4, "name"},
+		{"other first name", getSampleGuest(228), getSampleGuest(229), 0, ""},
+		{"company email", getSampleGuest(30), getSampleGuest(229), 0.4, "email"},
+		{"office phone", getSampleGuest(31), getSampleGuest(221), 0.3, "phone"},
+	}
+
+	for _, tt := range tests {
+		score, fields := m.Score(tt.a, tt.b)
+		if math.Abs(score-tt.score) > 1e-9 || strings.Join(fields, ", ") != tt.fields {
+			t.Errorf("%s: score %.2f on %v, want %.2f on %s", tt.name, score, fields, tt.score, tt.fields)
+		}
+	}
+}
+
+func TestPersonMatcherMatch(t *testing.T) {
+	rules, err := GetPersonMatchRules(sampleMatchJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := NewPersonMatcher(rules)
+
+	// guests are matched with the ones before them as importer does
+	tests := []struct {
+		line      int
+		candidate int
+		matched   bool
+		merged    bool
+	}{
+		{19, 0, false, false},
+		{30, 0, false, false},
+		{31, 30, true, false},
+		// contacts of company are shared by its guests, which
+		// scores above auto merge though names are not same
+		{32, 19, true, true},
+		{221, 0, false, false},
+		{222, 221, false, false},
+		{228, 0, false, false},
+		{229, 0, false, false},
+		{230, 0, false, false},
+	}
+
+	for _, tt := range tests {
+		r := getSampleGuest(tt.line)
+		match, ok := m.Match(r)
+		if ok != tt.matched || (ok && match.Candidate.Line != tt.candidate) {
+			t.Errorf("line %d: matched %t with line %d (score %.2f), want %t with line %d",
+				tt.line, ok, match.Candidate.Line, match.Score, tt.matched, tt.candidate)
+		}
+		if ok && m.IsAutoMerge(match) != tt.merged {
+			t.Errorf("line %d: merged %t, want %t", tt.line, m.IsAutoMerge(match), tt.merged)
+		}
+		m.Add(r)
+	}
+
+	duplicates := m.GetDuplicates()
+	if len(duplicates) != 2 || duplicates[31].Merged || !duplicates[32].Merged {
+		t.Errorf("got duplicates %+v", duplicates)
+	}
+}
+
+func TestPersonMatcherDeletedTransactant(t *testing.T) {
+	rules, err := GetPersonMatchRules(sampleMatchJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := NewPersonMatcher(rules)
+
+	transactant := getSampleGuest(19)
+	transactant.Row, transactant.Line, transactant.TCID = -1, 0, 7
+	m.Add(transactant)
+
+	r := getSampleGuest(19)
+	match, ok := m.Match(r)
+	if !ok || !m.IsAutoMerge(match) {
+		t.Fatalf("existing transactant: matched %t, merged %t", ok, m.IsAutoMerge(match))
+	}
+	if w := m.GetPersonMatchWarning(match); !strings.Contains(w, "Merged with existing transactant TC0007 \"Tommy Beddell\"") {
+		t.Errorf("existing transactant: got warning %q", w)
+	}
+
+	// transactants of business which is deleted are reported only
+	m.SetTransactantsDeleted()
+	match, ok = m.Match(r)
+	if !ok || m.IsAutoMerge(match) {
+		t.Fatalf("deleted transactant: matched %t, merged %t", ok, m.IsAutoMerge(match))
+	}
+	if w := m.GetPersonMatchWarning(match); !strings.Contains(w, "Possible duplicate of transactant TC0007 \"Tommy Beddell\" of business before reload") {
+		t.Errorf("deleted transactant: got warning %q", w)
+	}
+	if d := m.GetDuplicates()[19]; d.Merged || d.Match.Candidate.TCID != 7 {
+		t.Errorf("deleted transactant: got duplicate %+v", d)
+	}
+}
@@ -0,0 +1,180 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PersonName holds the parts of a person name parsed from source
+type PersonName struct {
+	Title     string
+	First     string
+	Middle    string
+	Last      string
+	Suffix    string
+	Uncertain bool   // parts may not be correct
+	Reason    string // why parts may not be correct
+}
+
+// nameTitles are the titles which can come before name,
+// lower case without dots
+var nameTitles = []string{"mr", "mrs", "ms", "miss", "mx", "dr", "prof", "rev", "sir", "capt", "sgt"}
+
+// nameSuffixes are the suffixes which can come after last name,
+// lower case without dots
+var nameSuffixes = []string{"jr", "sr", "ii", "iii", "iv", "md", "phd", "esq", "dds", "cpa"}
+
+// lastNameParticles are the words which belong to last name
+// when name is in "First Last" format, like "de la Cruz"
+var lastNameParticles = []string{"de", "la", "del", "della", "da", "di", "van", "von", "der", "den", "le", "st", "bin", "al"}
+
+// nameToken returns the word in lower case without dots for comparison
+func nameToken(word string) string {
+	return strings.ToLower(strings.Trim(word, ".,"))
+}
+
+// splitNameTitle removes titles from the start of words
+func splitNameTitle(words []string) (string, []string) {
+	titles := []string{}
+	for len(words) > 0 && StringInSlice(nameToken(words[0]), nameTitles) {
+		titles = append(titles, words[0])
+		words = words[1:]
+	}
+	return strings.Join(titles, " "), words
+}
+
+// splitNameSuffix removes suffixes from the end of words
+func splitNameSuffix(words []string) (string, []string) {
+	suffixes := []string{}
+	for len(words) > 1 && StringInSlice(nameToken(words[len(words)-1]), nameSuffixes) {
+		suffixes = append([]string{words[len(words)-1]}, suffixes...)
+		words = words[:len(words)-1]
+	}
+	return strings.Join(suffixes, " "), words
+}
+
+// ParsePersonName parses name of a person in "Last, First Middle",
+// "Last Jr., First", "First Middle Last" or single word format.
+// title is the value of separate title column if source has one, it is
+// used when name does not carry its own title.
+func ParsePersonName(name string, title string) PersonName {
+	var n PersonName
+	n.Title = strings.TrimSpace(title)
+
+	name = strings.Join(strings.Fields(name), " ")
+	if name == "" {
+		n.Uncertain, n.Reason = true, "name is blank"
+		return n
+	}
+
+	parts := strings.Split(name, ",")
+	for i := range parts {
+		parts[i] = strings.TrimSpace(parts[i])
+	}
+
+	// "Last, Jr., First" and "Last, First, Jr." carry suffix as a part
+	suffixParts := []string{}
+	otherParts := []string{}
+	for i, part := range parts {
+		if i > 0 && StringInSlice(nameToken(part), nameSuffixes) {
+			suffixParts = append(suffixParts, part)
+			continue
+		}
+		otherParts = append(otherParts, part)
+	}
+	parts = otherParts
+	n.Suffix = strings.Join(suffixParts, " ")
+
+	var lastWords, givenWords []string
+
+	switch {
+	case len(parts) == 1:
+		// "First Middle Last" or single word
+		words := strings.Fields(parts[0])
+		var t string
+		t, words = splitNameTitle(words)
+		if t != "" {
+			n.Title = t
+		}
+		var s string
+		s, words = splitNameSuffix(words)
+		if s != "" {
+			n.Suffix = strings.TrimSpace(s + " " + n.Suffix)
+		}
+
+		switch len(words) {
+		case 0:
+			n.Uncertain, n.Reason = true, "name has title only"
+			return n
+		case 1:
+			lastWords = words
+			n.Uncertain, n.Reason = true, "name has a single word, taken as last name"
+		default:
+			// last name starts at its particles
+			i := len(words) - 1
+			for i > 1 && StringInSlice(nameToken(words[i-1]), lastNameParticles) {
+				i--
+			}
+			givenWords, lastWords = words[:i], words[i:]
+			if len(givenWords) > 2 {
+				n.Uncertain, n.Reason = true, "name has many words without comma"
+			}
+		}
+
+	default:
+		lastWords = strings.Fields(parts[0])
+		givenWords = strings.Fields(strings.Join(parts[1:], " "))
+		if len(parts) > 2 {
+			n.Uncertain, n.Reason = true, "name has more than one comma"
+		}
+
+		var s string
+		s, lastWords = splitNameSuffix(lastWords)
+		if s != "" {
+			n.Suffix = strings.TrimSpace(s + " " + n.Suffix)
+		}
+
+		var t string
+		t, givenWords = splitNameTitle(givenWords)
+		if t != "" {
+			n.Title = t
+		}
+		s, givenWords = splitNameSuffix(givenWords)
+		if s != "" {
+			n.Suffix = strings.TrimSpace(n.Suffix + " " + s)
+		}
+
+		if len(lastWords) == 0 {
+			n.Uncertain, n.Reason = true, "name has no last name before comma"
+		} else if len(givenWords) == 0 {
+			n.Uncertain, n.Reason = true, "name has no first name after comma"
+		}
+	}
+
+	n.Last = strings.Join(lastWords, " ")
+	if len(givenWords) > 0 {
+		n.First = givenWords[0]
+		n.Middle = strings.Join(givenWords[1:], " ")
+	}
+
+	return n
+}
+
+// LastNameWithSuffix returns last name followed by suffix as
+// there is no separate field for suffix in people csv
+func (n PersonName) LastNameWithSuffix() string {
+	return strings.TrimSpace(n.Last + " " + n.Suffix)
+}
+
+// GetNameWarning returns row warning for the name which could not be
+// parsed with certainty, blank if it is fine
+func GetNameWarning(name string, n PersonName) string {
+	if !n.Uncertain {
+		return ""
+	}
+	warnPrefix := "W:<" + DBTypeMapStrings[DBPeople] + ">:"
+	return warnPrefix + fmt.Sprintf(
+		"Name \"%s\" may not be parsed correctly (%s), imported as first name \"%s\", middle name \"%s\", last name \"%s\"",
+		strings.TrimSpace(name), n.Reason, n.First, n.Middle, n.LastNameWithSuffix(),
+	)
+}
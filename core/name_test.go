@@ -0,0 +1,63 @@
+package core
+
+import (
+	"testing"
+)
+
+func TestParsePersonName(t *testing.T) {
+	tests := []struct {
+		name      string
+		title     string
+		want      PersonName
+		uncertain bool
+	}{
+		// guest names of roomkey.csv sample are in "Last, First" format
+		{" Dunn, Schiler", "Mr.    ", PersonName{Title: "Mr.", First: "Schiler", Last: "Dunn"}, false},
+		{"Adams, Andrew", "", PersonName{First: "Andrew", Last: "Adams"}, false},
+		{"Adams,  Andrew  J.", "", PersonName{First: "Andrew", Middle: "J.", Last: "Adams"}, false},
+		{"Walker Jr., John", "", PersonName{First: "John", Last: "Walker", Suffix: "Jr."}, false},
+		{"Walker, John, Jr.", "", PersonName{First: "John", Last: "Walker", Suffix: "Jr."}, false},
+		{"Walker, Dr. John III", "Mr.", PersonName{Title: "Dr.", First: "John", Last: "Walker", Suffix: "III"}, false},
+		{"de la Cruz, Maria", "", PersonName{First: "Maria", Last: "de la Cruz"}, false},
+
+		// tenant name of onesite.csv sample
+		{"Housing, Corporate", "", PersonName{First: "Corporate", Last: "Housing"}, false},
+
+		// names without comma
+		{"Andrew Adams", "", PersonName{First: "Andrew", Last: "Adams"}, false},
+		{"Mr. John Q. Walker Sr.", "", PersonName{Title: "Mr.", First: "John", Middle: "Q.", Last: "Walker", Suffix: "Sr."}, false},
+		{"Maria de la Cruz", "", PersonName{First: "Maria", Last: "de la Cruz"}, false},
+		{"Mary Ann Lee Smith", "", PersonName{First: "Mary", Middle: "Ann Lee", Last: "Smith"}, true},
+
+		{"Schiler", "", PersonName{Last: "Schiler"}, true},
+		{"Mr.", "", PersonName{Title: "Mr."}, true},
+		{"", "Mr.", PersonName{Title: "Mr."}, true},
+		{"Adams,", "", PersonName{Last: "Adams"}, true},
+		{", Andrew", "", PersonName{First: "Andrew"}, true},
+		{"Adams, Andrew, Lee", "", PersonName{First: "Andrew", Middle: "Lee", Last: "Adams"}, true},
+	}
+
+	for _, tt := range tests {
+		got := ParsePersonName(tt.name, tt.title)
+		if got.Uncertain != tt.uncertain {
+			t.Errorf("ParsePersonName(%q): uncertain %t (%s), want %t", tt.name, got.Uncertain, got.Reason, tt.uncertain)
+		}
+		got.Uncertain, got.Reason = false, ""
+		if got != tt.want {
+			t.Errorf("ParsePersonName(%q) = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestGetNameWarning(t *testing.T) {
+	if w := GetNameWarning("Adams, Andrew", ParsePersonName("Adams, Andrew", "")); w != "" {
+		t.Errorf("got warning %q for certain name", w)
+	}
+
+	want := "W:<" + DBTypeMapStrings[DBPeople] + ">:" +
+		`Name "Walker Jr." may not be parsed correctly (name has a single word, taken as last name), ` +
+		`imported as first name "", middle name "", last name "Walker Jr."`
+	if w := GetNameWarning(" Walker Jr. ", ParsePersonName(" Walker Jr. ", "")); w != want {
+		t.Errorf("got warning %q, want %q", w, want)
+	}
+}
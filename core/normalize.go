@@ -0,0 +1,345 @@
+package core
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// DefaultCountry is the country of contacts when source has none
+const DefaultCountry = "US"
+
+// NormalizeChange holds a change made to a value of people csv row
+// while normalising it, so that staff can see what has been altered
+type NormalizeChange struct {
+	Field  string
+	From   string
+	To     string
+	Reason string
+}
+
+// String gives the change in the form of a row warning text
+func (c NormalizeChange) String() string {
+	if c.To == c.From {
+		return fmt.Sprintf("%s \"%s\" is kept as it is, %s", c.Field, c.From, c.Reason)
+	}
+	if c.To == "" {
+		return fmt.Sprintf("%s \"%s\" has been removed, %s", c.Field, c.From, c.Reason)
+	}
+	return fmt.Sprintf("%s \"%s\" has been changed to \"%s\", %s", c.Field, c.From, c.To, c.Reason)
+}
+
+// placeholderValues are the values staff put in when they don't know it,
+// compared after lower case and removing special chars
+var placeholderValues = []string{
+	"get", "getatcheckin", "na", "none", "unknown", "tbd", "tba",
+	"test", "xxx", "x", "noemail", "nophone", "null", "0",
+}
+
+// placeholderEmailRe matches emails like none@none.com, noemail@gmail.com
+var placeholderEmailRe = regexp.MustCompile(`^(?:none|noemail|no|na|test|unknown|nomail)@`)
+
+// emailRe validates email address
+var emailRe = regexp.MustCompile(`^[a-z0-9!#$%&'*+/=?^_{|}~\-]+(?:\.[a-z0-9!#$%&'*+/=?^_{|}~\-]+)*@(?:[a-z0-9](?:[a-z0-9\-]*[a-z0-9])?\.)+[a-z]{2,}$`)
+
+// phoneExtRe matches extension at the end of phone
+var phoneExtRe = regexp.MustCompile(`(?i)\s*(?:x|ext\.?|extension)\s*\d+$`)
+
+// nonDigitRe matches everything except digits
+var nonDigitRe = regexp.MustCompile(`\D`)
+
+// caPostalCodeRe matches canadian postal code without space
+var caPostalCodeRe = regexp.MustCompile(`^[A-Z]\d[A-Z]\d[A-Z]\d$`)
+
+// countryCodes maps names of countries found in sources to ISO 3166 alpha-2 code,
+// keys are lower case without special chars
+var countryCodes = map[string]string{
+	"us": "US", "usa": "US", "unitedstates": "US", "unitedstatesofamerica": "US", "america": "US",
+	"ca": "CA", "can": "CA", "canada": "CA",
+	"mx": "MX", "mex": "MX", "mexico": "MX",
+	"gb": "GB", "gbr": "GB", "uk": "GB", "unitedkingdom": "GB", "greatbritain": "GB", "england": "GB",
+	"in": "IN", "ind": "IN", "india": "IN",
+	"de": "DE", "deu": "DE", "germany": "DE",
+	"fr": "FR", "fra": "FR", "france": "FR",
+	"au": "AU", "aus": "AU", "australia": "AU",
+	"cn": "CN", "chn": "CN", "china": "CN",
+	"jp": "JP", "jpn": "JP", "japan": "JP",
+	"ph": "PH", "phl": "PH", "philippines": "PH",
+	"br": "BR", "bra": "BR", "brazil": "BR",
+	"kw": "KW", "kwt": "KW", "kuwait": "KW",
+	"sa": "SA", "sau": "SA", "saudiarabia": "SA",
+}
+
+// countryCallingCodes holds calling code of countries for E.164 phone format
+var countryCallingCodes = map[string]string{
+	"US": "1", "CA": "1", "MX": "52", "GB": "44", "IN": "91", "DE": "49", "FR": "33",
+	"AU": "61", "CN": "86", "JP": "81", "PH": "63", "BR": "55", "KW": "965", "SA": "966",
+}
+
+// usStates maps name of US states to their postal code,
+// keys are lower case without special chars
+var usStates = map[string]string{
+	"alabama": "AL", "alaska": "AK", "arizona": "AZ", "arkansas": "AR", "california": "CA",
+	"colorado": "CO", "connecticut": "CT", "delaware": "DE", "districtofcolumbia": "DC", "florida": "FL",
+	"georgia": "GA", "hawaii": "HI", "idaho": "ID", "illinois": "IL", "indiana": "IN",
+	"iowa": "IA", "kansas": "KS", "kentucky": "KY", "louisiana": "LA", "maine": "ME",
+	"maryland": "MD", "massachusetts": "MA", "michigan": "MI", "minnesota": "MN", "mississippi": "MS",
+	"missouri": "MO", "montana": "MT", "nebraska": "NE", "nevada": "NV", "newhampshire": "NH",
+	"newjersey": "NJ", "newmexico": "NM", "newyork": "NY", "northcarolina": "NC", "northdakota": "ND",
+	"ohio": "OH", "oklahoma": "OK", "oregon": "OR", "pennsylvania": "PA", "rhodeisland": "RI",
+	"southcarolina": "SC", "southdakota": "SD", "tennessee": "TN", "texas": "TX", "utah": "UT",
+	"vermont": "VT", "virginia": "VA", "washington": "WA", "westvirginia": "WV", "wisconsin": "WI",
+	"wyoming": "WY", "puertorico": "PR", "guam": "GU", "virginislands": "VI",
+}
+
+// peopleCSVFieldKinds tells which kind of normalisation is done on people csv field
+var peopleCSVFieldKinds = map[string]string{
+	"PrimaryEmail":              "email",
+	"SecondaryEmail":            "email",
+	"EmergencyEmail":            "email",
+	"EmployerEmail":             "email",
+	"WorkPhone":                 "phone",
+	"CellPhone":                 "phone",
+	"EmergencyContactTelephone": "phone",
+	"EmployerPhone":             "phone",
+	"State":                     "state",
+	"EmployerState":             "state",
+	"PostalCode":                "postalcode",
+	"EmployerPostalCode":        "postalcode",
+	"Country":                   "country",
+	"Address":                   "text",
+	"Address2":                  "text",
+	"City":                      "text",
+	"AlternateAddress":          "text",
+	"EmergencyContactName":      "text",
+	"EmergencyContactAddress":   "text",
+	"EmployerStreetAddress":     "text",
+	"EmployerCity":              "text",
+}
+
+// IsPlaceholderValue checks value is a placeholder like "get at check in"
+// or a phone number of same digits like "9999999999"
+func IsPlaceholderValue(value string) bool {
+	v := strings.ToLower(SpecialCharsReplacer.Replace(value))
+	if v == "" {
+		return false
+	}
+	if StringInSlice(v, placeholderValues) {
+		return true
+	}
+
+	// same digit repeated
+	if len(v) >= 7 && strings.Trim(v, v[:1]) == "" && strings.Trim(v, "0123456789") == "" {
+		return true
+	}
+	return false
+}
+
+// NormalizeCountry returns ISO 3166 alpha-2 code of country,
+// value is returned as it is if country is not known
+func NormalizeCountry(value string) string {
+	if code, ok := countryCodes[strings.ToLower(SpecialCharsReplacer.Replace(value))]; ok {
+		return code
+	}
+	return strings.TrimSpace(value)
+}
+
+// NormalizeEmail returns lower case email, ok is false
+// if email is not valid
+func NormalizeEmail(value string) (string, bool) {
+	email := strings.ToLower(strings.TrimSpace(value))
+	email = strings.TrimPrefix(email, "mailto:")
+	if !emailRe.MatchString(email) || strings.Contains(email, "..") {
+		return email, false
+	}
+	return email, true
+}
+
+// NormalizePhone returns phone in E.164 format, calling code of country is
+// used if phone has none. ok is false if phone can't be formatted.
+func NormalizePhone(value string, country string) (string, bool) {
+	phone := strings.TrimSpace(value)
+
+	// drop extension
+	if i := phoneExtRe.FindStringIndex(phone); i != nil {
+		phone = phone[:i[0]]
+	}
+
+	international := strings.HasPrefix(phone, "+") || strings.HasPrefix(phone, "00")
+	digits := nonDigitRe.ReplaceAllString(phone, "")
+	if strings.HasPrefix(phone, "00") {
+		digits = strings.TrimPrefix(digits, "00")
+	}
+
+	if international {
+		if len(digits) < 8 || len(digits) > 15 {
+			return value, false
+		}
+		return "+" + digits, true
+	}
+
+	callingCode, ok := countryCallingCodes[NormalizeCountry(country)]
+	if !ok {
+		return value, false
+	}
+
+	// north american numbers have 10 digits
+	if callingCode == "1" {
+		if len(digits) == 11 && strings.HasPrefix(digits, "1") {
+			digits = digits[1:]
+		}
+		if len(digits) != 10 {
+			return value, false
+		}
+		return "+1" + digits, true
+	}
+
+	digits = strings.TrimPrefix(digits, "0")
+	if len(digits) < 6 || len(callingCode+digits) > 15 {
+		return value, false
+	}
+	return "+" + callingCode + digits, true
+}
+
+// NormalizeState returns postal code of US state, value is
+// returned as it is for other countries or unknown states
+func NormalizeState(value string, country string) string {
+	state := strings.TrimSpace(value)
+	if NormalizeCountry(country) != "US" {
+		return state
+	}
+
+	key := strings.ToLower(SpecialCharsReplacer.Replace(state))
+	if code, ok := usStates[key]; ok {
+		return code
+	}
+	if len(key) == 2 {
+		return strings.ToUpper(key)
+	}
+	return state
+}
+
+// NormalizePostalCode returns postal code in the format of country,
+// like 12345 or 12345-6789 for US and A1A 1A1 for Canada
+func NormalizePostalCode(value string, country string) string {
+	code := strings.TrimSpace(value)
+
+	switch NormalizeCountry(country) {
+	case "US":
+		digits := nonDigitRe.ReplaceAllString(code, "")
+		switch len(digits) {
+		case 4, 8:
+			// leading zero lost by spreadsheets
+			digits = "0" + digits
+		}
+		switch len(digits) {
+		case 5:
+			return digits
+		case 9:
+			return digits[:5] + "-" + digits[5:]
+		}
+	case "CA":
+		c := strings.ToUpper(strings.Replace(code, " ", "", -1))
+		if caPostalCodeRe.MatchString(c) {
+			return c[:3] + " " + c[3:]
+		}
+	}
+	return code
+}
+
+// NormalizePeopleCSVRow normalises contact values of people csv row in place,
+// it returns the changes made so importer can report them as warnings.
+// defaultCountry is used when the row has no country.
+func NormalizePeopleCSVRow(row []string, defaultCountry string) []NormalizeChange {
+	changes := []NormalizeChange{}
+
+	fields, _ := GetStructFields(&PeopleCSV{})
+	index := map[string]int{}
+	for i, field := range fields {
+		if i < len(row) {
+			index[field] = i
+		}
+	}
+
+	if defaultCountry == "" {
+		defaultCountry = DefaultCountry
+	}
+	country := defaultCountry
+	if i, ok := index["Country"]; ok && strings.TrimSpace(row[i]) != "" {
+		country = row[i]
+	}
+
+	// go in order of struct so that warnings are in same order every time
+	for i, field := range fields {
+		kind, ok := peopleCSVFieldKinds[field]
+		if !ok || i >= len(row) {
+			continue
+		}
+
+		from := row[i]
+		value := strings.TrimSpace(from)
+		if value == "" {
+			continue
+		}
+
+		change := NormalizeChange{Field: field, From: value}
+
+		// placeholders are only put in for contacts, "0" or "x" can be part
+		// of an address or name of a city
+		isContact := kind == "email" || kind == "phone"
+		if isContact && (IsPlaceholderValue(value) || (kind == "email" && placeholderEmailRe.MatchString(strings.ToLower(value)))) {
+			row[i] = ""
+			change.Reason = "it is a placeholder value"
+			changes = append(changes, change)
+			continue
+		}
+
+		switch kind {
+		case "email":
+			email, ok := NormalizeEmail(value)
+			if !ok {
+				row[i] = ""
+				change.Reason = "it is not a valid email"
+				changes = append(changes, change)
+				continue
+			}
+			row[i], change.Reason = email, "formatted as email"
+		case "phone":
+			phone, ok := NormalizePhone(value, country)
+			if !ok {
+				row[i], change.To = value, value
+				change.Reason = "it is not a valid phone number"
+				changes = append(changes, change)
+				continue
+			}
+			row[i], change.Reason = phone, "formatted in E.164 format"
+		case "state":
+			row[i], change.Reason = NormalizeState(value, country), "standardised as state code"
+		case "postalcode":
+			row[i], change.Reason = NormalizePostalCode(value, country), "standardised as postal code"
+		case "country":
+			row[i], change.Reason = NormalizeCountry(value), "standardised as country code"
+		default:
+			row[i] = value
+		}
+
+		// whitespace is trimmed silently
+		if row[i] != value {
+			change.To = row[i]
+			changes = append(changes, change)
+		}
+	}
+
+	return changes
+}
+
+// GetNormalizeWarnings returns row warnings of the changes
+// made while normalising people csv row
+func GetNormalizeWarnings(changes []NormalizeChange) []string {
+	warnings := []string{}
+	warnPrefix := "W:<" + DBTypeMapStrings[DBPeople] + ">:"
+	for _, change := range changes {
+		warnings = append(warnings, warnPrefix+change.String())
+	}
+	return warnings
+}
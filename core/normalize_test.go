@@ -0,0 +1,166 @@
+package core
+
+import (
+	"testing"
+)
+
+func TestNormalizePhone(t *testing.T) {
+	// values are taken from guest.csv and roomkey.csv samples
+	tests := []struct {
+		value   string
+		country string
+		want    string
+		ok      bool
+	}{
+		{"9105457681               ", "US", "+19105457681", true},
+		{"347-482-5871             ", "US", "+13474825871", true},
+		{"631-9742789", "US", "+16319742789", true},
+		{"405-721-2194", "", "405-721-2194", false},
+		{"(405) 721-2194 ext. 12", "USA", "+14057212194", true},
+		{"1-405-721-2194", "United States", "+14057212194", true},
+		{"+965 2245 6789", "US", "+96522456789", true},
+		{"0044 20 7946 0958", "", "+442079460958", true},
+		{"020 7946 0958", "UK", "+442079460958", true},
+		{"721-2194", "US", "721-2194", false},
+		{"12345", "+", "12345", false},
+		{"4057212194", "Atlantis", "4057212194", false},
+	}
+
+	for _, tt := range tests {
+		got, ok := NormalizePhone(tt.value, tt.country)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("NormalizePhone(%q, %q) = %q, %t, want %q, %t", tt.value, tt.country, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestNormalizeEmail(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+		ok    bool
+	}{
+		{"welledunn79@gmail.com", "welledunn79@gmail.com", true},
+		{" Mike.Arnold7@Gmail.com ", "mike.arnold7@gmail.com", true},
+		{"mailto:nick.burgeson@faa.gov", "nick.burgeson@faa.gov", true},
+		{"get@c/in", "get@c/in", false},
+		{"get@ checkin", "get@ checkin", false},
+		{"does not have one", "does not have one", false},
+		{"john..walker@avedaenergy.com", "john..walker@avedaenergy.com", false},
+		{"john.walker@avedaenergy", "john.walker@avedaenergy", false},
+	}
+
+	for _, tt := range tests {
+		got, ok := NormalizeEmail(tt.value)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("NormalizeEmail(%q) = %q, %t, want %q, %t", tt.value, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+// getPeopleCSVRow returns people csv row with values of fields
+func getPeopleCSVRow(values map[string]string) ([]string, map[string]int) {
+	fields, _ := GetStructFields(&PeopleCSV{})
+	index := map[string]int{}
+	row := make([]string, len(fields))
+	for i, field := range fields {
+		index[field] = i
+		row[i] = values[field]
+	}
+	return row, index
+}
+
+func TestNormalizePeopleCSVRow(t *testing.T) {
+	tests := []struct {
+		name    string
+		values  map[string]string
+		want    map[string]string
+		changes int
+	}{
+		{
+			name: "formatted",
+			values: map[string]string{
+				"PrimaryEmail": "Welledunn79@gmail.com", "CellPhone": "9105457681               ",
+				"State": "Tennessee", "PostalCode": "37146", "Country": "USA",
+			},
+			want: map[string]string{
+				"PrimaryEmail": "welledunn79@gmail.com", "CellPhone": "+19105457681",
+				"State": "TN", "PostalCode": "37146", "Country": "US",
+			},
+			changes: 4,
+		},
+		{
+			name: "placeholders",
+			values: map[string]string{
+				"PrimaryEmail": "get at check in", "CellPhone": "9999999999", "Address": "get at check in",
+			},
+			want: map[string]string{
+				"PrimaryEmail": "", "CellPhone": "", "Address": "get at check in",
+			},
+			changes: 2,
+		},
+		{
+			name:    "placeholder email",
+			values:  map[string]string{"PrimaryEmail": "none@none.com", "Address": "209", "City": "x"},
+			want:    map[string]string{"PrimaryEmail": "", "Address": "209", "City": "x"},
+			changes: 1,
+		},
+		{
+			name:    "invalid contacts",
+			values:  map[string]string{"PrimaryEmail": "get@c/in", "WorkPhone": "721-2194"},
+			want:    map[string]string{"PrimaryEmail": "", "WorkPhone": "721-2194"},
+			changes: 2,
+		},
+		{
+			name:    "canadian postal code",
+			values:  map[string]string{"PostalCode": "k1a0b1", "State": "Ontario", "Country": "Canada"},
+			want:    map[string]string{"PostalCode": "K1A 0B1", "State": "Ontario", "Country": "CA"},
+			changes: 2,
+		},
+		{
+			name:    "whitespace only",
+			values:  map[string]string{"City": " Oklahoma City ", "PostalCode": "73132"},
+			want:    map[string]string{"City": "Oklahoma City", "PostalCode": "73132"},
+			changes: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		row, index := getPeopleCSVRow(tt.values)
+		changes := NormalizePeopleCSVRow(row, "")
+		for field, value := range tt.want {
+			if row[index[field]] != value {
+				t.Errorf("%s: %s = %q, want %q", tt.name, field, row[index[field]], value)
+			}
+		}
+		if len(changes) != tt.changes {
+			t.Errorf("%s: changes %v, want %d", tt.name, changes, tt.changes)
+		}
+	}
+}
+
+func TestNormalizeChangeString(t *testing.T) {
+	tests := []struct {
+		change NormalizeChange
+		want   string
+	}{
+		{
+			NormalizeChange{"CellPhone", "347-482-5871", "+13474825871", "formatted in E.164 format"},
+			`CellPhone "347-482-5871" has been changed to "+13474825871", formatted in E.164 format`,
+		},
+		{
+			NormalizeChange{"PrimaryEmail", "get", "", "it is a placeholder value"},
+			`PrimaryEmail "get" has been removed, it is a placeholder value`,
+		},
+		{
+			NormalizeChange{"WorkPhone", "721-2194", "721-2194", "it is not a valid phone number"},
+			`WorkPhone "721-2194" is kept as it is, it is not a valid phone number`,
+		},
+	}
+
+	for _, tt := range tests {
+		if got := tt.change.String(); got != tt.want {
+			t.Errorf("got %q, want %q", got, tt.want)
+		}
+	}
+}
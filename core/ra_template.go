@@ -0,0 +1,185 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"gotable"
+	"regexp"
+	"rentroll/rlib"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// RATemplateRule names the rentroll rental agreement template of agreements
+// it matches. Patterns are regular expressions, blank criteria match
+// any agreement and zero term days leave the term unbounded.
+type RATemplateRule struct {
+	Template     string
+	Unit         string // pattern of unit designation, room of roomkey
+	FloorPlan    string // pattern of floor plan, room type of roomkey
+	RateName     string // pattern of rate name, roomkey only
+	Status       string // pattern of unit status, report type of roomkey
+	MinTermDays  int
+	MaxTermDays  int
+	CompanyPayor *bool // nil matches any payor
+
+	unitRe, floorPlanRe, rateNameRe, statusRe *regexp.Regexp
+}
+
+// RATemplateAgreement holds what template rules match on of an agreement
+type RATemplateAgreement struct {
+	Unit         string
+	FloorPlan    string
+	RateName     string
+	Status       string
+	TermDays     int // -1 if term is not known
+	CompanyPayor bool
+}
+
+// RATemplateChoice holds template chosen for agreement of a line,
+// rule is the position of rule in profile, 0 if none matched
+type RATemplateChoice struct {
+	Unit     string
+	Payor    string
+	Template string
+	Rule     int
+}
+
+// compilePattern compiles pattern of rule, blank pattern gives nil
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	return regexp.Compile(pattern)
+}
+
+// compile compiles patterns of rule
+func (r *RATemplateRule) compile() error {
+	var err error
+	if r.Template == "" {
+		return errors.New("template is blank")
+	}
+	if r.unitRe, err = compilePattern(r.Unit); err != nil {
+		return err
+	}
+	if r.floorPlanRe, err = compilePattern(r.FloorPlan); err != nil {
+		return err
+	}
+	if r.rateNameRe, err = compilePattern(r.RateName); err != nil {
+		return err
+	}
+	r.statusRe, err = compilePattern(r.Status)
+	return err
+}
+
+// CompileRATemplateRules compiles patterns of rules so they are ready to use
+func CompileRATemplateRules(rules []RATemplateRule) error {
+	for i := range rules {
+		if err := rules[i].compile(); err != nil {
+			return fmt.Errorf("rental agreement template rule %d: %s", i+1, err.Error())
+		}
+	}
+	return nil
+}
+
+// matchPattern tells whether value matches compiled pattern, nil matches all
+func matchPattern(re *regexp.Regexp, value string) bool {
+	return re == nil || re.MatchString(value)
+}
+
+// matches tells whether all criteria of rule match the agreement
+func (r *RATemplateRule) matches(a RATemplateAgreement) bool {
+	if !matchPattern(r.unitRe, a.Unit) || !matchPattern(r.floorPlanRe, a.FloorPlan) ||
+		!matchPattern(r.rateNameRe, a.RateName) || !matchPattern(r.statusRe, a.Status) {
+		return false
+	}
+	if r.CompanyPayor != nil && *r.CompanyPayor != a.CompanyPayor {
+		return false
+	}
+
+	// rule with term bounds can't match agreement of unknown term
+	if r.MinTermDays > 0 || r.MaxTermDays > 0 {
+		if a.TermDays < 0 {
+			return false
+		}
+		if r.MinTermDays > 0 && a.TermDays < r.MinTermDays {
+			return false
+		}
+		if r.MaxTermDays > 0 && a.TermDays > r.MaxTermDays {
+			return false
+		}
+	}
+	return true
+}
+
+// ChooseRATemplate returns template of the first rule which matches the
+// agreement with position of that rule, blank template if none matches
+func ChooseRATemplate(rules []RATemplateRule, a RATemplateAgreement) (string, int) {
+	for i := range rules {
+		if rules[i].matches(a) {
+			return rules[i].Template, i + 1
+		}
+	}
+	return "", 0
+}
+
+// GetTermDays returns days between start and end, -1 if any is not known
+func GetTermDays(start, end time.Time) int {
+	if start.IsZero() || end.IsZero() || end.Before(start) {
+		return -1
+	}
+	return int(end.Sub(start).Hours() / 24)
+}
+
+// GetLeaseTermDays returns days between start and end dates of source
+func GetLeaseTermDays(start, end string) int {
+	s, err := time.Parse("2006-01-02", normalizeMatchDate(start))
+	if err != nil {
+		return -1
+	}
+	e, err := time.Parse("2006-01-02", normalizeMatchDate(end))
+	if err != nil {
+		return -1
+	}
+	return GetTermDays(s, e)
+}
+
+// GetRATemplateReport returns template chosen for each agreement by line
+func GetRATemplateReport(choices map[int]RATemplateChoice) string {
+	var tbl gotable.Table
+	tbl.Init()
+	tbl.SetTitle("RENTAL AGREEMENT TEMPLATES")
+
+	tbl.AddColumn("Input Line", 6, gotable.CELLSTRING, gotable.COLJUSTIFYLEFT)
+	tbl.AddColumn("Unit Name", 20, gotable.CELLSTRING, gotable.COLJUSTIFYLEFT)
+	tbl.AddColumn("Payor", 30, gotable.CELLSTRING, gotable.COLJUSTIFYLEFT)
+	tbl.AddColumn("Template", 30, gotable.CELLSTRING, gotable.COLJUSTIFYLEFT)
+	tbl.AddColumn("Rule", 6, gotable.CELLSTRING, gotable.COLJUSTIFYLEFT)
+
+	lines := []int{}
+	for line := range choices {
+		lines = append(lines, line)
+	}
+	sort.Ints(lines)
+
+	for _, line := range lines {
+		c := choices[line]
+		template, rule := c.Template, strconv.Itoa(c.Rule)
+		if c.Rule == 0 {
+			template, rule = "(none)", ""
+		}
+		tbl.AddRow()
+		tbl.Puts(-1, 0, strconv.Itoa(line))
+		tbl.Puts(-1, 1, c.Unit)
+		tbl.Puts(-1, 2, c.Payor)
+		tbl.Puts(-1, 3, template)
+		tbl.Puts(-1, 4, rule)
+	}
+
+	s, err := tbl.SprintTable()
+	if err != nil {
+		rlib.Ulog("GetRATemplateReport: error = %s", err.Error())
+	}
+	return s
+}
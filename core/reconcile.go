@@ -0,0 +1,341 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"gotable"
+	"math"
+	"rentroll/rlib"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ReconcileAmounts holds money of a unit which is reconciled
+type ReconcileAmounts struct {
+	MarketRent       float64
+	ContractRent     float64
+	RecurringCharges float64
+}
+
+// Add adds amounts to a
+func (a *ReconcileAmounts) Add(b ReconcileAmounts) {
+	a.MarketRent += b.MarketRent
+	a.ContractRent += b.ContractRent
+	a.RecurringCharges += b.RecurringCharges
+}
+
+// ReconcileUnit holds amounts of unit in source and dates on which
+// records of rentroll are compared with them
+type ReconcileUnit struct {
+	Unit   string
+	From   string // 2006-01-02
+	To     string
+	Source ReconcileAmounts
+	dated  bool // dates have been set from source
+}
+
+// Reconciliation holds amounts of source report which are compared with
+// rentroll. Market rent and recurring charges are compared only if
+// source has them, charges also only if business has recurring
+// assessments. Total of amounts not compared is shown for source only.
+type Reconciliation struct {
+	AsOf             string // date of units which are not in source
+	Units            map[string]*ReconcileUnit
+	MarketRent       bool
+	RecurringCharges bool
+
+	// SourceTotals holds totals printed by source report, nil if it has none
+	SourceTotals *ReconcileAmounts
+}
+
+// NewReconciliation returns empty reconciliation as of date
+func NewReconciliation(asOf time.Time) *Reconciliation {
+	return &Reconciliation{
+		AsOf:  asOf.Format("2006-01-02"),
+		Units: map[string]*ReconcileUnit{},
+	}
+}
+
+// GetUnit returns unit, it is added if it is not there
+func (r *Reconciliation) GetUnit(unit string) *ReconcileUnit {
+	u, ok := r.Units[unit]
+	if !ok {
+		u = &ReconcileUnit{Unit: unit, From: r.AsOf, To: r.AsOf}
+		r.Units[unit] = u
+	}
+	return u
+}
+
+// SetDate widens dates of unit so that the date is in them
+func (u *ReconcileUnit) SetDate(d string) {
+	d = normalizeMatchDate(d)
+	if len(d) != len("2006-01-02") {
+		return
+	}
+	if !u.dated || d < u.From {
+		u.From = d
+	}
+	if !u.dated || d > u.To {
+		u.To = d
+	}
+	u.dated = true
+}
+
+// ParseAmount returns amount of report cell, group separators are
+// removed and blank cell is zero
+func ParseAmount(s string) (float64, error) {
+	s = strings.TrimSpace(DgtGrpSepToDgts(s))
+	if s == "" {
+		return 0, nil
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+// datedAmount holds amount of rentroll record with its dates
+type datedAmount struct {
+	Amount float64
+	Start  string
+	Stop   string
+}
+
+// loadDatedAmounts returns dated amounts by name of rentable
+func loadDatedAmounts(ctx context.Context, q string, BID int64) (map[string][]datedAmount, error) {
+	amounts := map[string][]datedAmount{}
+	rows, err := rlib.RRdb.Dbrr.QueryContext(ctx, q, BID)
+	if err != nil {
+		return amounts, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		var start, stop sql.NullString
+		var a datedAmount
+		if err = rows.Scan(&name, &a.Amount, &start, &stop); err != nil {
+			return amounts, err
+		}
+		a.Start, a.Stop = start.String, stop.String
+		amounts[name] = append(amounts[name], a)
+	}
+	return amounts, rows.Err()
+}
+
+// sumDatedAmounts sums amounts which are in effect in the dates
+func sumDatedAmounts(amounts []datedAmount, from, to string) float64 {
+	sum := 0.0
+	for _, a := range amounts {
+		if a.Start <= to && a.Stop > from {
+			sum += a.Amount
+		}
+	}
+	return sum
+}
+
+// latestDatedAmount returns latest amount which starts by the date
+func latestDatedAmount(amounts []datedAmount, to string) float64 {
+	latest := datedAmount{}
+	for _, a := range amounts {
+		if a.Start <= to && a.Stop > to && a.Start >= latest.Start {
+			latest = a
+		}
+	}
+	return latest.Amount
+}
+
+// loadRentrollAmounts returns amounts rentroll holds for units of
+// business on the dates of each unit, it checks business has any
+// recurring assessments as importers don't write them
+func loadRentrollAmounts(ctx context.Context, BID int64, r *Reconciliation) (map[string]*ReconcileAmounts, bool, error) {
+	amounts := map[string]*ReconcileAmounts{}
+
+	// market rate of rentable type of rentable, dates are where both apply
+	marketRates, err := loadDatedAmounts(ctx,
+		`SELECT Rentable.RentableName, RentableMarketRate.MarketRate,
+		DATE_FORMAT(GREATEST(RentableTypeRef.DtStart, RentableMarketRate.DtStart), '%Y-%m-%d'),
+		DATE_FORMAT(LEAST(RentableTypeRef.DtStop, RentableMarketRate.DtStop), '%Y-%m-%d')
+		FROM Rentable
+		JOIN RentableTypeRef ON RentableTypeRef.RID = Rentable.RID
+		JOIN RentableMarketRate ON RentableMarketRate.RTID = RentableTypeRef.RTID
+		WHERE Rentable.BID = ?`, BID)
+	if err != nil {
+		return amounts, false, err
+	}
+
+	contractRents, err := loadDatedAmounts(ctx,
+		`SELECT Rentable.RentableName, RentalAgreementRentables.ContractRent,
+		DATE_FORMAT(RentalAgreementRentables.RARDtStart, '%Y-%m-%d'),
+		DATE_FORMAT(RentalAgreementRentables.RARDtStop, '%Y-%m-%d')
+		FROM RentalAgreementRentables
+		JOIN Rentable ON Rentable.RID = RentalAgreementRentables.RID
+		WHERE RentalAgreementRentables.BID = ?`, BID)
+	if err != nil {
+		return amounts, false, err
+	}
+
+	// recurring assessments, instances of them have parent set
+	charges, err := loadDatedAmounts(ctx,
+		`SELECT Rentable.RentableName, Assessments.Amount,
+		DATE_FORMAT(Assessments.Start, '%Y-%m-%d'),
+		DATE_FORMAT(Assessments.Stop, '%Y-%m-%d')
+		FROM Assessments
+		JOIN Rentable ON Rentable.RID = Assessments.RID
+		WHERE Assessments.BID = ? AND Assessments.RentCycle > 0 AND Assessments.PASMID = 0`, BID)
+	if err != nil {
+		return amounts, false, err
+	}
+
+	rows, err := rlib.RRdb.Dbrr.QueryContext(ctx, "SELECT RentableName FROM Rentable WHERE BID=?", BID)
+	if err != nil {
+		return amounts, false, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			return amounts, false, err
+		}
+		from, to := r.AsOf, r.AsOf
+		if u, ok := r.Units[name]; ok {
+			from, to = u.From, u.To
+		}
+		amounts[name] = &ReconcileAmounts{
+			MarketRent:       latestDatedAmount(marketRates[name], to),
+			ContractRent:     sumDatedAmounts(contractRents[name], from, to),
+			RecurringCharges: sumDatedAmounts(charges[name], from, to),
+		}
+	}
+	return amounts, len(charges) > 0, rows.Err()
+}
+
+// isVariance checks amounts differ by a cent or more
+func isVariance(a, b float64) bool {
+	return math.Abs(a-b) >= 0.005
+}
+
+// formatAmount returns amount for report, n/a if amount is not compared
+func formatAmount(amount float64, compared bool) string {
+	if !compared {
+		return "n/a"
+	}
+	return strconv.FormatFloat(amount, 'f', 2, 64)
+}
+
+// GetReconcileReport compares amounts of source with amounts rentroll holds
+// for business and returns report of totals and units with variance
+func GetReconcileReport(ctx context.Context, business *rlib.Business, csvFile string, r *Reconciliation) string {
+	rentroll, hasCharges, err := loadRentrollAmounts(ctx, business.BID, r)
+	if err != nil {
+		rlib.Ulog("INTERNAL ERROR <RECONCILE>: %s\n", err.Error())
+		return "Unable to read amounts of business " + business.Designation + " for reconciliation\n"
+	}
+
+	// units of both source and rentroll
+	units := []string{}
+	for unit := range r.Units {
+		units = append(units, unit)
+	}
+	for unit := range rentroll {
+		if _, ok := r.Units[unit]; !ok {
+			units = append(units, unit)
+		}
+	}
+	sort.Strings(units)
+
+	// business without recurring assessments has no charges to compare
+	compareCharges := r.RecurringCharges && hasCharges
+
+	sourceTotal, rentrollTotal := ReconcileAmounts{}, ReconcileAmounts{}
+	variances := []string{}
+	for _, unit := range units {
+		source, current := ReconcileAmounts{}, ReconcileAmounts{}
+		if u, ok := r.Units[unit]; ok {
+			source = u.Source
+		}
+		if a, ok := rentroll[unit]; ok {
+			current = *a
+		}
+		sourceTotal.Add(source)
+		rentrollTotal.Add(current)
+
+		if (r.MarketRent && isVariance(source.MarketRent, current.MarketRent)) ||
+			isVariance(source.ContractRent, current.ContractRent) ||
+			(compareCharges && isVariance(source.RecurringCharges, current.RecurringCharges)) {
+			variances = append(variances, unit)
+		}
+	}
+
+	var tbl gotable.Table
+	tbl.Init()
+	tbl.SetTitle("Reconciliation Report")
+
+	section1 := "Date: " + time.Now().Format("1/2/2006") + "\n"
+	section1 += "Business: " + business.Designation + "\n"
+	section1 += "Source File: " + csvFile + "\n"
+	section1 += "As of: " + r.AsOf + "\n"
+	tbl.SetSection1(section1)
+
+	reported := ReconcileAmounts{}
+	if r.SourceTotals != nil {
+		reported = *r.SourceTotals
+	}
+	section2 := "Totals\n"
+	for _, item := range []struct {
+		name             string
+		source, rentroll float64
+		reported         float64
+		compared         bool
+	}{
+		{"Market Rent", sourceTotal.MarketRent, rentrollTotal.MarketRent, reported.MarketRent, r.MarketRent},
+		{"Contract Rent", sourceTotal.ContractRent, rentrollTotal.ContractRent, reported.ContractRent, true},
+		{"Recurring Charges", sourceTotal.RecurringCharges, rentrollTotal.RecurringCharges, reported.RecurringCharges, compareCharges},
+	} {
+		if !item.compared {
+			if isVariance(item.source, 0) {
+				section2 += fmt.Sprintf("    %-18s source %s, not compared\n", item.name+":", formatAmount(item.source, true))
+			}
+			continue
+		}
+		line := fmt.Sprintf("    %-18s source %s, rentroll %s, variance %s", item.name+":",
+			formatAmount(item.source, true), formatAmount(item.rentroll, true), formatAmount(item.rentroll-item.source, true))
+		if r.SourceTotals != nil && isVariance(item.reported, item.source) {
+			line += fmt.Sprintf(" (report totals %s)", formatAmount(item.reported, true))
+		}
+		section2 += line + "\n"
+	}
+	section2 += fmt.Sprintf("\n%d unit(s) with variance", len(variances))
+	tbl.SetSection2(section2)
+
+	tbl.AddColumn("Unit", 20, gotable.CELLSTRING, gotable.COLJUSTIFYLEFT)
+	tbl.AddColumn("Market Rent", 12, gotable.CELLSTRING, gotable.COLJUSTIFYRIGHT)
+	tbl.AddColumn("RR Market Rent", 12, gotable.CELLSTRING, gotable.COLJUSTIFYRIGHT)
+	tbl.AddColumn("Contract Rent", 12, gotable.CELLSTRING, gotable.COLJUSTIFYRIGHT)
+	tbl.AddColumn("RR Contract Rent", 12, gotable.CELLSTRING, gotable.COLJUSTIFYRIGHT)
+	tbl.AddColumn("Charges", 12, gotable.CELLSTRING, gotable.COLJUSTIFYRIGHT)
+	tbl.AddColumn("RR Charges", 12, gotable.CELLSTRING, gotable.COLJUSTIFYRIGHT)
+
+	for _, unit := range variances {
+		source, current := ReconcileAmounts{}, ReconcileAmounts{}
+		if u, ok := r.Units[unit]; ok {
+			source = u.Source
+		}
+		if a, ok := rentroll[unit]; ok {
+			current = *a
+		}
+		tbl.AddRow()
+		tbl.Puts(-1, 0, unit)
+		tbl.Puts(-1, 1, formatAmount(source.MarketRent, r.MarketRent))
+		tbl.Puts(-1, 2, formatAmount(current.MarketRent, r.MarketRent))
+		tbl.Puts(-1, 3, formatAmount(source.ContractRent, true))
+		tbl.Puts(-1, 4, formatAmount(current.ContractRent, true))
+		tbl.Puts(-1, 5, formatAmount(source.RecurringCharges, compareCharges))
+		tbl.Puts(-1, 6, formatAmount(current.RecurringCharges, compareCharges))
+	}
+
+	s, err := tbl.SprintTable()
+	if err != nil {
+		rlib.Ulog("GetReconcileReport: error = %s", err.Error())
+	}
+	return s
+}
@@ -0,0 +1,235 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// layouts of source dates which are tried if transform doesn't give any
+var transformDateLayouts = []string{
+	"01/02/2006", "1/2/2006", "1/2/06", "2006-01-02", "01-02-2006", "2-Jan-2006", "02-Jan-06",
+}
+
+// csv types of which rows are made from source rows, transforms apply to them
+var transformCSVTypes = []string{"RentableTypeCSV", "PeopleCSV", "RentableCSV", "RentalAgreementCSV"}
+
+// characters removed from source numbers before they are parsed
+var transformNumberReplacer = strings.NewReplacer(",", "", "$", "", " ", "")
+
+// FieldTransform tells how the value of a rentroll field is made from source
+// row. Value is taken from constant, columns or column, then steps are done
+// in the order of fields below. Fallbacks are tried in order while value is
+// blank. Date and number which can't be parsed are kept as they are, so
+// that rentroll reports them.
+type FieldTransform struct {
+	Constant  *string  // value which doesn't come from source
+	Columns   []string // headers of columns joined by separator, blanks are left out
+	Separator string
+	Column    string // header of column
+
+	Extract     string // regular expression, first group is taken if it has any
+	Split       string // separator by which value is split
+	Take        int    // part taken after split, negative counts from end
+	Trim        bool
+	Lookup      map[string]string // value is replaced if it is found in table
+	DateLayouts []string          // layouts of source date
+	DateFormat  string            // layout to which date is reformatted
+	Number      bool              // parse number, group separators and currency sign are removed
+
+	Fallback []*FieldTransform
+
+	extractRe *regexp.Regexp
+}
+
+// FieldTransforms holds transforms of a csv type by field name
+type FieldTransforms map[string]*FieldTransform
+
+// compile compiles pattern of transform and its fallbacks
+func (t *FieldTransform) compile() error {
+	if t.Constant == nil && t.Column == "" && len(t.Columns) == 0 && len(t.Fallback) == 0 {
+		return errors.New("no constant, column or fallback")
+	}
+
+	var err error
+	if t.Extract != "" {
+		if t.extractRe, err = regexp.Compile(t.Extract); err != nil {
+			return err
+		}
+	}
+	for i, f := range t.Fallback {
+		if f == nil {
+			return fmt.Errorf("fallback %d is empty", i+1)
+		}
+		if err = f.compile(); err != nil {
+			return fmt.Errorf("fallback %d: %s", i+1, err.Error())
+		}
+	}
+	return nil
+}
+
+// getTransformCell returns value of column in row, blank if row doesn't have it
+func getTransformCell(row []string, csvHeaderMap map[string]CSVHeader, name string) string {
+	header, ok := csvHeaderMap[name]
+	if !ok || header.Index < 0 || header.Index >= len(row) {
+		return ""
+	}
+	return row[header.Index]
+}
+
+// source returns value from which transform starts
+func (t *FieldTransform) source(row []string, csvHeaderMap map[string]CSVHeader) string {
+	if t.Constant != nil {
+		return *t.Constant
+	}
+	if len(t.Columns) > 0 {
+		values := []string{}
+		for _, name := range t.Columns {
+			if value := strings.TrimSpace(getTransformCell(row, csvHeaderMap, name)); value != "" {
+				values = append(values, value)
+			}
+		}
+		return strings.Join(values, t.Separator)
+	}
+	return getTransformCell(row, csvHeaderMap, t.Column)
+}
+
+// extract returns first group of match in value, whole match if pattern
+// has no group, blank if it doesn't match
+func (t *FieldTransform) extract(value string) string {
+	m := t.extractRe.FindStringSubmatch(value)
+	switch {
+	case m == nil:
+		return ""
+	case len(m) > 1:
+		return m[1]
+	default:
+		return m[0]
+	}
+}
+
+// take returns part of split value, blank if there is no such part
+func (t *FieldTransform) take(value string) string {
+	parts := strings.Split(value, t.Split)
+	i := t.Take
+	if i < 0 {
+		i += len(parts)
+	}
+	if i < 0 || i >= len(parts) {
+		return ""
+	}
+	return parts[i]
+}
+
+// reformatDate returns date in format of transform
+func (t *FieldTransform) reformatDate(value string) string {
+	layouts := t.DateLayouts
+	if len(layouts) == 0 {
+		layouts = transformDateLayouts
+	}
+	for _, layout := range layouts {
+		if d, err := time.Parse(layout, strings.TrimSpace(value)); err == nil {
+			return d.Format(t.DateFormat)
+		}
+	}
+	return value
+}
+
+// parseNumber returns number without group separators and currency sign
+func parseNumber(value string) string {
+	s := transformNumberReplacer.Replace(value)
+	if strings.HasPrefix(s, "(") && strings.HasSuffix(s, ")") {
+		s = "-" + s[1:len(s)-1]
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return value
+	}
+	return strconv.FormatFloat(n, 'f', -1, 64)
+}
+
+// Value returns value of field made by transform from source row
+func (t *FieldTransform) Value(row []string, csvHeaderMap map[string]CSVHeader) string {
+	value := t.source(row, csvHeaderMap)
+	if value != "" && t.extractRe != nil {
+		value = t.extract(value)
+	}
+	if value != "" && t.Split != "" {
+		value = t.take(value)
+	}
+	if t.Trim {
+		value = strings.TrimSpace(value)
+	}
+	if lookup, ok := t.Lookup[value]; ok {
+		value = lookup
+	}
+	if value != "" && t.DateFormat != "" {
+		value = t.reformatDate(value)
+	}
+	if value != "" && t.Number {
+		value = parseNumber(value)
+	}
+
+	for _, f := range t.Fallback {
+		if strings.TrimSpace(value) != "" {
+			break
+		}
+		value = f.Value(row, csvHeaderMap)
+	}
+	return value
+}
+
+// Apply sets values of fields of csv struct type which have transforms,
+// data map holds values by the position of fields. It is called after
+// importer has made the values, so transform overrides value which
+// importer makes itself, e.g. split name, specs of agreement or market
+// rate without group separators. Blank value of transform keeps the
+// value of importer, so that default values like start date are kept.
+func (ft FieldTransforms) Apply(
+	structType reflect.Type,
+	dataMap map[int]string,
+	row []string,
+	csvHeaderMap map[string]CSVHeader,
+) {
+	if len(ft) == 0 {
+		return
+	}
+	for i := 0; i < structType.NumField(); i++ {
+		t, ok := ft[structType.Field(i).Name]
+		if !ok {
+			continue
+		}
+		if value := t.Value(row, csvHeaderMap); strings.TrimSpace(value) != "" {
+			dataMap[i] = value
+		}
+	}
+}
+
+// compileTransforms checks that transforms are of known csv types
+// and fields, and compiles them
+func (csvFieldMap *CSVFieldMap) compileTransforms() error {
+	fieldMapType := reflect.TypeOf(*csvFieldMap)
+
+	for csvType, transforms := range csvFieldMap.Transforms {
+		if !StringInSlice(csvType, transformCSVTypes) {
+			return fmt.Errorf("transforms of unknown csv type %q", csvType)
+		}
+		structField, _ := fieldMapType.FieldByName(csvType)
+		for field, t := range transforms {
+			if _, ok := structField.Type.FieldByName(field); !ok {
+				return fmt.Errorf("transform of unknown field %s.%s", csvType, field)
+			}
+			if t == nil {
+				return fmt.Errorf("transform of %s.%s is empty", csvType, field)
+			}
+			if err := t.compile(); err != nil {
+				return fmt.Errorf("transform of %s.%s: %s", csvType, field, err.Error())
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package core
+
+import (
+	"rentroll/rlib"
+	"strings"
+	"testing"
+)
+
+// sample files of onesite importer
+const (
+	sampleOneSiteCSV        = "../csvfiles_temp/onesite.csv"
+	sampleOneSiteHeaderJSON = "../admin/onesite/header.json"
+	sampleOneSiteMapperJSON = "../admin/onesite/mapper.json"
+)
+
+// loadSampleOneSiteRows returns data rows of onesite.csv sample
+// with its header map
+func loadSampleOneSiteRows(t *testing.T) ([][]string, map[string]CSVHeader) {
+	headerList, err := GetCSVHeaders(sampleOneSiteHeaderJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := rlib.LoadCSV(sampleOneSiteCSV)
+
+	// header row starts with "Bldg/Unit"
+	for rowIndex, row := range rows {
+		if len(row) == 0 || row[0] != "Bldg/Unit" {
+			continue
+		}
+		csvHeaderMap := map[string]CSVHeader{}
+		for _, header := range headerList {
+			for colIndex, cell := range row {
+				if header.HeaderText == strings.ToLower(SpecialCharsReplacer.Replace(cell)) {
+					header.Index = colIndex
+				}
+			}
+			csvHeaderMap[header.Name] = header
+		}
+		return rows[rowIndex+1:], csvHeaderMap
+	}
+
+	t.Fatalf("header row is not found in %s", sampleOneSiteCSV)
+	return nil, nil
+}
+
+// strPtr returns pointer of string for constant of transform
+func strPtr(s string) *string {
+	return &s
+}
+
+func TestFieldTransformValue(t *testing.T) {
+	rows, csvHeaderMap := loadSampleOneSiteRows(t)
+
+	// 6301-001, A1-Corp, "Crossland Heavy Contractors, *", moved in 11/10/2017
+	row := rows[0]
+	constant := "Corporate"
+	noEmail := "noemail@isolabella.com"
+
+	tests := []struct {
+		name      string
+		transform FieldTransform
+		row       []string
+		want      string
+	}{
+		{"constant", FieldTransform{Constant: &constant}, row, "Corporate"},
+		{"column", FieldTransform{Column: "FloorPlan"}, row, "A1-Corp"},
+		{"unknown column", FieldTransform{Column: "Fax"}, row, ""},
+		{"columns", FieldTransform{Columns: []string{"Unit", "Email", "FloorPlan"}, Separator: " / "}, row, "6301-001 / A1-Corp"},
+		{"extract group", FieldTransform{Column: "Unit", Extract: `^(\d+)-`}, row, "6301"},
+		{"extract match", FieldTransform{Column: "Unit", Extract: `\d{3}$`}, row, "001"},
+		{"extract no match", FieldTransform{Column: "FloorPlan", Extract: `^B\d`}, row, ""},
+		{"split", FieldTransform{Column: "Name", Split: ",", Take: 0}, row, "Crossland Heavy Contractors"},
+		{"split from end", FieldTransform{Column: "Name", Split: ",", Take: -1, Trim: true}, row, "*"},
+		{"split out of range", FieldTransform{Column: "Name", Split: ",", Take: 2}, row, ""},
+		{"lookup", FieldTransform{Column: "UnitLeaseStatus", Lookup: map[string]string{"Occupied": "1", "Vacant": "2"}}, row, "1"},
+		{"lookup of blank", FieldTransform{Column: "MoveOut", Lookup: map[string]string{"": "12/31/9999"}}, row, "12/31/9999"},
+		{"lookup miss", FieldTransform{Column: "FloorPlan", Lookup: map[string]string{"A1": "1 BDR"}}, row, "A1-Corp"},
+		{"date", FieldTransform{Column: "MoveIn", DateFormat: "2006-01-02"}, row, "2017-11-10"},
+		{"date of layout", FieldTransform{Column: "MoveIn", DateLayouts: []string{"1/2/06"}, DateFormat: "2006-01-02"}, []string{"", "", "", "", "", "", "11/10/17"}, "2017-11-10"},
+		{"invalid date", FieldTransform{Column: "FloorPlan", DateFormat: "2006-01-02"}, row, "A1-Corp"},
+		{"number", FieldTransform{Column: "MarketAddl", Number: true}, row, "700"},
+		{"number with separators", FieldTransform{Constant: strPtr("$1,234.50"), Number: true}, row, "1234.5"},
+		{"negative number", FieldTransform{Constant: strPtr("($700.00)"), Number: true}, row, "-700"},
+		{"invalid number", FieldTransform{Column: "UnitDesignation", Number: true}, row, "N/A"},
+		{"fallback", FieldTransform{Column: "Email", Fallback: []*FieldTransform{{Column: "PhoneNumber"}, {Constant: &noEmail}}}, row, noEmail},
+		{"no fallback", FieldTransform{Column: "Unit", Fallback: []*FieldTransform{{Constant: &noEmail}}}, row, "6301-001"},
+		{"fallback after extract", FieldTransform{Column: "Name", Extract: `\((.+)\)`, Fallback: []*FieldTransform{{Column: "Name", Split: ",", Take: 0}}}, row, "Crossland Heavy Contractors"},
+	}
+
+	for _, tt := range tests {
+		transform := tt.transform
+		if err := transform.compile(); err != nil {
+			t.Errorf("%s: %s", tt.name, err.Error())
+			continue
+		}
+		if got := transform.Value(tt.row, csvHeaderMap); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFieldTransformCompile(t *testing.T) {
+	tests := []struct {
+		name      string
+		transform FieldTransform
+		err       string
+	}{
+		{"no source", FieldTransform{Trim: true}, "no constant, column or fallback"},
+		{"invalid pattern", FieldTransform{Column: "Unit", Extract: `(\d+`}, "missing closing )"},
+		{"empty fallback", FieldTransform{Column: "Unit", Fallback: []*FieldTransform{nil}}, "fallback 1 is empty"},
+		{"invalid fallback", FieldTransform{Column: "Unit", Fallback: []*FieldTransform{{Column: "Name"}, {}}}, "fallback 2: no constant"},
+	}
+
+	for _, tt := range tests {
+		err := tt.transform.compile()
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: got error %v, want %q", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestOneSiteMarketRateTransform(t *testing.T) {
+	var csvFieldMap CSVFieldMap
+	if err := GetFieldMapping(&csvFieldMap, sampleOneSiteMapperJSON); err != nil {
+		t.Fatal(err)
+	}
+	transform, ok := csvFieldMap.Transforms["RentableTypeCSV"]["MarketRate"]
+	if !ok {
+		t.Fatalf("%s has no transform of market rate", sampleOneSiteMapperJSON)
+	}
+
+	rows, csvHeaderMap := loadSampleOneSiteRows(t)
+	index := csvHeaderMap["MarketAddl"].Index
+
+	// market rate of sample is exported without separators,
+	// other exports of onesite carry them
+	formatted := append([]string{}, rows[0]...)
+	formatted[index] = "$1,950.00"
+
+	tests := []struct {
+		name string
+		row  []string
+		want string
+	}{
+		{"sample", rows[0], "700"},
+		{"formatted", formatted, "1950"},
+	}
+
+	for _, tt := range tests {
+		if got := transform.Value(tt.row, csvHeaderMap); got != tt.want {
+			t.Errorf("%s: market rate of %q = %q, want %q", tt.name, tt.row[index], got, tt.want)
+		}
+	}
+}
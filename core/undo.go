@@ -0,0 +1,271 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"rentroll/rlib"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ImportStatusUndone is the status of import which has been undone
+const ImportStatusUndone = "undone"
+
+// undoDeleteStep deletes records of a table which refer to
+// created records of a data type, custom attribute references
+// also need the type of element they refer to
+type undoDeleteStep struct {
+	Table       string
+	Column      string
+	ElementType int64
+	DataType    int
+}
+
+// undoDeleteSteps are in dependency order, records which refer to
+// others are deleted first
+var undoDeleteSteps = []undoDeleteStep{
+	// rental agreements
+	{Table: "RentalAgreementRentables", Column: "RAID", DataType: DBRentalAgreement},
+	{Table: "RentalAgreementPayors", Column: "RAID", DataType: DBRentalAgreement},
+	{Table: "RentalAgreementPets", Column: "RAID", DataType: DBRentalAgreement},
+	{Table: "RentalAgreement", Column: "RAID", DataType: DBRentalAgreement},
+	// rentables
+	{Table: "CustomAttrRef", Column: "ID", ElementType: rlib.ELEMRENTABLE, DataType: DBRentable},
+	{Table: "RentableUsers", Column: "RID", DataType: DBRentable},
+	{Table: "RentableTypeRef", Column: "RID", DataType: DBRentable},
+	{Table: "RentableStatus", Column: "RID", DataType: DBRentable},
+	{Table: "Rentable", Column: "RID", DataType: DBRentable},
+	// people
+	{Table: "CustomAttrRef", Column: "ID", ElementType: rlib.ELEMPERSON, DataType: DBPeople},
+	{Table: "Vehicle", Column: "VID", DataType: DBVehicle},
+	{Table: "Payor", Column: "TCID", DataType: DBPeople},
+	{Table: "Prospect", Column: "TCID", DataType: DBPeople},
+	{Table: "User", Column: "TCID", DataType: DBPeople},
+	{Table: "Transactant", Column: "TCID", DataType: DBPeople},
+	// custom attributes
+	{Table: "CustomAttrRef", Column: "CID", DataType: DBCustomAttr},
+	{Table: "CustomAttr", Column: "CID", DataType: DBCustomAttr},
+	// rentable types
+	{Table: "CustomAttrRef", Column: "ID", ElementType: rlib.ELEMRENTABLETYPE, DataType: DBRentableType},
+	{Table: "RentableMarketRate", Column: "RTID", DataType: DBRentableType},
+	{Table: "RentableTypes", Column: "RTID", DataType: DBRentableType},
+}
+
+// undoDependencyCheck finds later activity which refers to created records
+type undoDependencyCheck struct {
+	Name     string // what depends on the records
+	Query    string // selects id of dependent record and id it refers, IN list is appended
+	DataType int
+}
+
+// undoDependencyChecks are run before undo, importers don't create
+// any of these so all of them come from later activity
+var undoDependencyChecks = []undoDependencyCheck{
+	{Name: "Assessment", Query: "SELECT ASMID, RAID FROM Assessments WHERE BID=? AND RAID IN", DataType: DBRentalAgreement},
+	{Name: "Assessment", Query: "SELECT ASMID, RID FROM Assessments WHERE BID=? AND RID IN", DataType: DBRentable},
+	{Name: "Receipt", Query: "SELECT RCPTID, TCID FROM Receipt WHERE BID=? AND TCID IN", DataType: DBPeople},
+	{Name: "Receipt Allocation", Query: "SELECT RCPAID, RAID FROM ReceiptAllocation WHERE BID=? AND RAID IN", DataType: DBRentalAgreement},
+	{Name: "Journal", Query: "SELECT DISTINCT Journal.JID, JournalAllocation.RAID FROM Journal JOIN JournalAllocation ON JournalAllocation.JID=Journal.JID WHERE Journal.BID=? AND JournalAllocation.RAID IN", DataType: DBRentalAgreement},
+	{Name: "Journal Allocation", Query: "SELECT JAID, RAID FROM JournalAllocation WHERE BID=? AND RAID IN", DataType: DBRentalAgreement},
+	{Name: "Journal Allocation", Query: "SELECT JAID, RID FROM JournalAllocation WHERE BID=? AND RID IN", DataType: DBRentable},
+	{Name: "Journal Allocation", Query: "SELECT JAID, TCID FROM JournalAllocation WHERE BID=? AND TCID IN", DataType: DBPeople},
+	{Name: "Ledger Entry", Query: "SELECT LEID, RAID FROM LedgerEntry WHERE BID=? AND RAID IN", DataType: DBRentalAgreement},
+	{Name: "Ledger Entry", Query: "SELECT LEID, RID FROM LedgerEntry WHERE BID=? AND RID IN", DataType: DBRentable},
+	{Name: "Ledger Entry", Query: "SELECT LEID, TCID FROM LedgerEntry WHERE BID=? AND TCID IN", DataType: DBPeople},
+}
+
+// getInPlaceholders returns "(?,?,?)" with args for ids
+func getInPlaceholders(ids []int64) (string, []interface{}) {
+	marks := make([]string, len(ids))
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		marks[i] = "?"
+		args[i] = id
+	}
+	return "(" + strings.Join(marks, ",") + ")", args
+}
+
+// findUndoDependencies returns the records of later activity
+// which depend on records created by import
+func findUndoDependencies(ctx context.Context, r ImportRecord) ([]string, error) {
+	dependencies := []string{}
+
+	for _, check := range undoDependencyChecks {
+		ids := r.Created[DBTypeMap[check.DataType]]
+		if len(ids) == 0 {
+			continue
+		}
+
+		in, args := getInPlaceholders(ids)
+		rows, err := rlib.RRdb.Dbrr.QueryContext(ctx, check.Query+" "+in, append([]interface{}{r.BID}, args...)...)
+		if err != nil {
+			return dependencies, err
+		}
+		for rows.Next() {
+			var id, refID int64
+			if err = rows.Scan(&id, &refID); err != nil {
+				rows.Close()
+				return dependencies, err
+			}
+			dependencies = append(dependencies, fmt.Sprintf("%s %d refers to %s %d",
+				check.Name, id, DBTypeMap[check.DataType], refID))
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return dependencies, err
+		}
+	}
+	return dependencies, nil
+}
+
+// deleteImportedRecords reverts changes and deletes records created by import
+// in one transaction, it returns count of deleted rows for each table
+func deleteImportedRecords(ctx context.Context, r ImportRecord) ([]string, error) {
+	deleted := []string{}
+
+	tx, err := rlib.RRdb.Dbrr.BeginTx(ctx, nil)
+	if err != nil {
+		return deleted, err
+	}
+
+	// changes in records which existed before import are reverted first
+	n, err := revertRecordChanges(ctx, tx, r.BID, r.Changes)
+	if err != nil {
+		tx.Rollback()
+		return deleted, err
+	}
+	if n > 0 {
+		deleted = append(deleted, "Reverted changes: "+strconv.Itoa(n))
+	}
+
+	for _, step := range undoDeleteSteps {
+		ids := r.Created[DBTypeMap[step.DataType]]
+		if len(ids) == 0 {
+			continue
+		}
+
+		in, args := getInPlaceholders(ids)
+		q := "DELETE FROM " + step.Table + " WHERE BID=? AND "
+		qArgs := []interface{}{r.BID}
+		if step.ElementType > 0 {
+			q += "ElementType=? AND "
+			qArgs = append(qArgs, step.ElementType)
+		}
+		q += step.Column + " IN " + in
+
+		var res sql.Result
+		res, err = tx.ExecContext(ctx, q, append(qArgs, args...)...)
+		if err != nil {
+			tx.Rollback()
+			return deleted, fmt.Errorf("Unable to delete from %s: %s", step.Table, err.Error())
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			deleted = append(deleted, step.Table+": "+strconv.FormatInt(n, 10))
+		}
+	}
+
+	return deleted, tx.Commit()
+}
+
+// getLaterImport returns id of import of same business made after
+// import r which has not been undone
+func getLaterImport(r ImportRecord) (string, error) {
+	records, err := ListImportRecords()
+	if err != nil {
+		return "", err
+	}
+	for _, l := range records {
+		if l.BUD == r.BUD && l.Start.After(r.Start) && l.BID > 0 && l.Status != ImportStatusUndone {
+			return l.ImportID, nil
+		}
+	}
+	return "", nil
+}
+
+// UndoImport removes the records created by import in dependency order. It refuses
+// when later activity depends on those records or business has been imported
+// again, the report tells why. Undo of reload import leaves business empty
+// as records which it had before import are gone.
+func UndoImport(ctx context.Context, importID string) (string, error) {
+	report := "Undo of import " + importID + "\n\n"
+
+	r, err := GetImportRecord(importID)
+	if err != nil {
+		return report, err
+	}
+	if r.Status == ImportStatusUndone {
+		return report, fmt.Errorf("Import %s has been undone already", importID)
+	}
+	if r.BID == 0 || (len(r.Created) == 0 && len(r.Changes) == 0) {
+		return report, fmt.Errorf("Import %s has not created any records", importID)
+	}
+
+	// no import should run on business meanwhile
+	importLock, err := AcquireImportLock(r.BUD)
+	if err != nil {
+		return report, err
+	}
+	defer importLock.Release()
+
+	// every import creates business again, records of this import
+	// are gone if business has been imported after it
+	business, err := rlib.GetBusinessByDesignation(ctx, r.BUD)
+	if err != nil {
+		return report, err
+	}
+	if business.BID != r.BID {
+		return report, fmt.Errorf("Business %s has been imported again after import %s, its records do not exist anymore", r.BUD, importID)
+	}
+
+	// delta import keeps business, changes of later import
+	// may depend on records of this one
+	later, err := getLaterImport(r)
+	if err != nil {
+		return report, err
+	}
+	if later != "" {
+		return report, fmt.Errorf("Business %s has been imported by %s after import %s, undo that import first", r.BUD, later, importID)
+	}
+
+	dependencies, err := findUndoDependencies(ctx, r)
+	if err != nil {
+		return report, err
+	}
+	if len(dependencies) > 0 {
+		report += "Later activity depends on records of this import:\n"
+		for _, d := range dependencies {
+			report += "  " + d + "\n"
+		}
+		return report, fmt.Errorf("Import %s can not be undone, remove the activity above first", importID)
+	}
+
+	deleted, err := deleteImportedRecords(ctx, r)
+	if err != nil {
+		return report, err
+	}
+
+	report += "Deleted records:\n"
+	for _, d := range deleted {
+		report += "  " + d + "\n"
+	}
+	// reload deleted the business before it loaded the records,
+	// records which business had before can't be restored
+	if r.Mode == ImportModeDelta {
+		report += fmt.Sprintf("\nBusiness %s is kept without the imported records.\n", r.BUD)
+	} else {
+		report += fmt.Sprintf("\nImport %s deleted business %s and loaded it again, records which business had before it can not be restored.\n", importID, r.BUD)
+		report += fmt.Sprintf("Business %s is empty now, import a file in it again.\n", r.BUD)
+	}
+
+	r.Status = ImportStatusUndone
+	r.UndoneAt = time.Now()
+	r.UndoneBy = currentOperator()
+	if err = r.Save(); err != nil {
+		rlib.Ulog("UndoImport: error = %s\n", err.Error())
+	}
+
+	return report, nil
+}
@@ -5,7 +5,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
-	"regexp"
 	"rentroll/rlib"
 	"strconv"
 	"strings"
@@ -20,7 +19,10 @@ func GetFieldMapping(csvFieldMap *CSVFieldMap, mapperFilePath string) error {
 		return err
 	}
 	err = json.Unmarshal(fieldmap, csvFieldMap)
-	return err
+	if err != nil {
+		return err
+	}
+	return csvFieldMap.compileTransforms()
 }
 
 // ValidateUserSuppliedValues validates all user supplied values
@@ -114,60 +116,53 @@ func IntegerInSlice(a int, list []int) bool {
 
 // IsValidEmail used to check valid email or not
 func IsValidEmail(email string) bool {
-	// TODO: confirm which regex to use
-	// Re := regexp.MustCompile(`^[a-z0-9._%+\-]+@[a-z0-9.\-]+\.[a-z]{2,4}$`)
-	Re := regexp.MustCompile(`^[a-zA-Z0-9._%+\-]+@[a-zA-Z0-9.\-]+$`)
-	return Re.MatchString(email)
+	_, ok := NormalizeEmail(email)
+	return ok
+}
+
+// getBusinessCount returns count of records of data type in business
+func getBusinessCount(ctx context.Context, dbType int, BID int64) (int, error) {
+	switch dbType {
+	case DBCustomAttrRef:
+		return rlib.GetCountBusinessCustomAttrRefs(ctx, BID)
+	case DBCustomAttr:
+		return rlib.GetCountBusinessCustomAttributes(ctx, BID)
+	case DBRentableType:
+		return rlib.GetCountBusinessRentableTypes(ctx, BID)
+	case DBPeople:
+		return rlib.GetCountBusinessTransactants(ctx, BID)
+	case DBRentable:
+		return rlib.GetCountBusinessRentables(ctx, BID)
+	case DBRentalAgreement:
+		return rlib.GetCountBusinessRentalAgreements(ctx, BID)
+	}
+	return 0, nil
+}
+
+// GetExistingCount get map of summaryCount as an argument
+// then it hit db to get count of records which exist in business
+// before import for each type, kept as "existing"
+func GetExistingCount(ctx context.Context, summaryCount map[int]map[string]int, BID int64) error {
+	for dbType := range summaryCount {
+		n, err := getBusinessCount(ctx, dbType, BID)
+		if err != nil {
+			return err
+		}
+		summaryCount[dbType]["existing"] = n
+	}
+	return nil
 }
 
 // GetImportedCount get map of summaryCount as an argument
-// then it hit db to get imported count for each type
+// then it hit db to get imported count for each type,
+// records which existed before import are not counted
 func GetImportedCount(ctx context.Context, summaryCount map[int]map[string]int, BID int64) error {
 	for dbType := range summaryCount {
-		switch dbType {
-		case DBCustomAttrRef:
-			n, err := rlib.GetCountBusinessCustomAttrRefs(ctx, BID)
-			if err != nil {
-				return err
-			}
-			summaryCount[DBCustomAttrRef]["imported"] += n
-			break
-		case DBCustomAttr:
-			n, err := rlib.GetCountBusinessCustomAttributes(ctx, BID)
-			if err != nil {
-				return err
-			}
-			summaryCount[DBCustomAttr]["imported"] += n
-			break
-		case DBRentableType:
-			n, err := rlib.GetCountBusinessRentableTypes(ctx, BID)
-			if err != nil {
-				return err
-			}
-			summaryCount[DBRentableType]["imported"] += n
-			break
-		case DBPeople:
-			n, err := rlib.GetCountBusinessTransactants(ctx, BID)
-			if err != nil {
-				return err
-			}
-			summaryCount[DBPeople]["imported"] += n
-			break
-		case DBRentable:
-			n, err := rlib.GetCountBusinessRentables(ctx, BID)
-			if err != nil {
-				return err
-			}
-			summaryCount[DBRentable]["imported"] += n
-			break
-		case DBRentalAgreement:
-			n, err := rlib.GetCountBusinessRentalAgreements(ctx, BID)
-			if err != nil {
-				return err
-			}
-			summaryCount[DBRentalAgreement]["imported"] += n
-			break
+		n, err := getBusinessCount(ctx, dbType, BID)
+		if err != nil {
+			return err
 		}
+		summaryCount[dbType]["imported"] = n - summaryCount[dbType]["existing"]
 	}
 	return nil
 }
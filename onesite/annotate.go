@@ -0,0 +1,74 @@
+package onesite
+
+import (
+	"fmt"
+	"importers/core"
+	"rentroll/rlib"
+)
+
+// addOneSiteRowNotes notes the parts of row which are not imported as they
+// are, notes are kept by line like csv errors
+func addOneSiteRowNotes(
+	rowNotes map[int][]core.RowNote,
+	rowIndex int,
+	traceUnitMap map[int]string,
+	unitLeaseStatus string,
+	csvTypesSet []int,
+	delta *oneSiteDelta,
+) {
+	line := rowIndex + 1
+	unit := traceUnitMap[rowIndex]
+
+	// unit is imported once, rows after the first one only add people
+	firstIndex := rowIndex
+	for index, u := range traceUnitMap {
+		if u == unit && index < firstIndex {
+			firstIndex = index
+		}
+	}
+	if firstIndex != rowIndex {
+		rowNotes[line] = append(rowNotes[line], core.RowNote{Status: core.RowStatusMerged,
+			Reason: fmt.Sprintf("unit %s is imported from line %d", unit, firstIndex+1)})
+	}
+
+	if !core.IntegerInSlice(core.PEOPLECSV, csvTypesSet) {
+		rowNotes[line] = append(rowNotes[line], core.RowNote{Status: core.RowStatusSkipped,
+			Reason: fmt.Sprintf("unit status \"%s\" is not occupied, people and rental agreement are not created", unitLeaseStatus)})
+		return
+	}
+
+	if delta != nil && !delta.canLoadRow(rowIndex, core.PEOPLECSV, unit) && !delta.canLoadRow(rowIndex, core.RENTALAGREEMENTCSV, unit) {
+		rowNotes[line] = append(rowNotes[line], core.RowNote{Status: core.RowStatusSkipped,
+			Reason: "person and rental agreement are in business already, changes since last import are applied to them"})
+	}
+}
+
+// writeAnnotatedCSV writes copy of csv with status and issues of rows if
+// path of it is given, it returns the line which tells where it is
+func writeAnnotatedCSV(
+	annotatedCSV string,
+	csvFile string,
+	unitMap map[int]string,
+	csvErrors map[int][]string,
+	rowNotes map[int][]core.RowNote,
+) string {
+	if annotatedCSV == "" {
+		return ""
+	}
+
+	// header line of csv is the last one skipped before data
+	headerLines := []int{}
+	if _, skipRowsCount, _, _, err := readOneSiteCSV(csvFile); err == nil {
+		headerLines = append(headerLines, skipRowsCount)
+	}
+	dataLines := []int{}
+	for rowIndex := range unitMap {
+		dataLines = append(dataLines, rowIndex+1)
+	}
+
+	if err := core.WriteAnnotatedCSV(annotatedCSV, csvFile, headerLines, dataLines, csvErrors, rowNotes); err != nil {
+		rlib.Ulog("Error <ANNOTATED CSV>: %s\n", err.Error())
+		return "\nUnable to write annotated CSV " + annotatedCSV + ": " + err.Error() + "\n"
+	}
+	return "\nAnnotated CSV: " + annotatedCSV + "\n"
+}
@@ -5,18 +5,8 @@ import (
 	"importers/core"
 	"os"
 	"path"
-	"rentroll/rlib"
 )
 
-// =========
-// value type
-// =========
-// 0 - string, a collection of characters
-// 1 - 64-bit integer
-// 2 - 64-bit unsigned integer
-// 3 - 64-bit floating point
-// 4 - Date
-
 // customAttributeMap holds the fields which needs to be extracted from onesite csv
 // and for each field, need to create rows with multiple values.
 // Key of this map should match exactly the column of onesite csv's custom attribute
@@ -25,6 +15,16 @@ var customAttributeMap = map[string]map[string]string{
 	"SQFT": {"Name": "Square Feet", "ValueType": "1", "Units": "sqft"},
 }
 
+// getCustomAttributeValue returns custom attribute of config with value
+func getCustomAttributeValue(customAttributeConfig map[string]string, value string) core.CustomAttributeValue {
+	return core.CustomAttributeValue{
+		Name:      customAttributeConfig["Name"],
+		ValueType: customAttributeConfig["ValueType"],
+		Value:     value,
+		Units:     customAttributeConfig["Units"],
+	}
+}
+
 // CreateCustomAttibutesCSV create rentabletype csv temporarily
 // write headers, used to load data from onesite csv
 // return file pointer to call program
@@ -34,36 +34,11 @@ func CreateCustomAttibutesCSV(
 	customAttributeStruct *core.CustomAttributeCSV,
 ) (*os.File, *csv.Writer, bool) {
 
-	var done = false
-
 	// get path of custom attribute csv file
 	filePrefix := prefixCSVFile["custom_attribute"]
 	fileName := filePrefix + timestamp + ".csv"
-	customAttributeCSVFilePath := path.Join(CSVStore, fileName)
-
-	// try to create file and return with error if occurs any
-	customAttributeCSVFile, err := os.Create(customAttributeCSVFilePath)
-	if err != nil {
-		rlib.Ulog("Error <CUSTOM ATTRIBUTES CSV>: %s\n", err.Error())
-		return nil, nil, done
-	}
 
-	// create csv writer
-	customAttributeCSVWriter := csv.NewWriter(customAttributeCSVFile)
-
-	// parse headers of customAttributeCSV using reflect
-	customAttributeCSVHeaders, ok := core.GetStructFields(customAttributeStruct)
-	if !ok {
-		rlib.Ulog("Error <CUSTOM ATTRIBUTES CSV>: Unable to get struct fields for customAttributeCSV\n")
-		return nil, nil, done
-	}
-
-	customAttributeCSVWriter.Write(customAttributeCSVHeaders)
-	customAttributeCSVWriter.Flush()
-
-	done = true
-
-	return customAttributeCSVFile, customAttributeCSVWriter, done
+	return core.CreateCustomAttributesCSV(path.Join(CSVStore, fileName), customAttributeStruct)
 }
 
 // WriteCustomAttributeData used to read the data for CustomAttribute csv file
@@ -91,15 +66,8 @@ func ReadCustomAttributeCSVData(
 		}
 		avoidData[customAttributeField] = append(avoidData[customAttributeField], value)
 
-		// csv row csvRowData used to write data it holds
-		csvRowData := []string{}
-		csvRowData = append(csvRowData, suppliedValues["BUD"])
-		csvRowData = append(csvRowData, customAttributeConfig["Name"])
-		csvRowData = append(csvRowData, customAttributeConfig["ValueType"])
-		csvRowData = append(csvRowData, value)
-		csvRowData = append(csvRowData, customAttributeConfig["Units"])
-
-		*customAttributeCSVData = append(*customAttributeCSVData, csvRowData)
+		ca := getCustomAttributeValue(customAttributeConfig, value)
+		*customAttributeCSVData = append(*customAttributeCSVData, core.GetCustomAttributeCSVRow(suppliedValues["BUD"], ca))
 
 		*recordCount = *recordCount + 1
 
@@ -0,0 +1,382 @@
+package onesite
+
+import (
+	"context"
+	"fmt"
+	"importers/core"
+	"math"
+	"rentroll/rlib"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// deltaDateLayout is the format of normalised lease dates in state
+const deltaDateLayout = "2006-01-02"
+
+// oneSiteDelta holds what a snapshot changes in business which has been
+// imported before. Rows which add units, people or agreements are loaded
+// through csv as usual, the rest is changed in place as dated changes.
+type oneSiteDelta struct {
+	current  *core.BusinessState
+	incoming *core.BusinessState
+	newUnits map[string]bool // units which are not in business yet
+	moveIns  map[int]bool    // rows of people who move in
+	renewals map[int]int64   // rows of people whose agreement is renewed, with TCID
+	rowUnits map[int]string  // unit of rows of move-ins and renewals
+
+	// Changes holds changes of snapshot for report
+	Changes []core.UnitChange
+
+	// RecordChanges holds dated changes made in existing records
+	RecordChanges []core.RecordChange
+}
+
+// isOneSiteRenewal checks lease of unit rolls forward
+func isOneSiteRenewal(current, incoming *core.UnitState) bool {
+	// normalised dates compare as strings
+	if len(current.LeaseEnd) != len(deltaDateLayout) || len(incoming.LeaseEnd) != len(deltaDateLayout) {
+		return false
+	}
+	return incoming.LeaseStart != current.LeaseStart && incoming.LeaseEnd > current.LeaseEnd
+}
+
+// getOneSiteDelta compares snapshot with business and finds
+// which rows need to be loaded
+func getOneSiteDelta(
+	ctx context.Context,
+	BID int64,
+	t [][]string,
+	skipRowsCount int,
+	csvHeaderList []core.CSVHeader,
+	csvHeaderMap map[string]core.CSVHeader,
+) (*oneSiteDelta, error) {
+
+	current, err := core.LoadBusinessState(ctx, BID)
+	if err != nil {
+		return nil, err
+	}
+	return newOneSiteDelta(current, t, skipRowsCount, csvHeaderList, csvHeaderMap), nil
+}
+
+// newOneSiteDelta compares snapshot with current state of business,
+// rows of people who move in or renew are found by name or lease of unit
+func newOneSiteDelta(
+	current *core.BusinessState,
+	t [][]string,
+	skipRowsCount int,
+	csvHeaderList []core.CSVHeader,
+	csvHeaderMap map[string]core.CSVHeader,
+) *oneSiteDelta {
+
+	d := &oneSiteDelta{
+		current:  current,
+		newUnits: map[string]bool{},
+		moveIns:  map[int]bool{},
+		renewals: map[int]int64{},
+		rowUnits: map[int]string{},
+	}
+	d.incoming = getOneSiteState(t, skipRowsCount, csvHeaderList, csvHeaderMap)
+	d.Changes = core.DiffBusinessStates(d.current, d.incoming)
+
+	for rowIndex := skipRowsCount; rowIndex < len(t); rowIndex++ {
+		if isOneSiteBlankRow(t[rowIndex], csvHeaderList) {
+			break
+		}
+
+		unitName := getOneSiteCell(t[rowIndex], csvHeaderMap, "Unit")
+		if unitName == "" {
+			continue
+		}
+
+		current, found := d.current.Units[unitName]
+		if !found {
+			d.newUnits[unitName] = true
+		}
+
+		// only people of occupied units have agreements
+		incoming := d.incoming.Units[unitName]
+		if incoming.Status != core.UnitOccupied {
+			continue
+		}
+
+		// person is matched by name or by lease of unit
+		personName := core.ParsePersonName(getOneSiteCell(t[rowIndex], csvHeaderMap, "Name"), "")
+		tenant, ok := core.TenantState{}, false
+		if found {
+			var currentKey string
+			currentKey, ok = core.MatchTenants(current, incoming)[core.GetTenantKey(personName.First, personName.Last)]
+			tenant = current.Tenants[currentKey]
+		}
+
+		switch {
+		case !ok:
+			d.moveIns[rowIndex] = true
+			d.rowUnits[rowIndex] = unitName
+		case isOneSiteRenewal(current, incoming):
+			d.renewals[rowIndex] = tenant.TCID
+			d.rowUnits[rowIndex] = unitName
+		}
+	}
+
+	return d
+}
+
+// canLoadRow checks data of row for csv type has to be loaded,
+// records of business which have not changed are not loaded again
+func (d *oneSiteDelta) canLoadRow(rowIndex int, csvType int, unit string) bool {
+	switch csvType {
+	case core.RENTABLECSV:
+		return d.newUnits[unit]
+	case core.PEOPLECSV:
+		return d.moveIns[rowIndex]
+	case core.RENTALAGREEMENTCSV:
+		_, renewed := d.renewals[rowIndex]
+		return d.moveIns[rowIndex] || renewed
+	}
+	// rentable types and custom attributes which exist are skipped by rcsv
+	return true
+}
+
+// setRenewalTCIDs sets TCID of people with renewed agreement in
+// trace map, new agreement is written for them with same person
+func (d *oneSiteDelta) setRenewalTCIDs(traceTCIDMap map[int]string) {
+	for rowIndex, tcid := range d.renewals {
+		traceTCIDMap[rowIndex] = tcidPrefix + strconv.FormatInt(tcid, 10)
+	}
+}
+
+// getStopDate returns date on which agreements of unit are stopped,
+// new lease starts that day or it is the import date
+func getStopDate(current, incoming *core.UnitState, importDate time.Time) time.Time {
+	stop := importDate
+	if incoming != nil && incoming.Status == core.UnitOccupied {
+		if start, err := time.Parse(deltaDateLayout, incoming.LeaseStart); err == nil {
+			stop = start
+		}
+	}
+	// agreement can't end before it starts
+	if start, err := time.Parse(deltaDateLayout, current.LeaseStart); err == nil && stop.Before(start) {
+		stop = start
+	}
+	return stop
+}
+
+// anyTrue checks any of the values is true
+func anyTrue(m map[int64]bool) bool {
+	for _, v := range m {
+		if v {
+			return true
+		}
+	}
+	return false
+}
+
+// dated changes which apply makes in a unit
+const (
+	deltaActionRentableType = "RentableType"
+	deltaActionUseStatus    = "UseStatus"
+	deltaActionStop         = "Stop"
+	deltaActionRent         = "Rent"
+)
+
+// deltaAction holds a dated change of unit in existing records
+type deltaAction struct {
+	Unit         string
+	Kind         string
+	RID          int64
+	RAID         int64
+	Date         time.Time
+	RentableType string // style of floor plan
+	UseStatus    int64
+	Rent         float64
+}
+
+// getActions returns dated changes of units: agreements of people who moved
+// out or renewed are stopped, rent, floor plan and model status changes
+// start from import date
+func (d *oneSiteDelta) getActions(importDate time.Time) []deltaAction {
+	actions := []deltaAction{}
+
+	// units in order so that changes are made in same order every time
+	units := []string{}
+	for unit := range d.current.Units {
+		units = append(units, unit)
+	}
+	sort.Strings(units)
+
+	for _, unit := range units {
+		current := d.current.Units[unit]
+		incoming, ok := d.incoming.Units[unit]
+		if !ok {
+			// unit is kept, it is only reported
+			continue
+		}
+
+		if incoming.RentableType != "" && incoming.RentableType != current.RentableType {
+			actions = append(actions, deltaAction{Unit: unit, Kind: deltaActionRentableType,
+				RID: current.RID, Date: importDate, RentableType: incoming.RentableType})
+		}
+
+		if (current.Status == core.UnitModel) != (incoming.Status == core.UnitModel) {
+			useStatus, _ := strconv.ParseInt(RentableUseStatusCSV[incoming.Status], 10, 64)
+			actions = append(actions, deltaAction{Unit: unit, Kind: deltaActionUseStatus,
+				RID: current.RID, Date: importDate, UseStatus: useStatus})
+		}
+
+		// agreements of unit, ones which have people staying are kept
+		staying := map[int64]bool{}
+		agreements := []int64{}
+		for _, tenant := range current.Tenants {
+			if _, ok := staying[tenant.RAID]; !ok {
+				agreements = append(agreements, tenant.RAID)
+				staying[tenant.RAID] = false
+			}
+		}
+		for _, currentKey := range core.MatchTenants(current, incoming) {
+			staying[current.Tenants[currentKey].RAID] = true
+		}
+		sort.Slice(agreements, func(i, j int) bool { return agreements[i] < agreements[j] })
+
+		// people who leave while others stay move out on import date,
+		// otherwise the new lease of unit starts when old one stops
+		renewed := isOneSiteRenewal(current, incoming)
+		stop := importDate
+		if renewed || !anyTrue(staying) {
+			stop = getStopDate(current, incoming, importDate)
+		}
+
+		for _, RAID := range agreements {
+			switch {
+			case !staying[RAID] || renewed:
+				// moved out, or renewed agreement replaces this one
+				actions = append(actions, deltaAction{Unit: unit, Kind: deltaActionStop,
+					RID: current.RID, RAID: RAID, Date: stop})
+			case math.Abs(incoming.Rent-current.Rent) >= 0.005:
+				actions = append(actions, deltaAction{Unit: unit, Kind: deltaActionRent,
+					RID: current.RID, RAID: RAID, Date: importDate, Rent: incoming.Rent})
+			}
+		}
+	}
+
+	return actions
+}
+
+// apply makes the dated changes of units in existing records, each change
+// is kept with its unit. New agreements are loaded afterwards.
+func (d *oneSiteDelta) apply(ctx context.Context, BID int64, importTime time.Time) error {
+	importDate := time.Date(importTime.Year(), importTime.Month(), importTime.Day(), 0, 0, 0, 0, time.UTC)
+
+	updater, err := core.NewRecordUpdater(ctx, BID)
+	if err != nil {
+		return err
+	}
+
+	for _, a := range d.getActions(importDate) {
+		n := len(updater.Changes)
+
+		switch a.Kind {
+		case deltaActionRentableType:
+			var rt rlib.RentableType
+			rt, err = rlib.GetRentableTypeByStyle(ctx, a.RentableType, BID)
+			if err == nil && rt.RTID == 0 {
+				err = fmt.Errorf("Floor plan %s is not found", a.RentableType)
+			}
+			if err == nil {
+				err = updater.ChangeRentableType(a.RID, rt.RTID, a.Date)
+			}
+		case deltaActionUseStatus:
+			err = updater.ChangeRentableUseStatus(a.RID, a.UseStatus, a.Date)
+		case deltaActionStop:
+			err = updater.StopRentalAgreement(a.RAID, a.Date)
+		case deltaActionRent:
+			err = updater.ChangeContractRent(a.RAID, a.RID, a.Rent, a.Date)
+		}
+		if err != nil {
+			updater.Rollback()
+			return err
+		}
+
+		for i := n; i < len(updater.Changes); i++ {
+			updater.Changes[i].Unit = a.Unit
+		}
+	}
+
+	if err = updater.Commit(); err != nil {
+		return err
+	}
+	d.RecordChanges = updater.Changes
+	return nil
+}
+
+// getFailedRenewals returns lines of renewals of which new agreement could
+// not be loaded, agreement it replaces has been stopped already
+func (d *oneSiteDelta) getFailedRenewals(csvErrors map[int][]string) []int {
+	errPrefix := "E:<" + core.DBTypeMapStrings[core.DBRentalAgreement] + ">:"
+
+	lines := []int{}
+	for rowIndex := range d.renewals {
+		for _, reason := range csvErrors[rowIndex+1] {
+			if strings.HasPrefix(reason, errPrefix) {
+				lines = append(lines, rowIndex+1)
+				break
+			}
+		}
+	}
+	sort.Ints(lines)
+	return lines
+}
+
+// getRowUnits returns units of the rows by line, once each and in order
+func (d *oneSiteDelta) getRowUnits(lines []int) []string {
+	units := []string{}
+	for _, line := range lines {
+		if unit := d.rowUnits[line-1]; unit != "" && !core.StringInSlice(unit, units) {
+			units = append(units, unit)
+		}
+	}
+	sort.Strings(units)
+	return units
+}
+
+// splitUnitChanges returns dated changes of the units and the rest
+func (d *oneSiteDelta) splitUnitChanges(units []string) ([]core.RecordChange, []core.RecordChange) {
+	ofUnits, rest := []core.RecordChange{}, []core.RecordChange{}
+	for _, c := range d.RecordChanges {
+		if core.StringInSlice(c.Unit, units) {
+			ofUnits = append(ofUnits, c)
+		} else {
+			rest = append(rest, c)
+		}
+	}
+	return ofUnits, rest
+}
+
+// revertUnits rolls back dated changes of the units only, so agreements
+// stopped on them are in effect again. Changes of other units are kept
+// with the agreements loaded for them.
+func (d *oneSiteDelta) revertUnits(ctx context.Context, BID int64, units []string) error {
+	ofUnits, rest := d.splitUnitChanges(units)
+	if len(ofUnits) == 0 {
+		return nil
+	}
+	if err := core.RevertRecordChanges(ctx, BID, ofUnits); err != nil {
+		return err
+	}
+	d.RecordChanges = rest
+	return nil
+}
+
+// revert rolls back the dated changes. They are committed before rcsv loads
+// new agreements, which it does outside of their transaction.
+func (d *oneSiteDelta) revert(ctx context.Context, BID int64) error {
+	if len(d.RecordChanges) == 0 {
+		return nil
+	}
+	if err := core.RevertRecordChanges(ctx, BID, d.RecordChanges); err != nil {
+		return err
+	}
+	d.RecordChanges = []core.RecordChange{}
+	return nil
+}
@@ -0,0 +1,182 @@
+package onesite
+
+import (
+	"importers/core"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// header of onesite importer
+const sampleHeaderJSON = "../admin/onesite/header.json"
+
+// sampleDeltaRows is snapshot of a business imported before:
+// 101 is unchanged, 102 is renewed, in 103 a person moves in after
+// other one moved out, 104 has person whose name changed on same lease
+// with new rent, 105 is a new unit and 106 becomes a model unit
+var sampleDeltaRows = [][]string{
+	{"Bldg/Unit", "Floorplan", "Unit Designation", "SQFT", "Unit/Lease Status", "Name", "Move-In", "Move-Out", "Lease Start", "Lease End", "Market + Addl.", "Lease Rent", "RENT", "Total Billing"},
+	{"101", "A1", "N/A", "656", "Occupied", "Smith, John", "01/01/2018", "", "01/01/2018", "12/31/2018", "700", "700", "700", "700"},
+	{"102", "A1", "N/A", "656", "Occupied", "Brown, Mary", "01/01/2017", "", "01/01/2018", "12/31/2018", "700", "700", "700", "700"},
+	{"103", "A1", "N/A", "656", "Occupied", "Green, Tom", "04/01/2018", "", "04/01/2018", "03/31/2019", "700", "700", "700", "700"},
+	{"104", "A1", "N/A", "656", "Occupied", "Doe, Jane", "01/01/2018", "", "01/01/2018", "12/31/2018", "700", "750", "750", "750"},
+	{"105", "B1", "N/A", "820", "Occupied", "White, Bob", "04/01/2018", "", "04/01/2018", "03/31/2019", "900", "900", "900", "900"},
+	{"106", "B1", "N/A", "820", "Model", "", "", "", "", "", "900", "0", "0", "0"},
+}
+
+// getSampleDeltaState returns business as it was before the snapshot
+func getSampleDeltaState() *core.BusinessState {
+	state := core.NewBusinessState()
+	addUnit := func(name string, RID int64, status, start, end string, rent string) *core.UnitState {
+		unit := state.GetUnit(name)
+		unit.RID = RID
+		unit.RentableType = "A1"
+		unit.Status = status
+		if status == core.UnitOccupied {
+			unit.SetLease(rent, start, end)
+		}
+		return unit
+	}
+	addTenant := func(unit *core.UnitState, first, last string, TCID, RAID int64) {
+		key := unit.AddTenant(first, last, "", "")
+		tenant := unit.Tenants[key]
+		tenant.TCID, tenant.RAID = TCID, RAID
+		unit.Tenants[key] = tenant
+	}
+
+	addTenant(addUnit("101", 1, core.UnitOccupied, "01/01/2018", "12/31/2018", "700"), "John", "Smith", 11, 21)
+	addTenant(addUnit("102", 2, core.UnitOccupied, "01/01/2017", "12/31/2017", "700"), "Mary", "Brown", 12, 22)
+	addTenant(addUnit("103", 3, core.UnitOccupied, "01/01/2017", "12/31/2018", "700"), "Ann", "Black", 13, 23)
+	addTenant(addUnit("104", 4, core.UnitOccupied, "01/01/2018", "12/31/2018", "700"), "Jane", "Roe", 14, 24)
+	addUnit("106", 6, core.UnitVacant, "", "", "")
+	state.AddRentableType("A1")
+	return state
+}
+
+// getSampleDelta returns delta of sample snapshot
+func getSampleDelta(t *testing.T) *oneSiteDelta {
+	csvHeaderList, err := core.GetCSVHeaders(sampleHeaderJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	skipRowsCount := detectOneSiteHeaders(sampleDeltaRows, csvHeaderList)
+	if skipRowsCount != 1 {
+		t.Fatalf("headers of sample rows are found at %d, want 1", skipRowsCount)
+	}
+	csvHeaderMap := map[string]core.CSVHeader{}
+	for _, header := range csvHeaderList {
+		csvHeaderMap[header.Name] = header
+	}
+	return newOneSiteDelta(getSampleDeltaState(), sampleDeltaRows, skipRowsCount, csvHeaderList, csvHeaderMap)
+}
+
+func TestNewOneSiteDelta(t *testing.T) {
+	d := getSampleDelta(t)
+
+	if want := map[string]bool{"105": true}; !reflect.DeepEqual(d.newUnits, want) {
+		t.Errorf("new units = %v, want %v", d.newUnits, want)
+	}
+	// renamed person of 104 is matched by lease, not moved in
+	if want := map[int]bool{3: true, 5: true}; !reflect.DeepEqual(d.moveIns, want) {
+		t.Errorf("move-ins = %v, want %v", d.moveIns, want)
+	}
+	if want := map[int]int64{2: 12}; !reflect.DeepEqual(d.renewals, want) {
+		t.Errorf("renewals = %v, want %v", d.renewals, want)
+	}
+	if want := map[int]string{2: "102", 3: "103", 5: "105"}; !reflect.DeepEqual(d.rowUnits, want) {
+		t.Errorf("row units = %v, want %v", d.rowUnits, want)
+	}
+
+	tests := []struct {
+		name     string
+		rowIndex int
+		csvType  int
+		unit     string
+		want     bool
+	}{
+		{name: "unchanged rentable", rowIndex: 1, csvType: core.RENTABLECSV, unit: "101", want: false},
+		{name: "new rentable", rowIndex: 5, csvType: core.RENTABLECSV, unit: "105", want: true},
+		{name: "unchanged person", rowIndex: 1, csvType: core.PEOPLECSV, unit: "101", want: false},
+		{name: "renewed person", rowIndex: 2, csvType: core.PEOPLECSV, unit: "102", want: false},
+		{name: "moved in person", rowIndex: 3, csvType: core.PEOPLECSV, unit: "103", want: true},
+		{name: "renewed agreement", rowIndex: 2, csvType: core.RENTALAGREEMENTCSV, unit: "102", want: true},
+		{name: "renamed person agreement", rowIndex: 4, csvType: core.RENTALAGREEMENTCSV, unit: "104", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := d.canLoadRow(tt.rowIndex, tt.csvType, tt.unit); got != tt.want {
+			t.Errorf("%s: canLoadRow = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestGetActions(t *testing.T) {
+	d := getSampleDelta(t)
+	importDate := time.Date(2018, 4, 27, 0, 0, 0, 0, time.UTC)
+
+	want := []deltaAction{
+		// renewed agreement stops when new lease starts, not before old one started
+		{Unit: "102", Kind: deltaActionStop, RID: 2, RAID: 22, Date: time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)},
+		// nobody stays, new lease starts after the move-out
+		{Unit: "103", Kind: deltaActionStop, RID: 3, RAID: 23, Date: time.Date(2018, 4, 1, 0, 0, 0, 0, time.UTC)},
+		{Unit: "104", Kind: deltaActionRent, RID: 4, RAID: 24, Date: importDate, Rent: 750},
+		{Unit: "106", Kind: deltaActionRentableType, RID: 6, Date: importDate, RentableType: "B1"},
+		{Unit: "106", Kind: deltaActionUseStatus, RID: 6, Date: importDate, UseStatus: 7},
+	}
+
+	got := d.getActions(importDate)
+	if len(got) != len(want) {
+		t.Fatalf("got %d actions, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		if !reflect.DeepEqual(got[i], want[i]) {
+			t.Errorf("action %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestGetFailedRenewals(t *testing.T) {
+	d := getSampleDelta(t)
+	raError := "E:<" + core.DBTypeMapStrings[core.DBRentalAgreement] + ">:Unable to insert"
+	peopleError := "E:<" + core.DBTypeMapStrings[core.DBPeople] + ">:Unable to insert"
+
+	tests := []struct {
+		name      string
+		csvErrors map[int][]string
+		want      []int
+	}{
+		{name: "no errors", csvErrors: map[int][]string{}, want: []int{}},
+		{name: "renewal failed", csvErrors: map[int][]string{3: {raError}}, want: []int{3}},
+		{name: "other error of renewal", csvErrors: map[int][]string{3: {peopleError}}, want: []int{}},
+		{name: "move-in failed", csvErrors: map[int][]string{4: {raError}}, want: []int{}},
+	}
+
+	for _, tt := range tests {
+		if got := d.getFailedRenewals(tt.csvErrors); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSplitUnitChanges(t *testing.T) {
+	d := getSampleDelta(t)
+	d.RecordChanges = []core.RecordChange{
+		{Table: "RentalAgreement", KeyColumn: "RAID", Key: 22, Column: "AgreementStop", Unit: "102"},
+		{Table: "RentalAgreement", KeyColumn: "RAID", Key: 23, Column: "AgreementStop", Unit: "103"},
+		{Table: "RentableStatus", KeyColumn: "RSID", Key: 5, Unit: "106"},
+	}
+
+	// line of renewal row of 102
+	units := d.getRowUnits([]int{3})
+	if want := []string{"102"}; !reflect.DeepEqual(units, want) {
+		t.Fatalf("units = %v, want %v", units, want)
+	}
+
+	reverted, kept := d.splitUnitChanges(units)
+	if want := d.RecordChanges[:1]; !reflect.DeepEqual(reverted, want) {
+		t.Errorf("reverted = %+v, want %+v", reverted, want)
+	}
+	if want := d.RecordChanges[1:]; !reflect.DeepEqual(kept, want) {
+		t.Errorf("kept = %+v, want %+v", kept, want)
+	}
+}
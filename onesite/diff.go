@@ -0,0 +1,153 @@
+package onesite
+
+import (
+	"context"
+	"errors"
+	"importers/core"
+	"path"
+	"rentroll/rlib"
+	"strings"
+
+	"github.com/kardianos/osext"
+)
+
+// readOneSiteCSV loads onesite csv and finds its headers, it returns
+// data of csv with count of rows before data rows
+func readOneSiteCSV(oneSiteCSV string) ([][]string, int, []core.CSVHeader, map[string]core.CSVHeader, error) {
+	folderPath, err := osext.ExecutableFolder()
+	if err != nil {
+		return nil, 0, nil, nil, err
+	}
+
+	csvHeaderList, err := core.GetCSVHeaders(path.Join(folderPath, "header.json"))
+	if err != nil {
+		return nil, 0, nil, nil, err
+	}
+
+	// load csv file and get data from csv
+	t := rlib.LoadCSV(oneSiteCSV)
+
+	skipRowsCount := detectOneSiteHeaders(t, csvHeaderList)
+	if skipRowsCount == 0 {
+		missingHeaders := []string{}
+		for _, header := range csvHeaderList {
+			if header.Index == -1 && !header.IsOptional {
+				missingHeaders = append(missingHeaders, header.Name)
+			}
+		}
+		return nil, 0, nil, nil, errors.New("Required data column(s) missing: " + strings.Join(missingHeaders, ", "))
+	}
+
+	csvHeaderMap := map[string]core.CSVHeader{}
+	for _, header := range csvHeaderList {
+		csvHeaderMap[header.Name] = header
+	}
+
+	return t, skipRowsCount, csvHeaderList, csvHeaderMap, nil
+}
+
+// readOneSiteState reads units of onesite csv in the state
+// which can be compared with the business
+func readOneSiteState(oneSiteCSV string) (*core.BusinessState, error) {
+	t, skipRowsCount, csvHeaderList, csvHeaderMap, err := readOneSiteCSV(oneSiteCSV)
+	if err != nil {
+		return core.NewBusinessState(), err
+	}
+
+	state := getOneSiteState(t, skipRowsCount, csvHeaderList, csvHeaderMap)
+	if len(state.Units) == 0 {
+		return state, errors.New("There are no data rows present")
+	}
+
+	return state, nil
+}
+
+// getOneSiteCell returns trimmed value of header in row,
+// blank if column is not there
+func getOneSiteCell(row []string, csvHeaderMap map[string]core.CSVHeader, name string) string {
+	header, ok := csvHeaderMap[name]
+	if !ok || header.Index == -1 || header.Index >= len(row) {
+		return ""
+	}
+	return strings.TrimSpace(row[header.Index])
+}
+
+// getOneSiteState returns units of data rows of onesite csv
+func getOneSiteState(
+	t [][]string,
+	skipRowsCount int,
+	csvHeaderList []core.CSVHeader,
+	csvHeaderMap map[string]core.CSVHeader,
+) *core.BusinessState {
+	state := core.NewBusinessState()
+
+	cell := func(row []string, name string) string {
+		return getOneSiteCell(row, csvHeaderMap, name)
+	}
+
+	for rowIndex := skipRowsCount; rowIndex < len(t); rowIndex++ {
+		if isOneSiteBlankRow(t[rowIndex], csvHeaderList) {
+			break
+		}
+
+		unitName := cell(t[rowIndex], "Unit")
+		if unitName == "" {
+			continue
+		}
+
+		// rows with same unit hold other people of the unit
+		_, found := state.Units[unitName]
+		unit := state.GetUnit(unitName)
+		if !found {
+			unit.RentableType = cell(t[rowIndex], "FloorPlan")
+			_, status, _ := IsValidRentableUseStatus(cell(t[rowIndex], "UnitLeaseStatus"))
+			if status == "" {
+				status = core.UnitVacant
+			}
+			unit.Status = status
+			state.AddRentableType(unit.RentableType)
+			if status == core.UnitOccupied {
+				unit.SetLease(
+					core.DgtGrpSepToDgts(cell(t[rowIndex], "Rent")),
+					cell(t[rowIndex], "LeaseStart"),
+					cell(t[rowIndex], "LeaseEnd"),
+				)
+			}
+		}
+
+		// people are imported only for occupied unit
+		if unit.Status != core.UnitOccupied {
+			continue
+		}
+		if name := cell(t[rowIndex], "Name"); name != "" {
+			personName := core.ParsePersonName(name, "")
+			unit.AddTenant(personName.First, personName.Last,
+				cell(t[rowIndex], "Email"), cell(t[rowIndex], "PhoneNumber"))
+		}
+	}
+
+	return state
+}
+
+// DiffHandler compares onesite csv with the current state of business
+// and returns report of changes, nothing is written to the database
+func DiffHandler(
+	ctx context.Context,
+	csvPath string,
+	business *rlib.Business,
+) (string, bool) {
+
+	incoming, err := readOneSiteState(csvPath)
+	if err != nil {
+		return err.Error() + "\n", false
+	}
+
+	current, err := core.LoadBusinessState(ctx, business.BID)
+	if err != nil {
+		rlib.Ulog("INTERNAL ERROR <LOAD BUSINESS STATE>: %s\n", err.Error())
+		return "Unable to read current state of business " + business.Designation + "\n", false
+	}
+
+	changes := core.DiffBusinessStates(current, incoming)
+	return core.GetDiffReport(business, csvPath, changes), true
+}
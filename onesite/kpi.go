@@ -0,0 +1,64 @@
+package onesite
+
+import (
+	"importers/core"
+	"strings"
+)
+
+// getOneSiteUnitStatus returns status of unit for kpis, units which are
+// down are not imported with a status of their own
+func getOneSiteUnitStatus(unitLeaseStatus string) string {
+	if strings.Contains(strings.ToLower(unitLeaseStatus), core.UnitDown) {
+		return core.UnitDown
+	}
+	_, status, _ := IsValidRentableUseStatus(unitLeaseStatus)
+	if status == "" {
+		status = core.UnitVacant
+	}
+	return status
+}
+
+// getOneSiteKPI reads units of data rows of onesite csv for kpis
+func getOneSiteKPI(
+	t [][]string,
+	skipRowsCount int,
+	csvHeaderList []core.CSVHeader,
+	csvHeaderMap map[string]core.CSVHeader,
+) *core.RentRollKPI {
+	k := core.NewRentRollKPI(getOneSiteAsOfDate(t, skipRowsCount))
+	k.MarketRent = csvHeaderMap["MarketAddl"].Index != -1
+
+	for rowIndex := skipRowsCount; rowIndex < len(t); rowIndex++ {
+		if isOneSiteBlankRow(t[rowIndex], csvHeaderList) {
+			break
+		}
+
+		unitName := getOneSiteCell(t[rowIndex], csvHeaderMap, "Unit")
+		if unitName == "" {
+			continue
+		}
+
+		// rows with same unit hold other people of the unit
+		u, found := k.GetUnit(unitName)
+		if found {
+			continue
+		}
+		amounts := getOneSiteAmounts(t[rowIndex], csvHeaderMap)
+		u.FloorPlan = getOneSiteCell(t[rowIndex], csvHeaderMap, "FloorPlan")
+		u.Status = getOneSiteUnitStatus(getOneSiteCell(t[rowIndex], csvHeaderMap, "UnitLeaseStatus"))
+		u.MarketRent = amounts.MarketRent
+		u.LeaseRent = amounts.ContractRent
+		u.SetLeaseEnd(getOneSiteCell(t[rowIndex], csvHeaderMap, "LeaseEnd"))
+	}
+
+	return k
+}
+
+// getKPIReport returns kpis of onesite csv
+func getKPIReport(csvFile string) string {
+	t, skipRowsCount, csvHeaderList, csvHeaderMap, err := readOneSiteCSV(csvFile)
+	if err != nil {
+		return "Unable to compute KPIs: " + err.Error() + "\n"
+	}
+	return core.GetKPIReport(getOneSiteKPI(t, skipRowsCount, csvHeaderList, csvHeaderMap))
+}
@@ -6,6 +6,7 @@ import (
 	"importers/core"
 	"os"
 	"path"
+	"reflect"
 	"rentroll/rcsv"
 	"rentroll/rlib"
 	"sort"
@@ -24,14 +25,22 @@ func loadOneSiteCSV(
 	testMode int,
 	userRRValues map[string]string,
 	business *rlib.Business,
+	deltaImport bool,
 	currentTime time.Time,
 	currentTimeFormat string,
 	summaryReport map[int]map[string]int,
-) (map[int]string, map[int][]string, bool) {
+	rowNotes map[int][]core.RowNote,
+	raTemplates map[int]core.RATemplateChoice,
+	duplicates map[int]core.PersonDuplicate,
+	importRecord *core.ImportRecord,
+) (map[int]string, map[int][]string, *oneSiteDelta, bool) {
 
 	internalErrFlag := true
 	csvErrors := map[int][]string{}
 
+	// delta holds changes of business imported before, nil for reload
+	var delta *oneSiteDelta
+
 	// this count used to skip number of rows from the very top of csv
 	var skipRowsCount int
 
@@ -51,7 +60,7 @@ func loadOneSiteCSV(
 	folderPath, err := osext.ExecutableFolder()
 	if err != nil {
 		rlib.Ulog("INTERNAL ERROR <ONESITE GETTING FOLDERPATH>: %s\n", err.Error())
-		return traceUnitMap, csvErrors, internalErrFlag
+		return traceUnitMap, csvErrors, delta, internalErrFlag
 	}
 
 	// read json file which contains mapping of onesite fields
@@ -61,7 +70,7 @@ func loadOneSiteCSV(
 	err = core.GetFieldMapping(&oneSiteFieldMap, mapperFilePath)
 	if err != nil {
 		rlib.Ulog("INTERNAL ERROR <ONESITE FIELD MAPPING>: %s\n", err.Error())
-		return traceUnitMap, csvErrors, internalErrFlag
+		return traceUnitMap, csvErrors, delta, internalErrFlag
 	}
 
 	// get Headers of csv
@@ -70,59 +79,33 @@ func loadOneSiteCSV(
 	csvHeaderList, err := core.GetCSVHeaders(headerFilePath)
 	if err != nil {
 		rlib.Ulog("INTERNAL ERROR <ONESITE GETTING CSV HEADERS>: %s\n", err.Error())
-		return traceUnitMap, csvErrors, internalErrFlag
+		return traceUnitMap, csvErrors, delta, internalErrFlag
 	}
 
-	// load csv file and get data from csv
-	t := rlib.LoadCSV(oneSiteCSV)
+	// read json file which contains rules to find duplicate people
+	matchFilePath := path.Join(folderPath, "match.json")
 
-	// iterate over csv data to detect headers first
-	for rowIndex := 0; rowIndex < len(t); rowIndex++ {
-		for colIndex := 0; colIndex < len(t[rowIndex]); colIndex++ {
-			// remove all white spaces and make lower case
-			cellTextValue := strings.ToLower(
-				core.SpecialCharsReplacer.Replace(t[rowIndex][colIndex]))
-
-			// ********************************
-			// MARKET RENT OR MARKET ADDL
-			// ********************************
-			// if marketRent found then remove marketAddl header
-			// and make an entry for "marketrent" in csvColumnFieldMap with -1
-			// keep "MarketAddl" mapping to `marketrent` still, anyways `MarketAddl`
-			// going to be put in `MarketRate` of Rentroll field
-			if cellTextValue == marketRent {
-				for i := range csvHeaderList {
-					if csvHeaderList[i].HeaderText == "marketaddl" {
-						csvHeaderList[i].HeaderText = marketRent
-						csvHeaderList[i].Name = "MarketAddl"
-					}
-				}
-			}
-			// assign column index in struct if header text match from cell data
-			for i := range csvHeaderList {
-				if csvHeaderList[i].HeaderText == cellTextValue {
-					csvHeaderList[i].Index = colIndex
-				}
-			}
-		}
+	personMatchRules, err := core.GetPersonMatchRules(matchFilePath)
+	if err != nil {
+		rlib.Ulog("INTERNAL ERROR <ONESITE PERSON MATCH RULES>: %s\n", err.Error())
+		return traceUnitMap, csvErrors, delta, internalErrFlag
+	}
 
-		// check after row columns parsing that headers are found or not
-		headersFound := true
-		for i := range csvHeaderList {
-			if csvHeaderList[i].Index == -1 && !csvHeaderList[i].IsOptional {
-				headersFound = false
-				break
-			}
-		}
+	// read json file which contains site specific rules
+	profileFilePath := path.Join(folderPath, "profile.json")
 
-		if headersFound {
-			// update rowIndex by 1 because we're going to break here
-			rowIndex++
-			skipRowsCount = rowIndex
-			break
-		}
+	oneSiteProfile, err := loadProfile(profileFilePath)
+	if err != nil {
+		rlib.Ulog("INTERNAL ERROR <ONESITE PROFILE>: %s\n", err.Error())
+		return traceUnitMap, csvErrors, delta, internalErrFlag
 	}
 
+	// load csv file and get data from csv
+	t := rlib.LoadCSV(oneSiteCSV)
+
+	// detect headers first, it tells how many rows to skip
+	skipRowsCount = detectOneSiteHeaders(t, csvHeaderList)
+
 	// if headers not found then
 	if skipRowsCount == 0 {
 		missingHeaders := []string{}
@@ -139,7 +122,7 @@ func loadOneSiteCSV(
 		// -1 means there is no data column
 		internalErrFlag = false
 		csvErrors[-1] = append(csvErrors[-1], headerError)
-		return traceUnitMap, csvErrors, internalErrFlag
+		return traceUnitMap, csvErrors, delta, internalErrFlag
 	}
 
 	// map for csv headers in onesite csv file to access data fastly
@@ -150,6 +133,23 @@ func loadOneSiteCSV(
 		csvHeaderMap[header.Name] = header
 	}
 
+	// ===================================================
+	// BUSINESS IMPORTED BEFORE IS LOADED WITH CHANGES ONLY
+	// ===================================================
+	if deltaImport {
+		delta, err = getOneSiteDelta(ctx, business.BID, t, skipRowsCount, csvHeaderList, csvHeaderMap)
+		if err != nil {
+			rlib.Ulog("INTERNAL ERROR <ONESITE DELTA>: %s\n", err.Error())
+			return traceUnitMap, csvErrors, delta, internalErrFlag
+		}
+	}
+
+	// canLoadRow checks data of row has to be loaded for csv type,
+	// delta import loads only rows which add something to business
+	canLoadRow := func(rowIndex int, csvType int) bool {
+		return delta == nil || delta.canLoadRow(rowIndex, csvType, traceUnitMap[rowIndex])
+	}
+
 	// --------------------------- csv record count ----------------------------
 	// <TYPE>CSVRecordCount used to hold records count inserted in csv
 	// initialize with 1 because first row contains headers in target generated csv
@@ -211,25 +211,45 @@ func loadOneSiteCSV(
 	// so we identify each element in this list with Style Key
 	customAttributesRefData := map[string]CARD{}
 
+	// ========================================================
+	// EXISTING PEOPLE OF BUSINESS ARE CANDIDATES OF DUPLICATES
+	// ========================================================
+	// they are loaded before business is deleted, people of business
+	// which is loaded again are reported but not merged with
+	personMatcher := core.NewPersonMatcher(personMatchRules)
+	err = personMatcher.LoadTransactantRecords(ctx, business.BID)
+	if err != nil {
+		rlib.Ulog("INTERNAL ERROR <LOAD TRANSACTANTS>: %s\n", err.Error())
+		return traceUnitMap, csvErrors, delta, internalErrFlag
+	}
+
 	// =================================
 	// DELETE DATA RELATED TO BUSINESS ID
 	// =================================
-	// delete business related data before starting to import in database
-	_, err = rlib.DeleteBusinessFromDB(ctx, business.BID)
-	if err != nil {
-		rlib.Ulog("INTERNAL ERROR <DELETE BUSINESS>: %s\n", err.Error())
-		return traceUnitMap, csvErrors, internalErrFlag
-	}
+	// delete business related data before starting to import in database,
+	// delta import keeps the data and changes it
+	if delta == nil {
+		personMatcher.SetTransactantsDeleted()
 
-	bid, err := rlib.InsertBusiness(ctx, business)
-	if err != nil {
-		rlib.Ulog("INTERNAL ERROR <INSERT BUSINESS>: %s\n", err.Error())
-		return traceUnitMap, csvErrors, internalErrFlag
+		_, err = rlib.DeleteBusinessFromDB(ctx, business.BID)
+		if err != nil {
+			rlib.Ulog("INTERNAL ERROR <DELETE BUSINESS>: %s\n", err.Error())
+			return traceUnitMap, csvErrors, delta, internalErrFlag
+		}
+
+		bid, err := rlib.InsertBusiness(ctx, business)
+		if err != nil {
+			rlib.Ulog("INTERNAL ERROR <INSERT BUSINESS>: %s\n", err.Error())
+			return traceUnitMap, csvErrors, delta, internalErrFlag
+		}
+		// set new BID as we have deleted and inserted it again
+		// TODO:  remove this step after sman's next push
+		// in InsertBusiness it will be set automatically
+		business.BID = bid
 	}
-	// set new BID as we have deleted and inserted it again
-	// TODO:  remove this step after sman's next push
-	// in InsertBusiness it will be set automatically
-	business.BID = bid
+
+	// mergedPeople holds the person with which people of the row is merged
+	mergedPeople := map[int]core.PersonRecord{}
 
 	// ========================================================
 	// WRITE DATA FOR CUSTOM ATTRIBUTE, RENTABLE TYPE, PEOPLE CSV
@@ -243,7 +263,7 @@ func loadOneSiteCSV(
 		)
 	if !ok {
 		rlib.Ulog("INTERNAL ERROR <RENTABLE TYPE CSV>: %s\n", err.Error())
-		return traceUnitMap, csvErrors, internalErrFlag
+		return traceUnitMap, csvErrors, delta, internalErrFlag
 	}
 
 	// get created customAttibutes csv and writer pointer
@@ -254,7 +274,7 @@ func loadOneSiteCSV(
 		)
 	if !ok {
 		rlib.Ulog("INTERNAL ERROR <CUSTOM ATTRIUTE CSV>: %s\n", err.Error())
-		return traceUnitMap, csvErrors, internalErrFlag
+		return traceUnitMap, csvErrors, delta, internalErrFlag
 	}
 
 	// get created people csv and writer pointer
@@ -265,39 +285,23 @@ func loadOneSiteCSV(
 		)
 	if !ok {
 		rlib.Ulog("INTERNAL ERROR <PEOPLE CSV>: %s\n", err.Error())
-		return traceUnitMap, csvErrors, internalErrFlag
+		return traceUnitMap, csvErrors, delta, internalErrFlag
 	}
 
 	// once headers are found, then look for the data
 	for rowIndex := skipRowsCount; rowIndex <= len(t); rowIndex++ {
 
-		// blank cell values count
-		blankCellCount := 0
-
-		// unavailable fields in csv data
-		unavailableFields := 0
-
-		for _, header := range csvHeaderList {
-			if header.Index == -1 { // if not available
-				unavailableFields++
-			} else { // if available
-				if t[rowIndex][header.Index] == "" { // if data is blank
-					blankCellCount++
-				}
-			}
-		}
-
 		// look for blank data in original csv data
 		// if blank data found in required columns in a row then break
 		// the current loop and avoid to import data further
-		if blankCellCount+unavailableFields == len(csvHeaderList) {
+		if isOneSiteBlankRow(t[rowIndex], csvHeaderList) {
 			// what IF, only headers are there
 			if (rowIndex) == skipRowsCount {
 				// ******** special entry ***********
 				// -1 means there is no data
 				internalErrFlag = false
 				csvErrors[-1] = append(csvErrors[-1], "There are no data rows present")
-				return traceUnitMap, csvErrors, internalErrFlag
+				return traceUnitMap, csvErrors, delta, internalErrFlag
 			} /*else {
 				// blank row found, can't proceed further
 			}*/
@@ -314,8 +318,11 @@ func loadOneSiteCSV(
 		csvTypesSet := canWriteCSVStatusMap[rrUseStatus]
 		var canReadData bool
 
+		// tell why rows are not imported as they are
+		addOneSiteRowNotes(rowNotes, rowIndex, traceUnitMap, csvRentableStatus, csvTypesSet, delta)
+
 		// check first that for this row's status rentableType data can be read
-		canReadData = core.IntegerInSlice(core.RENTABLETYPECSV, csvTypesSet)
+		canReadData = core.IntegerInSlice(core.RENTABLETYPECSV, csvTypesSet) && canLoadRow(rowIndex, core.RENTABLETYPECSV)
 		if canReadData {
 			ReadRentableTypeCSVData(
 				&RentableTypeCSVRecordCount,
@@ -327,6 +334,7 @@ func loadOneSiteCSV(
 				currentTime,
 				userRRValues,
 				&oneSiteFieldMap.RentableTypeCSV,
+				oneSiteFieldMap.Transforms["RentableTypeCSV"],
 				customAttributesRefData,
 				csvHeaderMap,
 				business,
@@ -334,7 +342,7 @@ func loadOneSiteCSV(
 		}
 
 		// check first that for this row's status custom attributes data can be read
-		canReadData = core.IntegerInSlice(core.CUSTOMATTRIUTESCSV, csvTypesSet)
+		canReadData = core.IntegerInSlice(core.CUSTOMATTRIUTESCSV, csvTypesSet) && canLoadRow(rowIndex, core.CUSTOMATTRIUTESCSV)
 		if canReadData {
 			ReadCustomAttributeCSVData(
 				&CustomAttributeCSVRecordCount,
@@ -349,7 +357,7 @@ func loadOneSiteCSV(
 		}
 
 		// check first that for this row's status people data can be read
-		canReadData = core.IntegerInSlice(core.PEOPLECSV, csvTypesSet)
+		canReadData = core.IntegerInSlice(core.PEOPLECSV, csvTypesSet) && canLoadRow(rowIndex, core.PEOPLECSV)
 		if canReadData {
 			traceTCIDMap[rowIndex] = ""
 			ReadPeopleCSVData(
@@ -359,15 +367,23 @@ func loadOneSiteCSV(
 				t[rowIndex],
 				&peopleCSVData,
 				traceDuplicatePeople,
+				personMatcher,
+				mergedPeople,
 				currentTimeFormat,
 				userRRValues,
 				&oneSiteFieldMap.PeopleCSV,
+				oneSiteFieldMap.Transforms["PeopleCSV"],
 				csvErrors,
 				csvHeaderMap,
 			)
 		}
 	}
 
+	// duplicates found are reported by line
+	for line, d := range personMatcher.GetDuplicates() {
+		duplicates[line] = d
+	}
+
 	for _, data := range rentableTypeCSVData {
 		rentableTypeCSVWriter.Write(data)
 		rentableTypeCSVWriter.Flush()
@@ -427,11 +443,38 @@ func loadOneSiteCSV(
 		return onesiteIndex, unit
 	}
 
+	// getLoadedKeys returns keys of rows written in csv of data type,
+	// import record finds the records loaded from csv by them
+	getLoadedKeys := func(dbType int) []string {
+		switch dbType {
+		case core.DBCustomAttr:
+			return core.GetCSVRowKeys(reflect.TypeOf(oneSiteFieldMap.CustomAttributeCSV), customAttributeCSVData, "Name", "Value")
+		case core.DBRentableType:
+			return core.GetCSVRowKeys(reflect.TypeOf(oneSiteFieldMap.RentableTypeCSV), rentableTypeCSVData, "Style")
+		case core.DBRentable:
+			return core.GetCSVRowKeys(reflect.TypeOf(oneSiteFieldMap.RentableCSV), rentableCSVData, "Name")
+		case core.DBRentalAgreement:
+			return core.GetAgreementRowKeys(reflect.TypeOf(oneSiteFieldMap.RentalAgreementCSV), rentalAgreementCSVData)
+		default:
+			return nil
+		}
+	}
+
 	// rrDoLoad is a nested function
 	// used to load data from csv with help of rcsv loaders
 	rrDoLoad := func(ctx context.Context, fname string, handler func(context.Context, string) []error, traceDataMapName string, dbType int) bool {
+		if err := importRecord.BeginLoad(ctx, dbType); err != nil {
+			rlib.Ulog("INTERNAL ERROR <IMPORT RECORD>: %s\n", err.Error())
+			return false
+		}
+
 		Errs := handler(ctx, fname)
 
+		if err := importRecord.EndLoad(ctx, business.BID, dbType, getLoadedKeys(dbType)); err != nil {
+			rlib.Ulog("INTERNAL ERROR <IMPORT RECORD>: %s\n", err.Error())
+			return false
+		}
+
 		for _, err := range Errs {
 			// skip warnings about already existing records
 			// if it's not kind of to skip then process it and count in error report
@@ -461,6 +504,12 @@ func loadOneSiteCSV(
 	// rrPeopleDoLoad (SPECIAL METHOD TO LOAD PEOPLE)
 	// *****************************************************
 	rrPeopleDoLoad := func(ctx context.Context, fname string, handler func(context.Context, string) []error, traceDataMapName string, dbType int) bool {
+		// people loaded are known by their notes after load
+		if err := importRecord.BeginLoad(ctx, dbType); err != nil {
+			rlib.Ulog("INTERNAL ERROR <IMPORT RECORD>: %s\n", err.Error())
+			return false
+		}
+
 		Errs := handler(ctx, fname)
 
 		for _, err := range Errs {
@@ -477,7 +526,8 @@ func loadOneSiteCSV(
 				onesiteIndex, _ := getIndexAndUnit(traceDataMap, lineNo, itemNo)
 				// load csvRow from dataMap to get email
 				csvRow := t[onesiteIndex]
-				pEmail := csvRow[csvHeaderMap["Email"].Index]
+				// people are stored with normalised email
+				pEmail, _ := core.NormalizeEmail(csvRow[csvHeaderMap["Email"].Index])
 				// get tcid from email
 				t, tErr := rlib.GetTransactantByPhoneOrEmail(ctx, business.BID, pEmail)
 				if tErr != nil {
@@ -527,7 +577,8 @@ func loadOneSiteCSV(
 					onesiteIndex, unit := getIndexAndUnit(traceDataMap, lineNo, itemNo)
 					// load csvRow from dataMap to get email
 					csvRow := t[onesiteIndex]
-					pCellNo := csvRow[csvHeaderMap["PhoneNumber"].Index]
+					// people are stored with normalised phone
+					pCellNo, _ := core.NormalizePhone(csvRow[csvHeaderMap["PhoneNumber"].Index], userRRValues["DefaultCountry"])
 					// get tcid from cellphonenumber
 					t, tErr := rlib.GetTransactantByPhoneOrEmail(ctx, business.BID, pCellNo)
 					if tErr != nil {
@@ -565,7 +616,7 @@ func loadOneSiteCSV(
 		if len(h[i].Fname) > 0 {
 			if !rrDoLoad(ctx, h[i].Fname, h[i].Handler, h[i].TraceDataMap, h[i].DBType) {
 				// INTERNAL ERROR
-				return traceUnitMap, csvErrors, internalErrFlag
+				return traceUnitMap, csvErrors, delta, internalErrFlag
 			}
 		}
 	}
@@ -597,56 +648,20 @@ func loadOneSiteCSV(
 		// for all custom attribute defined in custom_attrib.go
 		// find custom attribute ID
 		for _, customAttributeConfig := range customAttributeMap {
-			t, _ := strconv.ParseInt(customAttributeConfig["ValueType"], 10, 64)
-			n := customAttributeConfig["Name"]
-			v := strconv.Itoa(int(refData.SqFt))
-			u := customAttributeConfig["Units"]
-			ca, err := rlib.GetCustomAttributeByVals(ctx, t, n, v, u)
-			if err != nil {
-				rlib.Ulog("ERROR <CUSTOMREF INSERTION>: %s", "CUSTOM ATTRIBUTE NOT FOUND IN DB")
-				csvErrors[refData.RowIndex] = append(csvErrors[refData.RowIndex], errPrefix+"Unable to insert custom attribute")
-				continue
-			}
-			// if resource not found then continue
-			if ca.CID == 0 {
-				rlib.Ulog("ERROR <CUSTOMREF INSERTION>: %s", "CUSTOM ATTRIBUTE NOT FOUND IN DB")
-				csvErrors[refData.RowIndex] = append(csvErrors[refData.RowIndex], errPrefix+"Unable to insert custom attribute")
-				continue
-			}
-
 			// count possible values
 			CustomAttrRefRecordCount++
 
-			// insert custom attribute ref in system
-			var a rlib.CustomAttributeRef
-			a.ElementType = rlib.ELEMRENTABLETYPE
-			a.BID = business.BID
-			a.ID = rt.RTID
-			a.CID = ca.CID
-
-			// check that record already exists, if yes then just continue
-			// without accounting it as an error
-			ref, err := rlib.GetCustomAttributeRef(ctx, a.ElementType, a.ID, a.CID)
-			if err != nil {
-				rlib.Ulog("ERROR <CUSTOMREF INSERTION>: %s", err.Error())
-				continue
-			} else {
-				if ref.ElementType == a.ElementType && ref.CID == a.CID && ref.ID == a.ID {
-					unit, _ := traceUnitMap[refData.RowIndex]
-					errText := fmt.Sprintf(
-						"This reference already exists. No changes were made. at row \"%d\" with unit \"%s\"",
-						refData.RowIndex, unit)
-					rlib.Ulog("ERROR <CUSTOMREF INSERTION>: %s", errText)
-					continue
-				}
-			}
-
-			_, err = rlib.InsertCustomAttributeRef(ctx, &a)
+			ca := getCustomAttributeValue(customAttributeConfig, strconv.Itoa(int(refData.SqFt)))
+			carid, err := core.InsertCustomAttributeRef(ctx, business.BID, rlib.ELEMRENTABLETYPE, rt.RTID, ca)
 			if err != nil {
 				rlib.Ulog("ERROR <CUSTOMREF INSERTION>: %s", err.Error())
 				csvErrors[refData.RowIndex] = append(csvErrors[refData.RowIndex], errPrefix+"Unable to insert custom attribute")
 				continue
 			}
+			// reference which exists already makes no changes
+			if carid > 0 {
+				importRecord.AddCreated(core.DBCustomAttrRef, carid)
+			}
 		}
 	}
 
@@ -661,7 +676,7 @@ func loadOneSiteCSV(
 		if len(h[i].Fname) > 0 {
 			if !rrPeopleDoLoad(ctx, h[i].Fname, h[i].Handler, h[i].TraceDataMap, h[i].DBType) {
 				// INTERNAL ERROR
-				return traceUnitMap, csvErrors, internalErrFlag
+				return traceUnitMap, csvErrors, delta, internalErrFlag
 			}
 		}
 	}
@@ -675,12 +690,61 @@ func loadOneSiteCSV(
 	noteString := getPeopleNoteString(0, currentTimeFormat)
 	tcidMap, _ := rlib.GetTCIDByNote(ctx, "%"+noteString[:len(noteString)-1]+"%")
 
+	loadedTCIDs := []string{}
 	for tcid, note := range tcidMap {
 		note_temp := strings.SplitN(note, "$", 2)
 		note_temp = strings.SplitN(note_temp[1], "$", 2)
 		onesiteIndex, _ := strconv.Atoi(note_temp[1])
 
 		traceTCIDMap[onesiteIndex-1] = tcidPrefix + strconv.Itoa(int(tcid))
+		loadedTCIDs = append(loadedTCIDs, strconv.FormatInt(tcid, 10))
+	}
+	if err = importRecord.EndLoad(ctx, business.BID, core.DBPeople, loadedTCIDs); err != nil {
+		rlib.Ulog("INTERNAL ERROR <IMPORT RECORD>: %s\n", err.Error())
+		return traceUnitMap, csvErrors, delta, internalErrFlag
+	}
+
+	// rows merged with other person take TCID of that person, agreement
+	// of row is not loaded if that person could not be loaded
+	noPayorRows := map[int]bool{}
+	for rowIndex, person := range mergedPeople {
+		switch {
+		case person.TCID > 0:
+			traceTCIDMap[rowIndex] = tcidPrefix + strconv.FormatInt(person.TCID, 10)
+			rowNotes[rowIndex+1] = append(rowNotes[rowIndex+1], core.RowNote{Status: core.RowStatusMerged,
+				Reason: fmt.Sprintf("person is merged with transactant %d of business", person.TCID)})
+		case traceTCIDMap[person.Row] == "":
+			noPayorRows[rowIndex] = true
+			errText := fmt.Sprintf("E:<%s>:Person is merged with person of line %d which could not be loaded",
+				core.DBTypeMapStrings[core.DBPeople], person.Row+1)
+			csvErrors[rowIndex+1] = append(csvErrors[rowIndex+1], errText)
+		default:
+			traceTCIDMap[rowIndex] = traceTCIDMap[person.Row]
+			rowNotes[rowIndex+1] = append(rowNotes[rowIndex+1], core.RowNote{Status: core.RowStatusMerged,
+				Reason: fmt.Sprintf("person is merged with person of line %d", person.Row+1)})
+		}
+	}
+
+	// ===========================================================
+	// DATED CHANGES IN BUSINESS IMPORTED BEFORE, NEW AGREEMENTS
+	// OF RENEWALS AND MOVE-INS ARE LOADED AFTER OLD ONES ARE STOPPED
+	// ===========================================================
+	if delta != nil {
+		delta.setRenewalTCIDs(traceTCIDMap)
+		if err = delta.apply(ctx, business.BID, currentTime); err != nil {
+			rlib.Ulog("INTERNAL ERROR <ONESITE DELTA>: %s\n", err.Error())
+			return traceUnitMap, csvErrors, delta, internalErrFlag
+		}
+
+		// changes are rolled back if import can't go on
+		defer func() {
+			if !internalErrFlag {
+				return
+			}
+			if err := delta.revert(ctx, business.BID); err != nil {
+				rlib.Ulog("INTERNAL ERROR <ONESITE DELTA REVERT>: %s\n", err.Error())
+			}
+		}()
 	}
 
 	// ==============================================================
@@ -695,7 +759,7 @@ func loadOneSiteCSV(
 		)
 	if !ok {
 		rlib.Ulog("INTERNAL ERROR <RENTABLE CSV>: %s\n", err.Error())
-		return traceUnitMap, csvErrors, internalErrFlag
+		return traceUnitMap, csvErrors, delta, internalErrFlag
 	}
 
 	// get created rental agreement csv and writer pointer
@@ -706,7 +770,7 @@ func loadOneSiteCSV(
 		)
 	if !ok {
 		rlib.Ulog("INTERNAL ERROR <RENTAL AGREEMENT CSV>: %s\n", err.Error())
-		return traceUnitMap, csvErrors, internalErrFlag
+		return traceUnitMap, csvErrors, delta, internalErrFlag
 	}
 
 	// traceRentableUnitMap := map[int]string{}
@@ -728,7 +792,7 @@ func loadOneSiteCSV(
 		var canReadData bool
 
 		// check first that for this row's status rentable data can be read
-		canReadData = core.IntegerInSlice(core.RENTABLECSV, csvTypesSet)
+		canReadData = core.IntegerInSlice(core.RENTABLECSV, csvTypesSet) && canLoadRow(rowIndex, core.RENTABLECSV)
 		if canReadData {
 			ReadRentableCSVData(
 				&RentableCSVRecordCount,
@@ -740,6 +804,7 @@ func loadOneSiteCSV(
 				currentTime,
 				userRRValues,
 				&oneSiteFieldMap.RentableCSV,
+				oneSiteFieldMap.Transforms["RentableCSV"],
 				traceTCIDMap,
 				csvErrors,
 				rrUseStatus,
@@ -749,7 +814,8 @@ func loadOneSiteCSV(
 		}
 
 		// check first that for this row's status rental aggrement data can be read
-		canReadData = core.IntegerInSlice(core.RENTALAGREEMENTCSV, csvTypesSet)
+		canReadData = core.IntegerInSlice(core.RENTALAGREEMENTCSV, csvTypesSet) && canLoadRow(rowIndex, core.RENTALAGREEMENTCSV) &&
+			!noPayorRows[rowIndex]
 		if canReadData {
 			ReadRentalAgreementCSVData(
 				&RentalAgreementCSVRecordCount,
@@ -760,9 +826,12 @@ func loadOneSiteCSV(
 				currentTime,
 				userRRValues,
 				&oneSiteFieldMap.RentalAgreementCSV,
+				oneSiteFieldMap.Transforms["RentalAgreementCSV"],
 				traceTCIDMap,
 				csvErrors,
 				csvHeaderMap,
+				oneSiteProfile.RATemplateRules,
+				raTemplates,
 			)
 		}
 	}
@@ -791,7 +860,26 @@ func loadOneSiteCSV(
 		if len(h[i].Fname) > 0 {
 			if !rrDoLoad(ctx, h[i].Fname, h[i].Handler, h[i].TraceDataMap, h[i].DBType) {
 				// INTERNAL ERROR
-				return traceUnitMap, csvErrors, internalErrFlag
+				return traceUnitMap, csvErrors, delta, internalErrFlag
+			}
+		}
+	}
+
+	// ===============================================================
+	// RENEWED AGREEMENTS REPLACE THE STOPPED ONES, DATED CHANGES OF
+	// UNIT ARE ROLLED BACK IF ITS RENEWAL COULD NOT BE LOADED
+	// ===============================================================
+	if delta != nil {
+		failedRenewals := delta.getFailedRenewals(csvErrors)
+		if len(failedRenewals) > 0 {
+			if err = delta.revertUnits(ctx, business.BID, delta.getRowUnits(failedRenewals)); err != nil {
+				rlib.Ulog("INTERNAL ERROR <ONESITE DELTA REVERT>: %s\n", err.Error())
+				return traceUnitMap, csvErrors, delta, internalErrFlag
+			}
+			for _, line := range failedRenewals {
+				errText := "E:<" + core.DBTypeMapStrings[core.DBRentalAgreement] + ">:" +
+					"Renewed agreement could not be loaded, dated changes of unit " + delta.rowUnits[line-1] + " are rolled back"
+				csvErrors[line] = append(csvErrors[line], errText)
 			}
 		}
 	}
@@ -819,7 +907,7 @@ func loadOneSiteCSV(
 	// printMap(csvErrors)
 
 	internalErrFlag = false
-	return traceUnitMap, csvErrors, internalErrFlag
+	return traceUnitMap, csvErrors, delta, internalErrFlag
 }
 
 // rollBackImportOperation func used to clear out the things
@@ -845,6 +933,9 @@ func CSVHandler(
 	testMode int,
 	userRRValues map[string]string,
 	business *rlib.Business,
+	reload bool,
+	htmlReport string,
+	annotatedCSV string,
 	debugMode int,
 ) (string, bool, bool) {
 
@@ -856,6 +947,20 @@ func CSVHandler(
 	// report text
 	csvReport := ""
 
+	// ===== lock business for the whole import =====
+	importLock, err := core.AcquireImportLock(business.Designation)
+	if err != nil {
+		rlib.Ulog("IMPORT LOCK: %s\n", err.Error())
+		csvLoaded = false
+		csvReport = err.Error() + "\n"
+		return csvReport, false, csvLoaded
+	}
+	defer func() {
+		if err := importLock.Release(); err != nil {
+			rlib.Ulog("IMPORT LOCK: %s\n", err.Error())
+		}
+	}()
+
 	// get current timestamp used for creating csv files unique way
 	currentTime := time.Now()
 
@@ -876,20 +981,80 @@ func CSVHandler(
 		core.DBRentalAgreement: {"imported": 0, "possible": 0, "issues": 0},
 	}
 
+	// record of this run in import history
+	importRecord := core.NewImportRecord("onesite", business.Designation, []string{csvPath}, userRRValues, currentTime)
+
+	// ===== business imported before gets the changes only =====
+	deltaImport := false
+	if !reload {
+		n, err := rlib.GetCountBusinessRentables(ctx, business.BID)
+		if err != nil {
+			rlib.Ulog("INTERNAL ERROR <COUNT RENTABLES>: %s\n", err.Error())
+			importRecord.Finish(ctx, business.BID, core.ImportStatusFailed, summaryReportCount, map[int][]string{}, nil)
+			return csvReport, true, csvLoaded
+		}
+		deltaImport = n > 0
+	}
+	if deltaImport {
+		importRecord.Mode = core.ImportModeDelta
+
+		// imported count is taken from business, records which
+		// exist already are not counted as imported
+		if err := core.GetExistingCount(ctx, summaryReportCount, business.BID); err != nil {
+			rlib.Ulog("INTERNAL ERROR <EXISTING RECORDS>: %s\n", err.Error())
+			importRecord.Finish(ctx, business.BID, core.ImportStatusFailed, summaryReportCount, map[int][]string{}, nil)
+			return csvReport, true, csvLoaded
+		}
+	}
+
+	// rows which are not imported as they are, with the reason
+	rowNotes := map[int][]core.RowNote{}
+
+	// templates chosen for agreements, keyed by line
+	raTemplates := map[int]core.RATemplateChoice{}
+
+	// possible duplicates of people, keyed by line
+	duplicates := map[int]core.PersonDuplicate{}
+
 	// ====== Call onesite loader =====
-	unitMap, csvErrs, internalErr := loadOneSiteCSV(ctx,
+	unitMap, csvErrs, delta, internalErr := loadOneSiteCSV(ctx,
 		csvPath, testMode, userRRValues,
-		business, currentTime, currentTimeFormat,
-		summaryReportCount)
+		business, deltaImport, currentTime, currentTimeFormat,
+		summaryReportCount, rowNotes, raTemplates, duplicates, importRecord)
+
+	// dated changes are reverted by undo, report tells what has changed
+	deltaReport := ""
+	if delta != nil {
+		importRecord.Changes = delta.RecordChanges
+		deltaReport = "\n" + core.GetDeltaReport(business, csvPath, delta.Changes)
+	}
+
+	// csv errors are keyed by line, unit map by row index
+	lineUnits := map[int]string{}
+	for rowIndex, unit := range unitMap {
+		lineUnits[rowIndex+1] = unit
+	}
 
 	// if internal error then just return from here, nothing to do
 	if internalErr {
+		importRecord.Finish(ctx, business.BID, core.ImportStatusFailed, summaryReportCount, csvErrs, lineUnits)
 		return csvReport, internalErr, csvLoaded
 	}
 
 	// check if there any errors from onesite loader
 	if len(csvErrs) > 0 {
-		csvReport, csvLoaded = errorReporting(ctx, business, csvErrs, unitMap, summaryReportCount, csvPath, debugMode, currentTime)
+		csvReport, csvLoaded = errorReporting(ctx, business, csvErrs, unitMap, summaryReportCount, raTemplates, duplicates, csvPath, debugMode, currentTime)
+
+		status := core.ImportStatusImported
+		if !csvLoaded {
+			status = core.ImportStatusIssues
+		}
+		importRecord.Finish(ctx, business.BID, status, summaryReportCount, csvErrs, lineUnits)
+		reconcileReport := getReconcileReport(ctx, business, csvPath)
+		csvReport = "Import ID: " + importRecord.ImportID + "\n\n" + csvReport + deltaReport
+		csvReport += "\n" + reconcileReport
+		csvReport += writeHTMLReport(htmlReport, importRecord, csvPath, getKPIReport(csvPath), deltaReport, reconcileReport)
+		csvReport += writeAnnotatedCSV(annotatedCSV, csvPath, unitMap, csvErrs, rowNotes)
 
 		// if not testmode then only do rollback
 		if testMode != 1 {
@@ -900,7 +1065,16 @@ func CSVHandler(
 	}
 
 	// ===== 4. Generate Report =====
-	csvReport = successReport(ctx, business, summaryReportCount, csvPath, debugMode, currentTime)
+	csvReport = successReport(ctx, business, summaryReportCount, raTemplates, csvPath, debugMode, currentTime)
+
+	importRecord.Finish(ctx, business.BID, core.ImportStatusImported, summaryReportCount, csvErrs, lineUnits)
+	csvReport = "Import ID: " + importRecord.ImportID + "\n\n" + csvReport + deltaReport
+
+	// amounts of csv are reconciled with what business holds now
+	reconcileReport := getReconcileReport(ctx, business, csvPath)
+	csvReport += "\n" + reconcileReport
+	csvReport += writeHTMLReport(htmlReport, importRecord, csvPath, getKPIReport(csvPath), deltaReport, reconcileReport)
+	csvReport += writeAnnotatedCSV(annotatedCSV, csvPath, unitMap, csvErrs, rowNotes)
 
 	// ===== 5. Return =====
 	return csvReport, internalErr, csvLoaded
@@ -60,9 +60,12 @@ func ReadPeopleCSVData(
 	csvRow []string,
 	peopleCSVData *[][]string,
 	traceDuplicatePeople map[string][]string,
+	personMatcher *core.PersonMatcher,
+	mergedPeople map[int]core.PersonRecord,
 	currentTimeFormat string,
 	suppliedValues map[string]string,
 	peopleStruct *core.PeopleCSV,
+	transforms core.FieldTransforms,
 	csvErrors map[int][]string,
 	csvHeaderMap map[string]core.CSVHeader,
 ) {
@@ -110,14 +113,35 @@ func ReadPeopleCSVData(
 		}
 	}
 
+	// parse name, flag it if parts may not be correct
+	personName := core.ParsePersonName(rowName, "")
+	if warning := core.GetNameWarning(rowName, personName); warning != "" {
+		csvErrors[rowIndex+1] = append(csvErrors[rowIndex+1], warning)
+	}
+
 	// get csv row data
 	csvRowData := GetPeopleCSVRow(
 		csvRow, peopleStruct,
 		currentTimeFormat,
 		suppliedValues, rowIndex,
-		csvHeaderMap,
+		personName, transforms, csvHeaderMap,
 	)
 
+	// clean up contact values, staff can see the changes in report
+	changes := core.NormalizePeopleCSVRow(csvRowData, suppliedValues["DefaultCountry"])
+	csvErrors[rowIndex+1] = append(csvErrors[rowIndex+1], core.GetNormalizeWarnings(changes)...)
+
+	// merge duplicate people, report the ones which need review
+	record := core.GetPersonRecord(csvRowData, rowIndex, rowIndex+1)
+	if match, ok := personMatcher.Match(record); ok {
+		csvErrors[rowIndex+1] = append(csvErrors[rowIndex+1], personMatcher.GetPersonMatchWarning(match))
+		if personMatcher.IsAutoMerge(match) {
+			mergedPeople[rowIndex] = match.Candidate
+			return
+		}
+	}
+	personMatcher.Add(record)
+
 	*peopleCSVData = append(*peopleCSVData, csvRowData)
 
 	*recordCount = *recordCount + 1
@@ -135,6 +159,8 @@ func GetPeopleCSVRow(
 	timestamp string,
 	DefaultValues map[string]string,
 	rowIndex int,
+	personName core.PersonName,
+	transforms core.FieldTransforms,
 	csvHeaderMap map[string]core.CSVHeader,
 ) []string {
 
@@ -164,16 +190,13 @@ func GetPeopleCSVRow(
 		// this condition has been put here because it's mapping field does not exist
 		// =========================================================
 		if peopleField.Name == "LastName" {
-			nameSlice := strings.Split(oneSiteRow[csvHeaderMap["Name"].Index], ",")
-			dataMap[i] = strings.TrimSpace(nameSlice[0])
+			dataMap[i] = personName.LastNameWithSuffix()
 		}
 		if peopleField.Name == "FirstName" {
-			nameSlice := strings.Split(oneSiteRow[csvHeaderMap["Name"].Index], ",")
-			if len(nameSlice) > 1 {
-				dataMap[i] = strings.TrimSpace(nameSlice[1])
-			} else {
-				dataMap[i] = ""
-			}
+			dataMap[i] = personName.First
+		}
+		if peopleField.Name == "MiddleName" {
+			dataMap[i] = personName.Middle
 		}
 		// Special notes for people to get TCID in future with below value
 		if peopleField.Name == "Notes" {
@@ -195,6 +218,10 @@ func GetPeopleCSVRow(
 		}
 	}
 
+	// fields which have transforms in mapper take their values from them,
+	// transforms of FirstName, MiddleName and LastName replace parsed name
+	transforms.Apply(reflectedPeopleFieldMap.Type(), dataMap, oneSiteRow, csvHeaderMap)
+
 	dataArray := []string{}
 
 	for i := 0; i < pplLength; i++ {
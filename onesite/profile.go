@@ -0,0 +1,36 @@
+package onesite
+
+import (
+	"encoding/json"
+	"importers/core"
+	"io/ioutil"
+)
+
+// Profile holds the site specific rules of onesite importer
+// which are kept out of the go code, loaded from profile.json
+type Profile struct {
+	RATemplateRules []core.RATemplateRule
+}
+
+// loadProfile reads profile json file and compiles the rules
+// defined in it so they are ready to use while reading rows
+func loadProfile(profileFilePath string) (Profile, error) {
+	var profile Profile
+
+	data, err := ioutil.ReadFile(profileFilePath)
+	if err != nil {
+		return profile, err
+	}
+
+	err = json.Unmarshal(data, &profile)
+	if err != nil {
+		return profile, err
+	}
+
+	err = core.CompileRATemplateRules(profile.RATemplateRules)
+	if err != nil {
+		return profile, err
+	}
+
+	return profile, nil
+}
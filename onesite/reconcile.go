@@ -0,0 +1,119 @@
+package onesite
+
+import (
+	"context"
+	"errors"
+	"importers/core"
+	"rentroll/rlib"
+	"strings"
+	"time"
+)
+
+// oneSiteAsOfPrefix is the text before the date of report in its title rows
+const oneSiteAsOfPrefix = "as of date:"
+
+// getOneSiteAsOfDate returns date as of which report is made,
+// it is today if title rows don't have it
+func getOneSiteAsOfDate(t [][]string, skipRowsCount int) time.Time {
+	for rowIndex := 0; rowIndex < skipRowsCount && rowIndex < len(t); rowIndex++ {
+		for _, cell := range t[rowIndex] {
+			text := strings.TrimSpace(cell)
+			if !strings.HasPrefix(strings.ToLower(text), oneSiteAsOfPrefix) {
+				continue
+			}
+			if d, err := time.Parse("01/02/2006", strings.TrimSpace(text[len(oneSiteAsOfPrefix):])); err == nil {
+				return d
+			}
+		}
+	}
+	return time.Now()
+}
+
+// getOneSiteAmount returns amount of header in row, amounts marked
+// with "*" are not in the totals of report so they are not counted
+func getOneSiteAmount(row []string, csvHeaderMap map[string]core.CSVHeader, name string) float64 {
+	value := getOneSiteCell(row, csvHeaderMap, name)
+	if strings.HasSuffix(value, "*") {
+		return 0
+	}
+	// invalid amounts are reported by import
+	amount, _ := core.ParseAmount(value)
+	return amount
+}
+
+// getOneSiteAmounts returns amounts of row which are reconciled
+func getOneSiteAmounts(row []string, csvHeaderMap map[string]core.CSVHeader) core.ReconcileAmounts {
+	// lease rent is the rent of lease, rent charge is taken if it is not there
+	contractRent := "LeaseRent"
+	if csvHeaderMap[contractRent].Index == -1 {
+		contractRent = "Rent"
+	}
+	return core.ReconcileAmounts{
+		MarketRent:       getOneSiteAmount(row, csvHeaderMap, "MarketAddl"),
+		ContractRent:     getOneSiteAmount(row, csvHeaderMap, contractRent),
+		RecurringCharges: getOneSiteAmount(row, csvHeaderMap, "TotalBilling"),
+	}
+}
+
+// getOneSiteReconciliation sums amounts of data rows of onesite csv by
+// unit, totals of report are read from the rows after data
+func getOneSiteReconciliation(
+	t [][]string,
+	skipRowsCount int,
+	csvHeaderList []core.CSVHeader,
+	csvHeaderMap map[string]core.CSVHeader,
+) *core.Reconciliation {
+	r := core.NewReconciliation(getOneSiteAsOfDate(t, skipRowsCount))
+	r.MarketRent = csvHeaderMap["MarketAddl"].Index != -1
+	// total billing holds rent with the other charges, it is not the
+	// same as recurring assessments so its total is only shown
+	r.RecurringCharges = false
+
+	rowIndex := skipRowsCount
+	for ; rowIndex < len(t); rowIndex++ {
+		if isOneSiteBlankRow(t[rowIndex], csvHeaderList) {
+			break
+		}
+
+		unitName := getOneSiteCell(t[rowIndex], csvHeaderMap, "Unit")
+		if unitName == "" {
+			continue
+		}
+		r.GetUnit(unitName).Source.Add(getOneSiteAmounts(t[rowIndex], csvHeaderMap))
+	}
+
+	// summary of report starts with "Totals:" row
+	for ; rowIndex < len(t); rowIndex++ {
+		if len(t[rowIndex]) > 0 && strings.HasPrefix(strings.ToLower(strings.TrimSpace(t[rowIndex][0])), "totals") {
+			totals := getOneSiteAmounts(t[rowIndex], csvHeaderMap)
+			r.SourceTotals = &totals
+			break
+		}
+	}
+
+	return r
+}
+
+// readOneSiteReconciliation reads amounts of onesite csv by unit
+func readOneSiteReconciliation(oneSiteCSV string) (*core.Reconciliation, error) {
+	t, skipRowsCount, csvHeaderList, csvHeaderMap, err := readOneSiteCSV(oneSiteCSV)
+	if err != nil {
+		return nil, err
+	}
+
+	r := getOneSiteReconciliation(t, skipRowsCount, csvHeaderList, csvHeaderMap)
+	if len(r.Units) == 0 {
+		return r, errors.New("There are no data rows present")
+	}
+	return r, nil
+}
+
+// getReconcileReport returns report comparing amounts of csv
+// with amounts business holds after import
+func getReconcileReport(ctx context.Context, business *rlib.Business, csvPath string) string {
+	r, err := readOneSiteReconciliation(csvPath)
+	if err != nil {
+		return "Unable to reconcile amounts: " + err.Error() + "\n"
+	}
+	return core.GetReconcileReport(ctx, business, csvPath, r)
+}
@@ -65,6 +65,7 @@ func ReadRentableCSVData(
 	currentTime time.Time,
 	suppliedValues map[string]string,
 	rentableStruct *core.RentableCSV,
+	transforms core.FieldTransforms,
 	traceTCIDMap map[int]string,
 	csvErrors map[int][]string,
 	rrStatus string,
@@ -104,7 +105,7 @@ func ReadRentableCSVData(
 	// get csv row data
 	csvRowData := GetRentableCSVRow(
 		csvRow, rentableStruct,
-		rentableDefaultData, csvHeaderMap,
+		rentableDefaultData, transforms, csvHeaderMap,
 	)
 
 	// get unit from the onesite row
@@ -155,6 +156,7 @@ func GetRentableCSVRow(
 	oneSiteRow []string,
 	fieldMap *core.RentableCSV,
 	DefaultValues map[string]string,
+	transforms core.FieldTransforms,
 	csvHeaderMap map[string]core.CSVHeader,
 ) []string {
 
@@ -209,6 +211,9 @@ func GetRentableCSVRow(
 		}
 	}
 
+	// fields which have transforms in mapper take their values from them
+	transforms.Apply(reflectedRentableFieldMap.Type(), dataMap, oneSiteRow, csvHeaderMap)
+
 	dataArray := []string{}
 
 	for i := 0; i < rRTLength; i++ {
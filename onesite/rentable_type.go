@@ -65,6 +65,7 @@ func ReadRentableTypeCSVData(
 	currentTime time.Time,
 	suppliedValues map[string]string,
 	rentableTypeStruct *core.RentableTypeCSV,
+	transforms core.FieldTransforms,
 	customAttributesRefData map[string]CARD,
 	csvHeaderMap map[string]core.CSVHeader,
 	business *rlib.Business,
@@ -113,7 +114,7 @@ func ReadRentableTypeCSVData(
 	csvRowData := GetRentableTypeCSVRow(
 		csvRow, rentableTypeStruct,
 		rentableTypeDefaultData,
-		csvHeaderMap,
+		transforms, csvHeaderMap,
 	)
 
 	*rentableTypeCSVData = append(*rentableTypeCSVData, csvRowData)
@@ -131,6 +132,7 @@ func GetRentableTypeCSVRow(
 	oneSiteRow []string,
 	fieldMap *core.RentableTypeCSV,
 	DefaultValues map[string]string,
+	transforms core.FieldTransforms,
 	csvHeaderMap map[string]core.CSVHeader,
 ) []string {
 
@@ -172,6 +174,10 @@ func GetRentableTypeCSVRow(
 		}
 	}
 
+	// fields which have transforms in mapper take their values from them,
+	// transform of MarketRate replaces the conversion above
+	transforms.Apply(reflectedRentableTypeFieldMap.Type(), dataMap, oneSiteRow, csvHeaderMap)
+
 	dataArray := []string{}
 
 	for i := 0; i < rRTLength; i++ {
@@ -64,9 +64,12 @@ func ReadRentalAgreementCSVData(
 	currentTime time.Time,
 	suppliedValues map[string]string,
 	rentalAgreementStruct *core.RentalAgreementCSV,
+	transforms core.FieldTransforms,
 	traceTCIDMap map[int]string,
 	csvErrors map[int][]string,
 	csvHeaderMap map[string]core.CSVHeader,
+	raTemplateRules []core.RATemplateRule,
+	raTemplates map[int]core.RATemplateChoice,
 ) {
 
 	currentYear, currentMonth, currentDate := currentTime.Date()
@@ -98,10 +101,20 @@ func ReadRentalAgreementCSVData(
 		)
 	}
 
+	// template of agreement is chosen by the rules of profile
+	template, rule := core.ChooseRATemplate(raTemplateRules, getRATemplateAgreement(csvRow, csvHeaderMap))
+	rentableDefaultData["RATemplateName"] = template
+	raTemplates[rowIndex+1] = core.RATemplateChoice{
+		Unit:     getOneSiteCell(csvRow, csvHeaderMap, "Unit"),
+		Payor:    getOneSiteCell(csvRow, csvHeaderMap, "Name"),
+		Template: template,
+		Rule:     rule,
+	}
+
 	// get csv row data
 	csvRowData := GetRentalAgreementCSVRow(
 		csvRow, rentalAgreementStruct,
-		rentableDefaultData, csvHeaderMap,
+		rentableDefaultData, transforms, csvHeaderMap,
 	)
 
 	// add this row data to slice
@@ -117,12 +130,27 @@ func ReadRentalAgreementCSVData(
 
 }
 
+// getRATemplateAgreement returns what template rules match on of row,
+// onesite report doesn't tell whether payor is a company
+func getRATemplateAgreement(csvRow []string, csvHeaderMap map[string]core.CSVHeader) core.RATemplateAgreement {
+	return core.RATemplateAgreement{
+		Unit:      getOneSiteCell(csvRow, csvHeaderMap, "UnitDesignation"),
+		FloorPlan: getOneSiteCell(csvRow, csvHeaderMap, "FloorPlan"),
+		Status:    getOneSiteCell(csvRow, csvHeaderMap, "UnitLeaseStatus"),
+		TermDays: core.GetLeaseTermDays(
+			getOneSiteCell(csvRow, csvHeaderMap, "LeaseStart"),
+			getOneSiteCell(csvRow, csvHeaderMap, "LeaseEnd"),
+		),
+	}
+}
+
 // GetRentalAgreementCSVRow used to create RentalAgreement
 // csv row from onesite csv
 func GetRentalAgreementCSVRow(
 	oneSiteRow []string,
 	fieldMap *core.RentalAgreementCSV,
 	DefaultValues map[string]string,
+	transforms core.FieldTransforms,
 	csvHeaderMap map[string]core.CSVHeader,
 ) []string {
 
@@ -172,6 +200,10 @@ func GetRentalAgreementCSVRow(
 		}
 	}
 
+	// fields which have transforms in mapper take their values from them,
+	// transforms of PayorSpec, UserSpec and RentableSpec replace the specs made above
+	transforms.Apply(reflectedRentalAgreementFieldMap.Type(), dataMap, oneSiteRow, csvHeaderMap)
+
 	dataArray := []string{}
 
 	for i := 0; i < rRTLength; i++ {
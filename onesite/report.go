@@ -86,7 +86,9 @@ func generateSummaryReport(
 	if err != nil {
 		rlib.Ulog("generateSummaryReport: error = %s", err.Error())
 	}
-	return s
+
+	// kpis of csv tell at a glance whether import looks right
+	return s + "\n" + getKPIReport(csvFile)
 }
 
 // generateDetailedReport gives detailed report with (rowNumber, unit, db type, reason)
@@ -226,6 +228,7 @@ func generateRCSVReport(
 	ctx context.Context,
 	business *rlib.Business,
 	summaryCount map[int]map[string]int,
+	raTemplates map[int]core.RATemplateChoice,
 	csvFile string,
 ) string {
 
@@ -252,6 +255,9 @@ func generateRCSVReport(
 		rcsvReport += "\n"
 	}
 
+	// template chosen by rules of profile for each agreement
+	rcsvReport += core.GetRATemplateReport(raTemplates)
+
 	return rcsvReport
 }
 
@@ -260,6 +266,7 @@ func successReport(
 	ctx context.Context,
 	business *rlib.Business,
 	summaryCount map[int]map[string]int,
+	raTemplates map[int]core.RATemplateChoice,
 	csvFile string,
 	debugMode int,
 	currentTime time.Time,
@@ -273,7 +280,7 @@ func successReport(
 
 	// csv report for all types if testmode is on
 	if debugMode == 1 {
-		report += generateRCSVReport(ctx, business, summaryCount, csvFile)
+		report += generateRCSVReport(ctx, business, summaryCount, raTemplates, csvFile)
 	}
 
 	// return
@@ -287,6 +294,8 @@ func errorReporting(
 	csvErrors map[int][]string,
 	unitMap map[int]string,
 	summaryCount map[int]map[string]int,
+	raTemplates map[int]core.RATemplateChoice,
+	duplicates map[int]core.PersonDuplicate,
 	csvFile string,
 	debugMode int,
 	currentTime time.Time,
@@ -299,6 +308,12 @@ func errorReporting(
 	detailedReport, csvReportGenerate := generateDetailedReport(csvErrors, unitMap, summaryCount)
 	detailedReport += "\n"
 
+	// people which may be duplicates, with their scores
+	if len(duplicates) > 0 {
+		detailedReport += core.GetPersonDuplicateReport(duplicates)
+		detailedReport += "\n"
+	}
+
 	// append summary report
 	errReport += generateSummaryReport(ctx, summaryCount, business.BID, currentTime, csvFile)
 	errReport += "\n"
@@ -309,9 +324,29 @@ func errorReporting(
 	// if true then generate csv report
 	// specia case: when there are only warnings but no errors
 	if csvReportGenerate && debugMode == 1 {
-		errReport += generateRCSVReport(ctx, business, summaryCount, csvFile)
+		errReport += generateRCSVReport(ctx, business, summaryCount, raTemplates, csvFile)
 	}
 
 	// return
 	return errReport, csvReportGenerate
 }
+
+// writeHTMLReport writes html report of import if path of it is given,
+// it returns the line which tells where report is for text report
+func writeHTMLReport(htmlReport string, importRecord *core.ImportRecord, csvFile string, sections ...string) string {
+	if htmlReport == "" {
+		return ""
+	}
+
+	// rows of issues are shown under header of csv
+	headerLines := []int{}
+	if _, skipRowsCount, _, _, err := readOneSiteCSV(csvFile); err == nil {
+		headerLines = append(headerLines, skipRowsCount)
+	}
+
+	if err := core.WriteHTMLReport(htmlReport, importRecord, headerLines, sections...); err != nil {
+		rlib.Ulog("Error <HTML REPORT>: %s\n", err.Error())
+		return "\nUnable to write HTML report " + htmlReport + ": " + err.Error() + "\n"
+	}
+	return "\nHTML report: " + htmlReport + "\n"
+}
@@ -0,0 +1,290 @@
+package onesite
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"importers/core"
+	"io/ioutil"
+	"os"
+	"path"
+	"rentroll/rlib"
+	"strings"
+
+	"github.com/kardianos/osext"
+)
+
+// allSubpropertiesText is found in parameters line of onesite csv
+// which has been exported for all subproperties
+const allSubpropertiesText = "allsubproperties"
+
+// PropertyRule assigns the properties matched with pattern to a business,
+// pattern is in path.Match syntax e.g.; "6301", "*VIL", "*". Name is the
+// name of business which is created for BUD.
+type PropertyRule struct {
+	Property string
+	BUD      string
+	Name     string
+}
+
+// PropertyMap holds the rules loaded from property map json file,
+// first matched rule is taken for a property
+type PropertyMap struct {
+	Properties []PropertyRule
+}
+
+// PropertyCSV holds the part of onesite csv which belongs to one business
+type PropertyCSV struct {
+	BUD        string
+	Name       string   // name of business from property map, first property if blank
+	Properties []string // properties found in csv for this business
+	CSVPath    string   // splitted csv file
+	RowCount   int
+}
+
+// GetPropertyMap reads json file which maps properties of onesite csv to BUD
+func GetPropertyMap(propertyMapFilePath string) (PropertyMap, error) {
+	var propertyMap PropertyMap
+
+	data, err := ioutil.ReadFile(propertyMapFilePath)
+	if err != nil {
+		return propertyMap, err
+	}
+	err = json.Unmarshal(data, &propertyMap)
+	if err != nil {
+		return propertyMap, err
+	}
+
+	for _, rule := range propertyMap.Properties {
+		if _, err := path.Match(rule.Property, ""); err != nil {
+			return propertyMap, fmt.Errorf("Invalid property pattern %q: %s", rule.Property, err.Error())
+		}
+		if rule.BUD == "" {
+			return propertyMap, fmt.Errorf("BUD is missing for property %q", rule.Property)
+		}
+	}
+	return propertyMap, nil
+}
+
+// getRule returns the first rule matched with property
+func (m PropertyMap) getRule(property string) (PropertyRule, bool) {
+	for _, rule := range m.Properties {
+		ok, _ := path.Match(strings.ToLower(rule.Property), strings.ToLower(property))
+		if ok {
+			return rule, true
+		}
+	}
+	return PropertyRule{}, false
+}
+
+// getSectionRule returns rule of property named in section header,
+// section header must name the business or the property of a rule
+func (m PropertyMap) getSectionRule(property string) (PropertyRule, bool) {
+	for _, rule := range m.Properties {
+		if strings.EqualFold(rule.Name, property) || strings.EqualFold(rule.Property, property) {
+			return rule, true
+		}
+	}
+	return PropertyRule{}, false
+}
+
+// IsAllSubpropertiesCSV checks that parameters line of onesite csv
+// says it has been exported for all subproperties
+func IsAllSubpropertiesCSV(csvPath string) bool {
+	t := rlib.LoadCSV(csvPath)
+	for _, row := range t {
+		for _, cell := range row {
+			text := strings.ToLower(core.SpecialCharsReplacer.Replace(cell))
+			if strings.HasPrefix(text, "parameters") && strings.Contains(text, allSubpropertiesText) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// getUnitProperty returns property of unit from bldg prefix,
+// e.g.; "6301" for "6301-001", blank if unit has no prefix
+func getUnitProperty(unit string) string {
+	i := strings.Index(unit, "-")
+	if i <= 0 {
+		return ""
+	}
+	return strings.TrimSpace(unit[:i])
+}
+
+// getSectionProperty returns property from row which looks like section
+// header as it has only first cell filled, like "Property: Isola Bella",
+// ok is false if row is not like a section header. Notes of report look
+// the same, so property must be found in property map.
+func getSectionProperty(row []string) (string, bool) {
+	if len(row) == 0 || strings.TrimSpace(row[0]) == "" {
+		return "", false
+	}
+	for _, cell := range row[1:] {
+		if strings.TrimSpace(cell) != "" {
+			return "", false
+		}
+	}
+
+	property := strings.TrimSpace(row[0])
+	if i := strings.Index(property, ":"); i >= 0 && strings.EqualFold(strings.TrimSpace(property[:i]), "property") {
+		property = strings.TrimSpace(property[i+1:])
+	}
+	return property, true
+}
+
+// SplitCSVByProperty splits onesite csv exported for all subproperties into
+// one csv file per business, property of each row is taken from last section
+// header or bldg prefix of unit. Each splitted csv keeps top lines and headers
+// of original csv so that it can be imported the same way. Rows which look
+// like section header but are not found in property map are skipped, the
+// warnings tell about them.
+func SplitCSVByProperty(csvPath string, propertyMap PropertyMap, timestamp string) ([]PropertyCSV, []string, error) {
+	propertyCSVs := []PropertyCSV{}
+	warnings := []string{}
+
+	folderPath, err := osext.ExecutableFolder()
+	if err != nil {
+		return propertyCSVs, warnings, err
+	}
+
+	csvHeaderList, err := core.GetCSVHeaders(path.Join(folderPath, "header.json"))
+	if err != nil {
+		return propertyCSVs, warnings, err
+	}
+	csvHeaderMap := map[string]core.CSVHeader{}
+	for _, header := range csvHeaderList {
+		csvHeaderMap[header.Name] = header
+	}
+	unitHeader := csvHeaderMap["Unit"]
+
+	t := rlib.LoadCSV(csvPath)
+
+	// find headers line and column of unit
+	headerRowIndex, unitColIndex := -1, -1
+	for rowIndex := 0; rowIndex < len(t) && headerRowIndex == -1; rowIndex++ {
+		for colIndex, cell := range t[rowIndex] {
+			if strings.ToLower(core.SpecialCharsReplacer.Replace(cell)) == unitHeader.HeaderText {
+				headerRowIndex, unitColIndex = rowIndex, colIndex
+				break
+			}
+		}
+	}
+	if headerRowIndex == -1 {
+		return propertyCSVs, warnings, fmt.Errorf("Unable to find %s column in %s", unitHeader.Name, csvPath)
+	}
+
+	// rows of each BUD in the order they are found
+	budRows := map[string][][]string{}
+	budProperties := map[string][]string{}
+	budNames := map[string]string{}
+	buds := []string{}
+	unmapped := []string{}
+	section := ""
+	var sectionRule PropertyRule
+
+	for rowIndex := headerRowIndex + 1; rowIndex < len(t); rowIndex++ {
+		row := t[rowIndex]
+
+		blank := true
+		for _, cell := range row {
+			if strings.TrimSpace(cell) != "" {
+				blank = false
+				break
+			}
+		}
+		if blank {
+			continue
+		}
+
+		if property, ok := getSectionProperty(row); ok {
+			rule, found := propertyMap.getSectionRule(property)
+			if !found {
+				warnings = append(warnings, fmt.Sprintf("Line %d: %q is not a property of property map, row is skipped", rowIndex+1, property))
+				continue
+			}
+			section, sectionRule = property, rule
+			continue
+		}
+
+		unit := ""
+		if unitColIndex < len(row) {
+			unit = strings.TrimSpace(row[unitColIndex])
+		}
+		// totals of section or file are not the data
+		if strings.HasPrefix(strings.ToLower(unit), "total") {
+			continue
+		}
+
+		// rule of section is known already
+		property, rule := section, sectionRule
+		if property == "" {
+			property = getUnitProperty(unit)
+			if property == "" {
+				return propertyCSVs, warnings, fmt.Errorf("Unable to find property of unit %q at line %d", unit, rowIndex+1)
+			}
+
+			var ok bool
+			if rule, ok = propertyMap.getRule(property); !ok {
+				if !core.StringInSlice(property, unmapped) {
+					unmapped = append(unmapped, property)
+				}
+				continue
+			}
+		}
+
+		bud := rule.BUD
+		if _, ok := budRows[bud]; !ok {
+			buds = append(buds, bud)
+			budNames[bud] = rule.Name
+			if budNames[bud] == "" {
+				budNames[bud] = property
+			}
+		}
+		budRows[bud] = append(budRows[bud], row)
+		if !core.StringInSlice(property, budProperties[bud]) {
+			budProperties[bud] = append(budProperties[bud], property)
+		}
+	}
+
+	if len(unmapped) > 0 {
+		return propertyCSVs, warnings, fmt.Errorf("No BUD is mapped for properties: %s", strings.Join(unmapped, ", "))
+	}
+
+	// write csv for each BUD
+	for _, bud := range buds {
+		fileName := "property_" + bud + "_" + timestamp + ".csv"
+		filePath := path.Join(TempCSVStore, fileName)
+
+		f, err := os.Create(filePath)
+		if err != nil {
+			return propertyCSVs, warnings, err
+		}
+
+		w := csv.NewWriter(f)
+		// top lines and headers as they are
+		for rowIndex := 0; rowIndex <= headerRowIndex; rowIndex++ {
+			w.Write(t[rowIndex])
+		}
+		for _, row := range budRows[bud] {
+			w.Write(row)
+		}
+		w.Flush()
+		f.Close()
+
+		if err = w.Error(); err != nil {
+			return propertyCSVs, warnings, err
+		}
+
+		propertyCSVs = append(propertyCSVs, PropertyCSV{
+			BUD:        bud,
+			Name:       budNames[bud],
+			Properties: budProperties[bud],
+			CSVPath:    filePath,
+			RowCount:   len(budRows[bud]),
+		})
+	}
+
+	return propertyCSVs, warnings, nil
+}
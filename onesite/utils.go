@@ -132,3 +132,85 @@ func parseLineAndErrorFromRCSV(rcsvErr error, dbType int) (int, int, string, boo
 func getPeopleNoteString(rowIndex int, currentTime string) string {
 	return onesiteNotesPrefix + currentTime + "$" + strconv.Itoa(rowIndex)
 }
+
+// GetBusinessName returns the name of property from the title of onesite report,
+// e.g.; "Isola Bella Apartments" for "Accord/OKC Members, LLC - Isola Bella Apartments"
+func GetBusinessName(csvPath string) string {
+	title := core.GetReportTitle(rlib.LoadCSV(csvPath))
+	if i := strings.LastIndex(title, " - "); i >= 0 {
+		return strings.TrimSpace(title[i+3:])
+	}
+	return title
+}
+
+// detectOneSiteHeaders looks for the header line in csv data and
+// sets index of each header found, it returns count of rows to skip
+// before data rows or 0 if headers are not found
+func detectOneSiteHeaders(t [][]string, csvHeaderList []core.CSVHeader) int {
+	for rowIndex := 0; rowIndex < len(t); rowIndex++ {
+		for colIndex := 0; colIndex < len(t[rowIndex]); colIndex++ {
+			// remove all white spaces and make lower case
+			cellTextValue := strings.ToLower(
+				core.SpecialCharsReplacer.Replace(t[rowIndex][colIndex]))
+
+			// ********************************
+			// MARKET RENT OR MARKET ADDL
+			// ********************************
+			// if marketRent found then remove marketAddl header
+			// and make an entry for "marketrent" in csvColumnFieldMap with -1
+			// keep "MarketAddl" mapping to `marketrent` still, anyways `MarketAddl`
+			// going to be put in `MarketRate` of Rentroll field
+			if cellTextValue == marketRent {
+				for i := range csvHeaderList {
+					if csvHeaderList[i].HeaderText == "marketaddl" {
+						csvHeaderList[i].HeaderText = marketRent
+						csvHeaderList[i].Name = "MarketAddl"
+					}
+				}
+			}
+			// assign column index in struct if header text match from cell data
+			for i := range csvHeaderList {
+				if csvHeaderList[i].HeaderText == cellTextValue {
+					csvHeaderList[i].Index = colIndex
+				}
+			}
+		}
+
+		// check after row columns parsing that headers are found or not
+		headersFound := true
+		for i := range csvHeaderList {
+			if csvHeaderList[i].Index == -1 && !csvHeaderList[i].IsOptional {
+				headersFound = false
+				break
+			}
+		}
+
+		if headersFound {
+			// data starts from next row
+			return rowIndex + 1
+		}
+	}
+	return 0
+}
+
+// isOneSiteBlankRow checks all the header columns of row are blank,
+// data of onesite csv ends at the first blank row
+func isOneSiteBlankRow(row []string, csvHeaderList []core.CSVHeader) bool {
+	// blank cell values count
+	blankCellCount := 0
+
+	// unavailable fields in csv data
+	unavailableFields := 0
+
+	for _, header := range csvHeaderList {
+		if header.Index == -1 { // if not available
+			unavailableFields++
+		} else { // if available
+			if header.Index >= len(row) || row[header.Index] == "" { // if data is blank
+				blankCellCount++
+			}
+		}
+	}
+
+	return blankCellCount+unavailableFields == len(csvHeaderList)
+}
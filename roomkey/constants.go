@@ -27,6 +27,7 @@ var prefixCSVFile = map[string]string{
 	"people":           "people_",
 	"rental_agreement": "rentalAgreement_",
 	"rentable":         "rentable_",
+	"custom_attribute": "customAttribute_",
 }
 
 // RoomKeyOnlineRentableStatus is rentroll rentable status for online
@@ -55,6 +56,7 @@ const (
 var csvRecordsSkipList = []string{
 	rcsv.DupTransactant,
 	rcsv.DupRentableType,
+	rcsv.DupCustomAttribute,
 	rcsv.DupRentable,
 	rcsv.RentableAlreadyRented,
 }
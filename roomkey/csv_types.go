@@ -5,33 +5,27 @@ import (
 	"strings"
 )
 
-// by which index, it will decide type of row
-var rowTypeDetectionCSVIndex = map[string]int{
-	"page":        0,
-	"description": 2,
-}
-
 // loadRoomKeyCSVRow used to load data from slice
-// into CSVRow struct and return that struct
+// into CSVRow struct and return that struct,
+// data is picked from the columns detected for the page
 func loadRoomKeyCSVRow(csvHeaderMap map[string]core.CSVHeader,
-	data []string, isPageZero bool) (bool, []string) {
+	data []string, layout roomKeyPageLayout) (bool, []string) {
 
 	skipRow := false
 
-	csvRow := make([]string, len(data))
+	csvRow := make([]string, len(csvHeaderMap))
 
 	for _, header := range csvHeaderMap {
-		if header.Index == -1 && !header.IsOptional {
-			skipRow = true
-			return skipRow, csvRow
+		col, ok := layout.DataColumns[header.Name]
+		if !ok {
+			if header.Name != "Description" && !header.IsOptional {
+				skipRow = true
+				return skipRow, csvRow
+			}
+			continue
 		}
-	}
-
-	for _, header := range csvHeaderMap {
-		if isPageZeroData(isPageZero, header) {
-			csvRow[header.Index] = data[header.Index+3]
-		} else {
-			csvRow[header.Index] = data[header.Index]
+		if col < len(data) {
+			csvRow[header.Index] = data[col]
 		}
 	}
 
@@ -49,82 +43,124 @@ func loadRoomKeyCSVRow(csvHeaderMap map[string]core.CSVHeader,
 	return skipRow, csvRow
 }
 
-// check that row is headerline
-func isRoomKeyHeaderLine(rowHeaders []string, isPageZero bool,
-	headerList []core.CSVHeader) (bool, map[string]core.CSVHeader) {
+// check that row is headerline, it returns the column
+// of each header text found in the row
+func isRoomKeyHeaderLine(rowHeaders []string,
+	headerList []core.CSVHeader) (bool, map[string]int) {
 
-	csvHeaderList := make([]core.CSVHeader, 0)
-	for _, header := range headerList {
-		csvHeaderList = append(csvHeaderList, header)
-	}
+	headerColumns := map[string]int{}
 
 	for colIndex := 0; colIndex < len(rowHeaders); colIndex++ {
 		// remove all white spaces and make lower case
 		cellTextValue := strings.ToLower(
 			core.SpecialCharsReplacer.Replace(rowHeaders[colIndex]))
 
-		// assign column index in struct if header text match from cell data
-		for i := range csvHeaderList {
-
-			// here we need to set index explicitly
-			// because there will be no header with name "description" in csv
-			if csvHeaderList[i].HeaderText == "description" {
-				csvHeaderList[i].Index = 2
-				continue
-			}
-
-			if csvHeaderList[i].HeaderText == cellTextValue {
-				if csvHeaderList[i].HeaderText == "datein" {
-					csvHeaderList[i].Index = colIndex + 1
-					continue
-				}
-				// we take colIndex-3 if it is data of page 0
-				// because there are 3 blank columns
-				if isPageZeroData(isPageZero, csvHeaderList[i]) {
-					csvHeaderList[i].Index = colIndex - 3
-					continue
-				}
-				csvHeaderList[i].Index = colIndex
+		// assign column index if header text match from cell data
+		for _, header := range headerList {
+			if header.HeaderText == cellTextValue {
+				headerColumns[header.Name] = colIndex
 			}
 		}
 	}
 
 	// check after row columns parsing that headers are found or not
+	// there will be no header with name "description" in csv,
+	// it's column is detected with page layout
 	headersFound := true
-	for i := range csvHeaderList {
-		if csvHeaderList[i].Index == -1 && !csvHeaderList[i].IsOptional {
+	for _, header := range headerList {
+		if header.Name == "Description" {
+			continue
+		}
+		if _, ok := headerColumns[header.Name]; !ok && !header.IsOptional {
 			headersFound = false
 			break
 		}
 	}
 
-	csvHeaderMap := map[string]core.CSVHeader{}
-	for _, header := range csvHeaderList {
-		csvHeaderMap[header.Name] = header
-	}
-	return headersFound, csvHeaderMap
+	return headersFound, headerColumns
 }
 
-// isPageZeroData checks if the row supplied belongs to page 0 or not
-func isPageZeroData(isPageZero bool, header core.CSVHeader) bool {
-	if isPageZero && (header.HeaderText == "room" ||
-		header.HeaderText == "roomtype" ||
-		header.HeaderText == "rate" ||
-		header.HeaderText == "ratename" ||
-		header.HeaderText == "groupcorporatename") {
-
-		return true
-	}
-	return false
+// isRoomKeyPageRow check row is used for new page records
+func isRoomKeyPageRow(data []string, rules LayoutRules) bool {
+	// if page column is not empty then it is
+	return rules.PageColumn < len(data) &&
+		strings.TrimSpace(data[rules.PageColumn]) != ""
 }
 
-// isRoomKeyPageRow check row is used for new page records
-func isRoomKeyPageRow(data []string) bool {
-	// if first column is not empty then it is
-	return strings.TrimSpace(data[rowTypeDetectionCSVIndex["page"]]) != ""
+func isRoomKeyDescriptionRow(data []string, layout roomKeyPageLayout) bool {
+	// if description column is not empty then it is
+	return layout.DescriptionColumn < len(data) &&
+		strings.TrimSpace(data[layout.DescriptionColumn]) != ""
 }
 
-func isRoomKeyDescriptionRow(data []string) bool {
-	// if third column is not empty then it is
-	return strings.TrimSpace(data[rowTypeDetectionCSVIndex["description"]]) != ""
+// readRoomKeyCSVRows reads data rows of all pages keyed by line of csv,
+// layout of each page is detected at its header line and description
+// rows are joined to the data row above them
+func readRoomKeyCSVRows(
+	t [][]string,
+	csvHeaderList []core.CSVHeader,
+	csvHeaderMap map[string]core.CSVHeader,
+	profile Profile,
+	csvErrors map[int][]string,
+) map[int][]string {
+
+	// this holds the records for each row index
+	csvRowDataMap := map[int][]string{}
+
+	// this will be helpful while we have "description" type of row
+	// so that we can put it in currentDataRowIndex's csvRow
+	currentDataRowIndex := 0
+
+	headersFirstOccurenceFound := false
+
+	// layout of current page, detected at each header line
+	pageLayout := roomKeyPageLayout{}
+	pageNo := 0
+
+	for rowIndex := 1; rowIndex <= len(t); rowIndex++ {
+
+		// if it is header line then detect layout of the page and skip it
+		if ok, headerColumns := isRoomKeyHeaderLine(t[rowIndex-1], csvHeaderList); ok {
+			pageLayout = detectRoomKeyPageLayout(t, rowIndex-1, headerColumns, profile.Layout)
+			if len(pageLayout.LowConfidence) > 0 {
+				csvErrors[rowIndex] = append(csvErrors[rowIndex], getLayoutWarning(pageNo, pageLayout))
+			}
+			headersFirstOccurenceFound = true
+
+			continue
+		}
+
+		// if first time headers are not detected then do continue
+		if !headersFirstOccurenceFound {
+			continue
+		}
+
+		// check it is page row
+		if isRoomKeyPageRow(t[rowIndex-1], profile.Layout) {
+			pageNo++
+			continue
+		}
+
+		// check it is description row
+		if isRoomKeyDescriptionRow(t[rowIndex-1], pageLayout) {
+			if _, ok := csvRowDataMap[currentDataRowIndex]; ok {
+				csvRowDataMap[currentDataRowIndex][csvHeaderMap["Description"].Index] += descriptionFieldSep + strings.TrimSpace(t[rowIndex-1][pageLayout.DescriptionColumn])
+			}
+			continue
+		}
+
+		skipRow, csvRow := loadRoomKeyCSVRow(csvHeaderMap, t[rowIndex-1], pageLayout)
+
+		if skipRow {
+			// in case blank row detected
+			continue
+		}
+
+		// map this row as currentDataRowIndex and also hold a reference in datamap
+		csvRowDataMap[rowIndex] = csvRow
+		currentDataRowIndex = rowIndex
+
+	}
+
+	return csvRowDataMap
 }
@@ -0,0 +1,104 @@
+package roomkey
+
+import (
+	"context"
+	"encoding/csv"
+	"importers/core"
+	"os"
+	"path"
+	"rentroll/rlib"
+	"strconv"
+	"strings"
+)
+
+// CreateCustomAttibutesCSV create custom attribute csv temporarily
+// write headers, used to load data from roomkey csv
+// return file pointer to call program
+func CreateCustomAttibutesCSV(
+	CSVStore string,
+	timestamp string,
+	customAttributeStruct *core.CustomAttributeCSV,
+) (*os.File, *csv.Writer, bool) {
+
+	// get path of custom attribute csv file
+	filePrefix := prefixCSVFile["custom_attribute"]
+	fileName := filePrefix + timestamp + ".csv"
+
+	return core.CreateCustomAttributesCSV(path.Join(CSVStore, fileName), customAttributeStruct)
+}
+
+// ReadCustomAttributeCSVData used to read the data for CustomAttribute csv file
+// from guest values of a roomkey row while avoiding duplicate data
+func ReadCustomAttributeCSVData(
+	recordCount *int,
+	rowIndex int,
+	traceCSVData map[int]int,
+	values []core.CustomAttributeValue,
+	customAttributeCSVData *[][]string,
+	avoidData *[]string,
+	suppliedValues map[string]string,
+) {
+
+	for _, ca := range values {
+
+		// same attribute with the same value is needed only once
+		key := strings.Join([]string{ca.Name, ca.ValueType, ca.Value, ca.Units}, "|")
+		if core.StringInSlice(key, *avoidData) {
+			continue
+		}
+		*avoidData = append(*avoidData, key)
+
+		*customAttributeCSVData = append(*customAttributeCSVData, core.GetCustomAttributeCSVRow(suppliedValues["BUD"], ca))
+
+		// entry this rowindex with unit value in the map
+		*recordCount = *recordCount + 1
+		traceCSVData[*recordCount+1] = rowIndex
+	}
+}
+
+// insertPersonCustomAttributeRefs references the loaded custom attributes
+// with the person created for each roomkey row and returns how many
+// references it tried to insert
+func insertPersonCustomAttributeRefs(
+	ctx context.Context,
+	business *rlib.Business,
+	rowCustomAttributes map[int][]core.CustomAttributeValue,
+	rowIndexes []int,
+	traceTCIDMap map[int]string,
+	csvErrors map[int][]string,
+	importRecord *core.ImportRecord,
+) int {
+
+	refCount := 0
+	errPrefix := "E:<" + core.DBTypeMapStrings[core.DBCustomAttrRef] + ">:"
+
+	for _, rowIndex := range rowIndexes {
+		values := rowCustomAttributes[rowIndex]
+		if len(values) == 0 {
+			continue
+		}
+
+		// person must be there to hold the reference
+		tcid, err := strconv.ParseInt(strings.TrimPrefix(traceTCIDMap[rowIndex], "TC"), 10, 64)
+		if err != nil || tcid == 0 {
+			csvErrors[rowIndex] = append(csvErrors[rowIndex], errPrefix+"Unable to insert custom attribute, guest has not been imported")
+			continue
+		}
+
+		for _, ca := range values {
+			refCount++
+
+			carid, err := core.InsertCustomAttributeRef(ctx, business.BID, rlib.ELEMPERSON, tcid, ca)
+			if err != nil {
+				rlib.Ulog("ERROR <CUSTOMREF INSERTION>: %s", err.Error())
+				csvErrors[rowIndex] = append(csvErrors[rowIndex], errPrefix+"Unable to insert custom attribute \""+ca.Name+"\"")
+				continue
+			}
+			if carid > 0 {
+				importRecord.AddCreated(core.DBCustomAttrRef, carid)
+			}
+		}
+	}
+
+	return refCount
+}
@@ -0,0 +1,262 @@
+package roomkey
+
+import (
+	"fmt"
+	"importers/core"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// rentRollDateLayout is the date format in which dates are written
+// to the temporary csv files for rcsv loaders
+const rentRollDateLayout = "2006-01-02"
+
+// roomKeyDateLayouts holds the date formats which roomkey emits
+var roomKeyDateLayouts = []string{
+	"02-Jan-2006",
+	"2-Jan-2006",
+	"02-Jan-06",
+	"01/02/2006",
+	"1/2/2006",
+	"01-02-2006",
+	"2006-01-02",
+}
+
+// roomKeyPartialDateLayouts holds the date formats in which roomkey
+// sometimes drops the year, e.g. "09-May-"
+var roomKeyPartialDateLayouts = []string{
+	"02-Jan-",
+	"2-Jan-",
+	"02-Jan",
+	"2-Jan",
+	"01/02",
+	"1/2",
+}
+
+// roomKeyBannerDateRe finds dates with year in banner rows,
+// e.g. print date "Printed: 05/10/2018 10:22 AM"
+var roomKeyBannerDateRe = regexp.MustCompile(`\b(?:\d{1,2}[-/](?:[A-Za-z]{3}|\d{1,2})[-/]\d{2,4}|\d{4}-\d{2}-\d{2})\b`)
+
+// roomKeyRowDates holds the parsed dates of a roomkey row,
+// zero value of a date means it was blank in the row
+type roomKeyRowDates struct {
+	DateRes time.Time
+	DateIn  time.Time
+	DateOut time.Time
+	Valid   bool // false if any date could not be recovered
+}
+
+// get returns parsed date by header name
+func (d roomKeyRowDates) get(headerName string) time.Time {
+	switch headerName {
+	case "DateRes":
+		return d.DateRes
+	case "DateIn":
+		return d.DateIn
+	case "DateOut":
+		return d.DateOut
+	}
+	return time.Time{}
+}
+
+// formatRoomKeyDate returns rentroll accepted date string
+// or blank string for zero date
+func formatRoomKeyDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(rentRollDateLayout)
+}
+
+// parseRoomKeyDate parses date string in any format that roomkey emits.
+// It returns the date, whether the year was missing in the string and error
+func parseRoomKeyDate(dateString string) (time.Time, bool, error) {
+	dateString = strings.TrimSpace(dateString)
+
+	for _, layout := range roomKeyDateLayouts {
+		if d, err := time.Parse(layout, dateString); err == nil {
+			return d, false, nil
+		}
+	}
+
+	for _, layout := range roomKeyPartialDateLayouts {
+		if d, err := time.Parse(layout, dateString); err == nil {
+			return d, true, nil
+		}
+	}
+
+	return time.Time{}, false, fmt.Errorf("unrecognized date")
+}
+
+// inferRoomKeyDateYear puts a year to the date which has no year.
+// With direction -1 date must be on or before ref, with 1 on or after ref
+// and with 0 it takes the occurrence nearest to ref. It returns false if
+// the date doesn't exist in that year, 29-Feb is not moved to 1-Mar.
+func inferRoomKeyDateYear(partial, ref time.Time, direction int) (time.Time, bool) {
+	year := ref.Year()
+
+	// compare month and day only, date may not exist in year of ref
+	monthDay := int(partial.Month())*100 + partial.Day()
+	refMonthDay := int(ref.Month())*100 + ref.Day()
+
+	switch direction {
+	case -1:
+		if monthDay > refMonthDay {
+			year--
+		}
+	case 1:
+		if monthDay < refMonthDay {
+			year++
+		}
+	default:
+		// 28-Feb is as near as 29-Feb to tell the year
+		day := partial.Day()
+		if partial.Month() == time.February && day == 29 {
+			day = 28
+		}
+		d := time.Date(year, partial.Month(), day, 0, 0, 0, 0, time.UTC)
+		refDay := time.Date(ref.Year(), ref.Month(), ref.Day(), 0, 0, 0, 0, time.UTC)
+		if d.Sub(refDay) > 183*24*time.Hour {
+			year--
+		} else if refDay.Sub(d) > 183*24*time.Hour {
+			year++
+		}
+	}
+
+	d := time.Date(year, partial.Month(), partial.Day(), 0, 0, 0, 0, time.UTC)
+	return d, d.Month() == partial.Month() && d.Day() == partial.Day()
+}
+
+// getRoomKeyReportDate returns the date printed in banner rows above
+// the first header line, zero time if there is no such date
+func getRoomKeyReportDate(t [][]string, headerList []core.CSVHeader) time.Time {
+	for _, row := range t {
+		// banner rows are only above the headers
+		if ok, _ := isRoomKeyHeaderLine(row, headerList); ok {
+			break
+		}
+		for _, cell := range row {
+			for _, value := range roomKeyBannerDateRe.FindAllString(cell, -1) {
+				if d, noYear, err := parseRoomKeyDate(value); err == nil && !noYear {
+					return d
+				}
+			}
+		}
+	}
+	return time.Time{}
+}
+
+// getRoomKeyRowDates parses Date Res, Date In and Date Out of a row.
+// Missing year is inferred from neighbouring dates of the row or from
+// the report date printed in banner, zero report date means it is not
+// known. Errors and warnings are put in csvErrors.
+func getRoomKeyRowDates(
+	rowIndex int,
+	csvRow []string,
+	csvHeaderMap map[string]core.CSVHeader,
+	reportDate time.Time,
+	csvErrors map[int][]string,
+) roomKeyRowDates {
+
+	rowDates := roomKeyRowDates{Valid: true}
+
+	errPrefix := "E:<" + core.DBTypeMapStrings[core.DBRentalAgreement] + ">:"
+	warnPrefix := "W:<" + core.DBTypeMapStrings[core.DBRentalAgreement] + ">:"
+
+	// parse all dates first, partial dates are resolved afterwards
+	parsed := map[string]time.Time{}
+	partial := map[string]bool{}
+	for _, name := range []string{"DateRes", "DateIn", "DateOut"} {
+		header := csvHeaderMap[name]
+		value := strings.TrimSpace(csvRow[header.Index])
+		if value == "" {
+			continue
+		}
+
+		d, noYear, err := parseRoomKeyDate(value)
+		if err != nil {
+			rowDates.Valid = false
+			csvErrors[rowIndex] = append(csvErrors[rowIndex],
+				fmt.Sprintf("%sInvalid date \"%s\" in column \"%s\" (column %d)",
+					errPrefix, value, header.Name, header.Index+1),
+			)
+			continue
+		}
+		parsed[name] = d
+		partial[name] = noYear
+	}
+
+	// references for each partial date in order of preference
+	// with direction of the date relative to the reference
+	type dateRef struct {
+		name      string
+		direction int
+	}
+	inferOrder := []struct {
+		name string
+		refs []dateRef
+	}{
+		{"DateIn", []dateRef{{"DateOut", -1}, {"DateRes", 1}}},
+		{"DateOut", []dateRef{{"DateIn", 1}, {"DateRes", 1}}},
+		{"DateRes", []dateRef{{"DateIn", -1}, {"DateOut", -1}}},
+	}
+
+	for _, item := range inferOrder {
+		if !partial[item.name] {
+			continue
+		}
+		header := csvHeaderMap[item.name]
+		value := strings.TrimSpace(csvRow[header.Index])
+
+		var d time.Time
+		inferred, exists := false, false
+		for _, ref := range item.refs {
+			refDate, ok := parsed[ref.name]
+			if !ok || partial[ref.name] {
+				continue
+			}
+			d, exists = inferRoomKeyDateYear(parsed[item.name], refDate, ref.direction)
+			inferred = true
+			break
+		}
+
+		// last option is report date, only safe if it is known
+		if !inferred && !reportDate.IsZero() {
+			d, exists = inferRoomKeyDateYear(parsed[item.name], reportDate, 0)
+			inferred = true
+		}
+
+		if !inferred {
+			rowDates.Valid = false
+			csvErrors[rowIndex] = append(csvErrors[rowIndex],
+				fmt.Sprintf("%sUnable to find year of date \"%s\" in column \"%s\" (column %d), report date is not found in banner of report",
+					errPrefix, value, header.Name, header.Index+1),
+			)
+			delete(parsed, item.name)
+			continue
+		}
+		if !exists {
+			rowDates.Valid = false
+			csvErrors[rowIndex] = append(csvErrors[rowIndex],
+				fmt.Sprintf("%sDate \"%s\" in column \"%s\" (column %d) does not exist in year %d",
+					errPrefix, value, header.Name, header.Index+1, d.Year()),
+			)
+			delete(parsed, item.name)
+			continue
+		}
+		parsed[item.name] = d
+
+		partial[item.name] = false
+		csvErrors[rowIndex] = append(csvErrors[rowIndex],
+			fmt.Sprintf("%sDate \"%s\" in column \"%s\" has no year, using %s",
+				warnPrefix, value, header.Name, parsed[item.name].Format("01/02/2006")),
+		)
+	}
+
+	rowDates.DateRes = parsed["DateRes"]
+	rowDates.DateIn = parsed["DateIn"]
+	rowDates.DateOut = parsed["DateOut"]
+
+	return rowDates
+}
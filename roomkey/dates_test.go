@@ -0,0 +1,160 @@
+package roomkey
+
+import (
+	"importers/core"
+	"rentroll/rlib"
+	"testing"
+	"time"
+)
+
+// sample files of roomkey export
+const (
+	sampleRoomKeyCSV = "../csvfiles_temp/roomkey.csv"
+	sampleHeaderJSON = "../admin/roomkey/roomkeyHeader.json"
+)
+
+// date returns date of test at midnight
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func TestParseRoomKeyDate(t *testing.T) {
+	// values are taken from roomkey.csv sample
+	tests := []struct {
+		value  string
+		month  time.Month
+		day    int
+		year   int
+		noYear bool
+		err    bool
+	}{
+		{value: "15-May-2018", month: time.May, day: 15, year: 2018},
+		{value: "25-Apr-2018 ", month: time.April, day: 25, year: 2018},
+		{value: "09-May-", month: time.May, day: 9, noYear: true},
+		{value: "9-May", month: time.May, day: 9, noYear: true},
+		{value: "05/01/2018", month: time.May, day: 1, year: 2018},
+		{value: "05/01", month: time.May, day: 1, noYear: true},
+		{value: "2018-08-30", month: time.August, day: 30, year: 2018},
+		{value: "29-Feb-", month: time.February, day: 29, noYear: true},
+		{value: "31-Feb-2018", err: true},
+		{value: "FAA Long Term Rate", err: true},
+		{value: "", err: true},
+	}
+
+	for _, tt := range tests {
+		d, noYear, err := parseRoomKeyDate(tt.value)
+		if tt.err {
+			if err == nil {
+				t.Errorf("parseRoomKeyDate(%q): expected error, got %s", tt.value, d)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseRoomKeyDate(%q): unexpected error %s", tt.value, err.Error())
+			continue
+		}
+		if noYear != tt.noYear || d.Month() != tt.month || d.Day() != tt.day || (!tt.noYear && d.Year() != tt.year) {
+			t.Errorf("parseRoomKeyDate(%q) = %s, noYear %t", tt.value, d, noYear)
+		}
+	}
+}
+
+func TestInferRoomKeyDateYear(t *testing.T) {
+	tests := []struct {
+		name      string
+		partial   time.Time
+		ref       time.Time
+		direction int
+		want      time.Time
+		exists    bool
+	}{
+		// "09-May-" reserved before check in on 15-May-2018
+		{"res before check in", date(0, time.May, 9), date(2018, time.May, 15), -1, date(2018, time.May, 9), true},
+		{"res before check in of next year", date(0, time.December, 20), date(2019, time.January, 3), -1, date(2018, time.December, 20), true},
+		{"check out after check in", date(0, time.January, 5), date(2018, time.December, 28), 1, date(2019, time.January, 5), true},
+		{"same day", date(0, time.May, 15), date(2018, time.May, 15), 1, date(2018, time.May, 15), true},
+		{"nearest to report date", date(0, time.December, 30), date(2019, time.January, 2), 0, date(2018, time.December, 30), true},
+		{"nearest to report date of next year", date(0, time.January, 2), date(2018, time.December, 30), 0, date(2019, time.January, 2), true},
+		{"leap year", date(0, time.February, 29), date(2020, time.March, 10), -1, date(2020, time.February, 29), true},
+		{"non leap year", date(0, time.February, 29), date(2019, time.March, 10), -1, date(2019, time.February, 29), false},
+		{"non leap year by report date", date(0, time.February, 29), date(2018, time.April, 27), 0, date(2018, time.February, 29), false},
+	}
+
+	for _, tt := range tests {
+		d, exists := inferRoomKeyDateYear(tt.partial, tt.ref, tt.direction)
+		if exists != tt.exists {
+			t.Errorf("%s: exists = %t, want %t", tt.name, exists, tt.exists)
+			continue
+		}
+		if exists && !d.Equal(tt.want) {
+			t.Errorf("%s: got %s, want %s", tt.name, d.Format(rentRollDateLayout), tt.want.Format(rentRollDateLayout))
+		}
+	}
+}
+
+func TestGetRoomKeyRowDates(t *testing.T) {
+	csvHeaderMap := map[string]core.CSVHeader{
+		"DateRes": {Name: "DateRes", Index: 0},
+		"DateIn":  {Name: "DateIn", Index: 1},
+		"DateOut": {Name: "DateOut", Index: 2},
+	}
+	reportDate := date(2018, time.April, 27)
+
+	tests := []struct {
+		name       string
+		row        []string
+		reportDate time.Time
+		valid      bool
+		dateRes    time.Time
+		issues     int
+	}{
+		// line 7 of roomkey.csv sample
+		{"year from check in", []string{"09-May-", "15-May-2018", "06-Jun-2018"}, reportDate, true, date(2018, time.May, 9), 1},
+		{"all dates with year", []string{"25-Apr-2018", "01-May-2018", "30-Aug-2018"}, reportDate, true, date(2018, time.April, 25), 0},
+		{"year from report date", []string{"20-Apr-", "", ""}, reportDate, true, date(2018, time.April, 20), 1},
+		{"no report date", []string{"20-Apr-", "", ""}, time.Time{}, false, time.Time{}, 1},
+		{"29-Feb in non leap year", []string{"29-Feb-", "", ""}, reportDate, false, time.Time{}, 1},
+		{"invalid date", []string{"25-Apr-2018", "FAA", "30-Aug-2018"}, reportDate, false, date(2018, time.April, 25), 1},
+	}
+
+	for _, tt := range tests {
+		csvErrors := map[int][]string{}
+		rowDates := getRoomKeyRowDates(1, tt.row, csvHeaderMap, tt.reportDate, csvErrors)
+		if rowDates.Valid != tt.valid {
+			t.Errorf("%s: valid = %t, issues %v", tt.name, rowDates.Valid, csvErrors[1])
+		}
+		if !rowDates.DateRes.Equal(tt.dateRes) {
+			t.Errorf("%s: date res = %s, want %s", tt.name, formatRoomKeyDate(rowDates.DateRes), formatRoomKeyDate(tt.dateRes))
+		}
+		if len(csvErrors[1]) != tt.issues {
+			t.Errorf("%s: issues %v, want %d", tt.name, csvErrors[1], tt.issues)
+		}
+	}
+}
+
+func TestGetRoomKeyReportDate(t *testing.T) {
+	headerList, err := core.GetCSVHeaders(sampleHeaderJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sample := rlib.LoadCSV(sampleRoomKeyCSV)
+	if len(sample) == 0 {
+		t.Fatalf("unable to load %s", sampleRoomKeyCSV)
+	}
+
+	// banner of sample has name, address and phone of property only
+	if d := getRoomKeyReportDate(sample, headerList); !d.IsZero() {
+		t.Errorf("sample: got report date %s, want none", d)
+	}
+
+	printed := append([][]string{{"", "Printed: 04/27/2018 10:22 AM"}}, sample...)
+	if d := getRoomKeyReportDate(printed, headerList); !d.Equal(date(2018, time.April, 27)) {
+		t.Errorf("printed: got report date %s", d)
+	}
+
+	// dates of data rows are not report date
+	noBanner := [][]string{sample[5], {"", "Adams, Andrew", "", "10806", "25-Apr-2018"}}
+	if d := getRoomKeyReportDate(noBanner, headerList); !d.IsZero() {
+		t.Errorf("no banner: got report date %s, want none", d)
+	}
+}
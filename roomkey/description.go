@@ -0,0 +1,155 @@
+package roomkey
+
+import (
+	"importers/core"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// descriptionTargetCustomAttr is the target of a rule whose value
+// should be stored as a custom attribute of the guest
+const descriptionTargetCustomAttr = "CustomAttribute"
+
+// descriptionTargetRAPrefix is the prefix of a rule target which puts
+// the value in a field of rental agreement, e.g. "RentalAgreement.Notes"
+const descriptionTargetRAPrefix = "RentalAgreement."
+
+// DescriptionRule is a labelled key/value pattern which pulls a value
+// out of the free text description rows that follow a reservation
+type DescriptionRule struct {
+	Name        string // label of the value, also the custom attribute name
+	Pattern     string // regular expression, first group holds the value
+	Target      string // "CustomAttribute" or "RentalAgreement.<Field>"
+	ValueType   string // custom attribute value type
+	Units       string // custom attribute units
+	DateLayout  string // if set, value is a date in this layout
+	CompareWith string // "DateIn" or "DateOut", warn if the date differs
+	re          *regexp.Regexp
+}
+
+// descriptionValue holds the value found by a rule in a description
+type descriptionValue struct {
+	Rule  *DescriptionRule
+	Value string
+}
+
+// extractDescriptionValues applies all rules on description text
+// and returns the values found, in the order of rules
+func extractDescriptionValues(description string, rules []DescriptionRule) []descriptionValue {
+	values := []descriptionValue{}
+
+	for i := range rules {
+		rule := &rules[i]
+		m := rule.re.FindStringSubmatch(description)
+		if len(m) < 2 {
+			continue
+		}
+
+		value := strings.TrimSpace(m[1])
+
+		// a date might be broken in two description rows,
+		// which have been joined with a separator
+		if rule.DateLayout != "" {
+			value = strings.Replace(value, descriptionFieldSep, "", -1)
+		}
+		if value == "" {
+			continue
+		}
+
+		values = append(values, descriptionValue{Rule: rule, Value: value})
+	}
+
+	return values
+}
+
+// getDescriptionRAFields returns rental agreement field values
+// from the extracted description values
+func getDescriptionRAFields(values []descriptionValue) map[string]string {
+	raFields := map[string]string{}
+	for _, v := range values {
+		if !strings.HasPrefix(v.Rule.Target, descriptionTargetRAPrefix) {
+			continue
+		}
+		field := strings.TrimPrefix(v.Rule.Target, descriptionTargetRAPrefix)
+		if raFields[field] != "" {
+			raFields[field] += descriptionFieldSep
+		}
+		raFields[field] += v.Rule.Name + ": " + v.Value
+	}
+	return raFields
+}
+
+// checkDescriptionDates compares the authorized dates found in description
+// with Date In / Date Out of the row and flags a warning if they disagree
+func checkDescriptionDates(
+	rowIndex int,
+	csvRow []string,
+	rowDates roomKeyRowDates,
+	values []descriptionValue,
+	csvErrors map[int][]string,
+	csvHeaderMap map[string]core.CSVHeader,
+) {
+	for _, v := range values {
+		if v.Rule.DateLayout == "" || v.Rule.CompareWith == "" {
+			continue
+		}
+
+		warnPrefix := "W:<" + core.DBTypeMapStrings[core.DBRentalAgreement] + ">:"
+
+		descDate, err := time.Parse(v.Rule.DateLayout, v.Value)
+		if err != nil {
+			csvErrors[rowIndex] = append(csvErrors[rowIndex],
+				warnPrefix+v.Rule.Name+" \""+v.Value+"\" in description is not a valid date",
+			)
+			continue
+		}
+
+		header, ok := csvHeaderMap[v.Rule.CompareWith]
+		if !ok {
+			continue
+		}
+
+		rowDateString := strings.TrimSpace(csvRow[header.Index])
+		rowDate := rowDates.get(v.Rule.CompareWith)
+		if rowDate.IsZero() {
+			continue
+		}
+
+		if !rowDate.Equal(descDate) {
+			csvErrors[rowIndex] = append(csvErrors[rowIndex],
+				warnPrefix+v.Rule.Name+" "+descDate.Format("01/02/2006")+
+					" in description does not match "+header.Name+" \""+rowDateString+"\"",
+			)
+		}
+	}
+}
+
+// getDescriptionCustomAttributes returns custom attributes of guest
+// from the extracted description values
+func getDescriptionCustomAttributes(values []descriptionValue) []core.CustomAttributeValue {
+	customAttributes := []core.CustomAttributeValue{}
+	for _, v := range values {
+		if v.Rule.Target != descriptionTargetCustomAttr {
+			continue
+		}
+		value := v.Value
+
+		// rentroll accepts dates in its own format only
+		if v.Rule.DateLayout != "" {
+			d, err := time.Parse(v.Rule.DateLayout, value)
+			if err != nil {
+				continue
+			}
+			value = d.Format("01/02/2006")
+		}
+
+		customAttributes = append(customAttributes, core.CustomAttributeValue{
+			Name:      v.Rule.Name,
+			ValueType: v.Rule.ValueType,
+			Value:     value,
+			Units:     v.Rule.Units,
+		})
+	}
+	return customAttributes
+}
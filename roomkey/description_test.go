@@ -0,0 +1,87 @@
+package roomkey
+
+import (
+	"importers/core"
+	"rentroll/rlib"
+	"testing"
+)
+
+// profile of roomkey importer
+const sampleProfileJSON = "../admin/roomkey/profile.json"
+
+// getDescriptionValueMap returns values found in description by rule name
+func getDescriptionValueMap(description string, rules []DescriptionRule) map[string]string {
+	values := map[string]string{}
+	for _, v := range extractDescriptionValues(description, rules) {
+		values[v.Rule.Name] = v.Value
+	}
+	return values
+}
+
+func TestExtractDescriptionValues(t *testing.T) {
+	profile, err := loadProfile(sampleProfileJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	headerList, err := core.GetCSVHeaders(sampleHeaderJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// description rows of Adams, Andrew at line 8 of sample
+	csvHeaderMap := getCanonicalHeaderMap(headerList)
+	rows := readRoomKeyCSVRows(rlib.LoadCSV(sampleRoomKeyCSV), headerList, csvHeaderMap, profile, map[int][]string{})
+	row, ok := rows[8]
+	if !ok {
+		t.Fatalf("line 8 of %s is not a data row", sampleRoomKeyCSV)
+	}
+
+	tests := []struct {
+		name        string
+		description string
+		want        map[string]string
+	}{
+		{
+			name:        "sample",
+			description: row[csvHeaderMap["Description"].Index],
+			want: map[string]string{
+				"FAA Authorization Number": "418008988",
+				"Authorized Check-in":      "05-01-2018",
+				"Authorized Check-out":     "08-31-2018",
+				"Billing Representative":   "Janet Barnes",
+			},
+		},
+		{
+			name:        "representative at end",
+			description: "FAA Authorized Representative: Janet Barnes",
+			want:        map[string]string{"Billing Representative": "Janet Barnes"},
+		},
+		{
+			name:        "representative before other label",
+			description: "FAA Authorized Representative: Janet BarnesStudent Name: Adams, AndrewFAA Authorization Number: 418008988",
+			want: map[string]string{
+				"Billing Representative":   "Janet Barnes",
+				"FAA Authorization Number": "418008988",
+			},
+		},
+		{
+			name:        "no labels",
+			description: "FAA Rates Apply, Delex is paying for the rooms",
+			want:        map[string]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		got := getDescriptionValueMap(tt.description, profile.DescriptionRules)
+		for name, value := range tt.want {
+			if got[name] != value {
+				t.Errorf("%s: %s = %q, want %q", tt.name, name, got[name], value)
+			}
+		}
+		for name, value := range got {
+			if _, ok := tt.want[name]; !ok && name != "Confirmation Number" {
+				t.Errorf("%s: unexpected %s = %q", tt.name, name, value)
+			}
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package roomkey
+
+import (
+	"context"
+	"errors"
+	"importers/core"
+	"path"
+	"rentroll/rlib"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kardianos/osext"
+)
+
+// readRoomKeyCSV loads data rows of roomkey csv with its headers and report
+// type, issues of rows are reported by import so they are not kept here
+func readRoomKeyCSV(roomKeyCSV string) (map[int][]string, map[string]core.CSVHeader, ReportType, time.Time, error) {
+	var reportType ReportType
+	var reportDate time.Time
+
+	folderPath, err := osext.ExecutableFolder()
+	if err != nil {
+		return nil, nil, reportType, reportDate, err
+	}
+
+	csvHeaderList, err := core.GetCSVHeaders(path.Join(folderPath, "roomkeyHeader.json"))
+	if err != nil {
+		return nil, nil, reportType, reportDate, err
+	}
+
+	roomKeyProfile, err := loadProfile(path.Join(folderPath, "profile.json"))
+	if err != nil {
+		return nil, nil, reportType, reportDate, err
+	}
+
+	// load csv file and get data from csv
+	t := rlib.LoadCSV(roomKeyCSV)
+	csvErrors := map[int][]string{}
+
+	reportType = detectRoomKeyReportType(t, csvHeaderList, roomKeyProfile, csvErrors)
+	reportDate = getRoomKeyReportDate(t, csvHeaderList)
+
+	csvHeaderMap := getCanonicalHeaderMap(csvHeaderList)
+	csvRowDataMap := readRoomKeyCSVRows(t, csvHeaderList, csvHeaderMap, roomKeyProfile, csvErrors)
+	if len(csvRowDataMap) == 0 {
+		return nil, nil, reportType, reportDate, errors.New("There are no data rows present")
+	}
+
+	return csvRowDataMap, csvHeaderMap, reportType, reportDate, nil
+}
+
+// readRoomKeyState reads rooms of roomkey csv in the state
+// which can be compared with the business
+func readRoomKeyState(
+	roomKeyCSV string,
+	guestInfo guestInfoIndex,
+	guestHeaderMap map[string]core.CSVHeader,
+	guestCSVSupplied bool,
+) (*core.BusinessState, error) {
+	state := core.NewBusinessState()
+
+	csvRowDataMap, csvHeaderMap, reportType, reportDate, err := readRoomKeyCSV(roomKeyCSV)
+	if err != nil {
+		return state, err
+	}
+
+	// cancelled reservations don't tell who is in the rooms
+	if reportType.Action == reportActionCancellation {
+		return state, errors.New("Report " + reportType.Name + " has cancelled reservations only, it can not be compared with business")
+	}
+
+	// always sort keys to iterate over csv rows from top to bottom
+	var csvRowDataMapKeys []int
+	for k := range csvRowDataMap {
+		csvRowDataMapKeys = append(csvRowDataMapKeys, k)
+	}
+	sort.Ints(csvRowDataMapKeys)
+
+	for _, rowIndex := range csvRowDataMapKeys {
+		csvRow := csvRowDataMap[rowIndex]
+
+		room := strings.TrimSpace(csvRow[csvHeaderMap["Room"].Index])
+		if room == "" {
+			continue
+		}
+
+		unit := state.GetUnit(room)
+		unit.RentableType = strings.TrimSpace(csvRow[csvHeaderMap["RoomType"].Index])
+		state.AddRentableType(unit.RentableType)
+
+		// guest of departure or guest history report has left the room
+		if reportType.Action == reportActionDeparture || reportType.Action == reportActionGuestHistory {
+			if unit.Status == "" {
+				unit.Status = core.UnitVacant
+			}
+			continue
+		}
+		unit.Status = core.UnitOccupied
+
+		rowDates := getRoomKeyRowDates(rowIndex, csvRow, csvHeaderMap, reportDate, map[int][]string{})
+		unit.SetLease(
+			core.DgtGrpSepToDgts(csvRow[csvHeaderMap["Rate"].Index]),
+			formatRoomKeyDate(rowDates.DateIn),
+			formatRoomKeyDate(rowDates.DateOut),
+		)
+
+		// guest export has name in separate columns and contact of guest
+		fullName := strings.TrimSpace(csvRow[csvHeaderMap["Guest"].Index])
+		email, phone := "", ""
+		if guestCSVSupplied {
+			guestMatch := guestInfo.match(csvRow, csvHeaderMap, rowDates, guestHeaderMap)
+			if guestMatch.Row != nil {
+				firstName := getGuestCell(guestMatch.Row, guestHeaderMap, "FirstName")
+				lastName := getGuestCell(guestMatch.Row, guestHeaderMap, "LastName")
+				if firstName != "" && lastName != "" {
+					fullName = lastName + ", " + firstName
+				}
+				email = getGuestCell(guestMatch.Row, guestHeaderMap, "Email")
+				phone = getGuestCell(guestMatch.Row, guestHeaderMap, "MainPhone")
+			}
+		}
+		if fullName != "" {
+			personName := core.ParsePersonName(fullName, "")
+			unit.AddTenant(personName.First, personName.Last, email, phone)
+		}
+	}
+
+	return state, nil
+}
+
+// DiffHandler compares roomkey csv with the current state of business
+// and returns report of changes, nothing is written to the database
+func DiffHandler(
+	ctx context.Context,
+	csvPath string,
+	GuestInfoCSV string,
+	business *rlib.Business,
+) (string, bool) {
+
+	var guestInfo guestInfoIndex
+	var guestHeaderMap map[string]core.CSVHeader
+	var err error
+
+	guestCSVSupplied := GuestInfoCSV != ""
+	if guestCSVSupplied {
+		guestInfo, guestHeaderMap, err = loadGuestInfoCSV(GuestInfoCSV)
+		if err != nil {
+			return err.Error() + "\n", false
+		}
+	}
+
+	incoming, err := readRoomKeyState(csvPath, guestInfo, guestHeaderMap, guestCSVSupplied)
+	if err != nil {
+		return err.Error() + "\n", false
+	}
+
+	current, err := core.LoadBusinessState(ctx, business.BID)
+	if err != nil {
+		rlib.Ulog("INTERNAL ERROR <LOAD BUSINESS STATE>: %s\n", err.Error())
+		return "Unable to read current state of business " + business.Designation + "\n", false
+	}
+
+	changes := core.DiffBusinessStates(current, incoming)
+	return core.GetDiffReport(business, csvPath, changes), true
+}
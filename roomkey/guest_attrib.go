@@ -0,0 +1,119 @@
+package roomkey
+
+import (
+	"importers/core"
+	"strings"
+)
+
+// GuestAttributeRule maps a column of guest export
+// to person custom attribute, loaded from profile
+type GuestAttributeRule struct {
+	Column    string // name of guest export header
+	Name      string // name of custom attribute
+	ValueType string
+	Units     string
+}
+
+// getGuestCustomAttributes returns person custom attributes
+// from guest export row by the rules of profile
+func getGuestCustomAttributes(
+	guestData []string,
+	guestHeaderMap map[string]core.CSVHeader,
+	rules []GuestAttributeRule,
+) []core.CustomAttributeValue {
+
+	attributes := []core.CustomAttributeValue{}
+	if len(guestData) == 0 {
+		return attributes
+	}
+
+	for _, rule := range rules {
+		value := getGuestCell(guestData, guestHeaderMap, rule.Column)
+		if value == "" {
+			continue
+		}
+
+		// numbers come with currency sign and group separators
+		if rule.ValueType != "0" && rule.ValueType != "4" {
+			value = strings.NewReplacer("$", "", ",", "").Replace(value)
+		}
+
+		attributes = append(attributes, core.CustomAttributeValue{
+			Name:      rule.Name,
+			ValueType: rule.ValueType,
+			Value:     value,
+			Units:     rule.Units,
+		})
+	}
+
+	return attributes
+}
+
+// guestOptOutValues are consent values of guest export which say no,
+// written without case, spaces and special chars
+var guestOptOutValues = map[string]bool{
+	"no":           true,
+	"n":            true,
+	"false":        true,
+	"0":            true,
+	"off":          true,
+	"none":         true,
+	"optout":       true,
+	"optedout":     true,
+	"unsubscribe":  true,
+	"unsubscribed": true,
+	"declined":     true,
+	"donotcontact": true,
+}
+
+// isGuestOptedOut checks the consent value of guest export says no,
+// e.g. "Opt-Out", "opt out" or "Unsubscribed"
+func isGuestOptedOut(value string) bool {
+	return guestOptOutValues[strings.ToLower(core.SpecialCharsReplacer.Replace(value))]
+}
+
+// getGuestEligibility returns whether guest is eligible for future
+// rentals from rental status of guest export, blank if unknown
+func getGuestEligibility(guestData []string, guestHeaderMap map[string]core.CSVHeader) string {
+	status := strings.ToLower(getGuestCell(guestData, guestHeaderMap, "RentalStatus"))
+	switch status {
+	case "":
+		return ""
+	case "allow", "allowed", "yes":
+		return "yes"
+	default:
+		return "no"
+	}
+}
+
+// getGuestPreferences returns other preferences of guest, marketing
+// opt-outs are written in it so that no one mails the guest
+func getGuestPreferences(guestData []string, guestHeaderMap map[string]core.CSVHeader) string {
+	preferences := []string{}
+
+	if language := getGuestCell(guestData, guestHeaderMap, "Language"); language != "" {
+		preferences = append(preferences, "Language: "+language)
+	}
+	if isGuestOptedOut(getGuestCell(guestData, guestHeaderMap, "EmailMarketing")) {
+		preferences = append(preferences, "Opted out of marketing email")
+	}
+	if isGuestOptedOut(getGuestCell(guestData, guestHeaderMap, "EmailGeneral")) {
+		preferences = append(preferences, "Opted out of general email")
+	}
+
+	return strings.Join(preferences, "; ")
+}
+
+// getGuestVIPNote returns note for vip guests, blank otherwise
+func getGuestVIPNote(guestData []string, guestHeaderMap map[string]core.CSVHeader) string {
+	status := getGuestCell(guestData, guestHeaderMap, "VIPStatus")
+	if status == "" || isGuestOptedOut(status) {
+		return ""
+	}
+
+	note := "VIP"
+	if description := getGuestCell(guestData, guestHeaderMap, "VIPDescription"); description != "" {
+		note += ": " + description
+	}
+	return note + "."
+}
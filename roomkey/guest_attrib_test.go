@@ -0,0 +1,31 @@
+package roomkey
+
+import "testing"
+
+func TestIsGuestOptedOut(t *testing.T) {
+	tests := []struct {
+		value string
+		want  bool
+	}{
+		{value: "No", want: true},
+		{value: " n ", want: true},
+		{value: "FALSE", want: true},
+		{value: "0", want: true},
+		{value: "Opt-Out", want: true},
+		{value: "opt out", want: true},
+		{value: "Opted Out", want: true},
+		{value: "Unsubscribed", want: true},
+		{value: "Do Not Contact", want: true},
+		{value: "Yes", want: false},
+		{value: "1", want: false},
+		{value: "Opt-In", want: false},
+		{value: "Gold", want: false},
+		{value: "", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := isGuestOptedOut(tt.value); got != tt.want {
+			t.Errorf("isGuestOptedOut(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
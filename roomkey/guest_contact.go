@@ -0,0 +1,70 @@
+package roomkey
+
+import (
+	"importers/core"
+	"strings"
+)
+
+// getGuestSecondContactAddress returns address of second contact block
+// of guest export in one line
+func getGuestSecondContactAddress(guestData []string, guestHeaderMap map[string]core.CSVHeader) string {
+	parts := []string{}
+
+	for _, name := range []string{"Address2", "City2"} {
+		if value := getGuestCell(guestData, guestHeaderMap, name); value != "" {
+			parts = append(parts, value)
+		}
+	}
+
+	// state and zip go together like "OK 73132"
+	stateZip := strings.TrimSpace(
+		getGuestCell(guestData, guestHeaderMap, "StateProvince2") + " " +
+			getGuestCell(guestData, guestHeaderMap, "ZipPostalCode2"))
+	if stateZip != "" {
+		parts = append(parts, stateZip)
+	}
+
+	if value := getGuestCell(guestData, guestHeaderMap, "Country2"); value != "" {
+		parts = append(parts, value)
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// getGuestSecondContact returns people fields filled from second contact
+// block of guest export. If second contact is an emergency contact,
+// as per profile, then emergency contact fields are filled too.
+func getGuestSecondContact(
+	guestData []string,
+	guestHeaderMap map[string]core.CSVHeader,
+	asEmergencyContact bool,
+) map[string]string {
+
+	fields := map[string]string{}
+	if len(guestData) == 0 {
+		return fields
+	}
+
+	email := getGuestCell(guestData, guestHeaderMap, "Email2")
+	if !core.IsValidEmail(email) {
+		email = ""
+	}
+	address := getGuestSecondContactAddress(guestData, guestHeaderMap)
+
+	fields["SecondaryEmail"] = email
+	fields["AlternateAddress"] = address
+
+	if asEmergencyContact {
+		phone := getGuestCell(guestData, guestHeaderMap, "MainPhone2")
+		if phone == "" {
+			phone = getGuestCell(guestData, guestHeaderMap, "Mobile2")
+		}
+
+		fields["EmergencyContactName"] = getGuestCell(guestData, guestHeaderMap, "Address2Name")
+		fields["EmergencyContactAddress"] = address
+		fields["EmergencyContactTelephone"] = phone
+		fields["EmergencyEmail"] = email
+	}
+
+	return fields
+}
@@ -0,0 +1,283 @@
+package roomkey
+
+import (
+	"fmt"
+	"importers/core"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// confidence of guest match by the way it has been found
+const (
+	guestMatchByID        = 1.0
+	guestMatchByFullName  = 0.9
+	guestMatchByShortName = 0.75
+	guestMatchDatesBonus  = 0.05
+)
+
+// GuestMatchRules holds the rules to match guests of report with guest export
+type GuestMatchRules struct {
+	MinConfidence float64 // matches below it are reported
+}
+
+// guestInfoIndex holds rows of guest export with the keys to look them up,
+// line numbers of guest export are used as reference of row
+type guestInfoIndex struct {
+	rows        map[int][]string
+	byGuestID   map[string][]int
+	byRes       map[string][]int
+	byFullName  map[string][]int
+	byShortName map[string][]int
+}
+
+// guestMatch holds the result of looking up a guest in guest export
+type guestMatch struct {
+	Row        []string
+	Line       int
+	Confidence float64
+	Method     string
+	Candidates []int // lines of guest export when match is ambiguous
+}
+
+// newGuestInfoIndex returns blank index of guest export
+func newGuestInfoIndex() guestInfoIndex {
+	return guestInfoIndex{
+		rows:        map[int][]string{},
+		byGuestID:   map[string][]int{},
+		byRes:       map[string][]int{},
+		byFullName:  map[string][]int{},
+		byShortName: map[string][]int{},
+	}
+}
+
+// addIndexKey appends line to the key of index if it is not there already
+func addIndexKey(index map[string][]int, key string, line int) {
+	if key == "" || core.IntegerInSlice(line, index[key]) {
+		return
+	}
+	index[key] = append(index[key], line)
+}
+
+// getGuestCell returns trimmed value of guest export row for the header,
+// blank if header is not available in guest export
+func getGuestCell(row []string, guestHeaderMap map[string]core.CSVHeader, name string) string {
+	header, ok := guestHeaderMap[name]
+	if !ok || header.Index < 0 || header.Index >= len(row) {
+		return ""
+	}
+	return strings.TrimSpace(row[header.Index])
+}
+
+// add puts row of guest export in the index
+func (index guestInfoIndex) add(line int, row []string, guestHeaderMap map[string]core.CSVHeader) {
+	index.rows[line] = row
+
+	addIndexKey(index.byGuestID, getGuestCell(row, guestHeaderMap, "GuestID"), line)
+	addIndexKey(index.byRes, getGuestCell(row, guestHeaderMap, "ReservationNumber"), line)
+
+	full, short := getGuestNameKeys(getGuestCell(row, guestHeaderMap, "GuestName"))
+	addIndexKey(index.byFullName, full, line)
+	addIndexKey(index.byShortName, short, line)
+
+	// first and last name columns, in case guest name is formatted otherwise
+	lastName := getGuestCell(row, guestHeaderMap, "LastName")
+	firstName := getGuestCell(row, guestHeaderMap, "FirstName")
+	if lastName != "" || firstName != "" {
+		full, short = getGuestNameKeys(lastName + ", " + firstName)
+		addIndexKey(index.byFullName, full, line)
+		addIndexKey(index.byShortName, short, line)
+	}
+}
+
+// normalizeGuestNamePart makes part of name comparable,
+// lower case without punctuation and extra spaces
+func normalizeGuestNamePart(s string) []string {
+	s = strings.ToLower(s)
+	s = strings.NewReplacer(".", " ", "'", "", "-", " ", "\"", "").Replace(s)
+	return strings.Fields(s)
+}
+
+// getGuestNameKeys returns two keys of name, full key holds all parts of name
+// and short key holds last name with first given name only, so that
+// middle names and initials don't cause misses.
+// Name is in "Last, First Middle" format, else it is taken as "First Last".
+func getGuestNameKeys(name string) (string, string) {
+	var last, given []string
+	if i := strings.Index(name, ","); i >= 0 {
+		last = normalizeGuestNamePart(name[:i])
+		given = normalizeGuestNamePart(name[i+1:])
+	} else {
+		parts := normalizeGuestNamePart(name)
+		if len(parts) == 0 {
+			return "", ""
+		}
+		last = parts[len(parts)-1:]
+		given = parts[:len(parts)-1]
+	}
+	if len(last) == 0 && len(given) == 0 {
+		return "", ""
+	}
+
+	full := strings.Join(last, " ") + "|" + strings.Join(given, " ")
+
+	first := ""
+	for _, part := range given {
+		// skip initials
+		if len(part) > 1 {
+			first = part
+			break
+		}
+	}
+	short := strings.Join(last, " ") + "|" + first
+
+	return full, short
+}
+
+// stayDatesMatch checks stay dates of guest export row, if available,
+// are same as dates of report row
+func (index guestInfoIndex) stayDatesMatch(
+	line int,
+	rowDates roomKeyRowDates,
+	guestHeaderMap map[string]core.CSVHeader,
+) (bool, bool) {
+
+	row := index.rows[line]
+	arrival := getGuestCell(row, guestHeaderMap, "ArrivalDate")
+	departure := getGuestCell(row, guestHeaderMap, "DepartureDate")
+	if arrival == "" && departure == "" {
+		return false, false
+	}
+
+	matched := true
+	for _, item := range []struct {
+		value string
+		date  string
+	}{
+		{arrival, formatRoomKeyDate(rowDates.DateIn)},
+		{departure, formatRoomKeyDate(rowDates.DateOut)},
+	} {
+		if item.value == "" {
+			continue
+		}
+		// ignore time part if any
+		d, _, err := parseRoomKeyDate(strings.Fields(item.value)[0])
+		if err != nil || formatRoomKeyDate(d) != item.date {
+			matched = false
+		}
+	}
+	return matched, true
+}
+
+// match looks up guest of report row in guest export. Guest ID and
+// reservation number are tried first then normalised name, stay dates
+// are used to choose one from guests with same name.
+func (index guestInfoIndex) match(
+	csvRow []string,
+	csvHeaderMap map[string]core.CSVHeader,
+	rowDates roomKeyRowDates,
+	guestHeaderMap map[string]core.CSVHeader,
+) guestMatch {
+
+	// returns single match of lines, or candidates if there are many
+	pick := func(lines []int, confidence float64, method string) guestMatch {
+		if len(lines) == 1 {
+			return guestMatch{Row: index.rows[lines[0]], Line: lines[0], Confidence: confidence, Method: method}
+		}
+
+		// choose guest whose stay dates are same
+		matched := []int{}
+		for _, line := range lines {
+			if ok, _ := index.stayDatesMatch(line, rowDates, guestHeaderMap); ok {
+				matched = append(matched, line)
+			}
+		}
+		if len(matched) == 1 {
+			return guestMatch{
+				Row: index.rows[matched[0]], Line: matched[0],
+				Confidence: confidence, Method: method + " and stay dates",
+			}
+		}
+
+		candidates := append([]int{}, lines...)
+		sort.Ints(candidates)
+		return guestMatch{Method: method, Candidates: candidates}
+	}
+
+	for _, item := range []struct {
+		header string
+		index  map[string][]int
+		method string
+	}{
+		{"GuestID", index.byGuestID, "guest id"},
+		{"Res", index.byRes, "reservation number"},
+	} {
+		header, ok := csvHeaderMap[item.header]
+		if !ok {
+			continue
+		}
+		if lines := item.index[strings.TrimSpace(csvRow[header.Index])]; len(lines) > 0 {
+			return pick(lines, guestMatchByID, item.method)
+		}
+	}
+
+	full, short := getGuestNameKeys(csvRow[csvHeaderMap["Guest"].Index])
+	if lines := index.byFullName[full]; len(lines) > 0 {
+		m := pick(lines, guestMatchByFullName, "name")
+		return index.checkStayDates(m, rowDates, guestHeaderMap)
+	}
+	if lines := index.byShortName[short]; len(lines) > 0 {
+		m := pick(lines, guestMatchByShortName, "name without middle name")
+		return index.checkStayDates(m, rowDates, guestHeaderMap)
+	}
+
+	return guestMatch{}
+}
+
+// checkStayDates raises or lowers confidence of name match by stay dates
+func (index guestInfoIndex) checkStayDates(
+	m guestMatch,
+	rowDates roomKeyRowDates,
+	guestHeaderMap map[string]core.CSVHeader,
+) guestMatch {
+	if m.Row == nil {
+		return m
+	}
+	matched, available := index.stayDatesMatch(m.Line, rowDates, guestHeaderMap)
+	switch {
+	case !available:
+	case matched:
+		m.Confidence += guestMatchDatesBonus
+	default:
+		m.Confidence /= 2
+		m.Method += ", stay dates differ"
+	}
+	return m
+}
+
+// getGuestMatchWarning returns warning for the match which is
+// ambiguous or has low confidence, blank if match is fine
+func getGuestMatchWarning(guestName string, m guestMatch, rules GuestMatchRules) string {
+	warnPrefix := "W:<" + core.DBTypeMapStrings[core.DBPeople] + ">:"
+	guestName = strings.TrimSpace(guestName)
+
+	if len(m.Candidates) > 0 {
+		lines := []string{}
+		for _, line := range m.Candidates {
+			lines = append(lines, strconv.Itoa(line))
+		}
+		return warnPrefix + fmt.Sprintf(
+			"Guest \"%s\" matches %d guests of Guest Export (lines %s) by %s, guest details are not imported",
+			guestName, len(m.Candidates), strings.Join(lines, ", "), m.Method,
+		)
+	}
+
+	if m.Row != nil && m.Confidence < rules.MinConfidence {
+		return warnPrefix + fmt.Sprintf(
+			"Guest \"%s\" matched with line %d of Guest Export by %s with low confidence (%.0f%%), please verify",
+			guestName, m.Line, m.Method, m.Confidence*100,
+		)
+	}
+
+	return ""
+}
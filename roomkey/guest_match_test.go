@@ -0,0 +1,153 @@
+package roomkey
+
+import (
+	"importers/core"
+	"math"
+	"rentroll/rlib"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sample files of roomkey guest export
+const (
+	sampleGuestCSV        = "../csvfiles_temp/guest.csv"
+	sampleGuestHeaderJSON = "../admin/roomkey/guestHeader.json"
+)
+
+// loadSampleGuestIndex returns index of guest export sample, rows are
+// numbered by csv record as in loader, notes of some guests span lines
+func loadSampleGuestIndex(t *testing.T) (guestInfoIndex, map[string]core.CSVHeader) {
+	guestHeaderList, err := core.GetCSVHeaders(sampleGuestHeaderJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := rlib.LoadCSV(sampleGuestCSV)
+	if len(rows) == 0 {
+		t.Fatalf("unable to load %s", sampleGuestCSV)
+	}
+
+	// headers are in first row of sample
+	guestHeaderMap := map[string]core.CSVHeader{}
+	for _, header := range guestHeaderList {
+		for colIndex, cell := range rows[0] {
+			if header.HeaderText == strings.ToLower(core.SpecialCharsReplacer.Replace(cell)) {
+				header.Index = colIndex
+			}
+		}
+		guestHeaderMap[header.Name] = header
+	}
+
+	index := newGuestInfoIndex()
+	for rowIndex := 1; rowIndex < len(rows); rowIndex++ {
+		index.add(rowIndex+1, rows[rowIndex], guestHeaderMap)
+	}
+	return index, guestHeaderMap
+}
+
+// getRoomKeyRow returns report row of values in the order of header map
+func getRoomKeyRow(csvHeaderMap map[string]core.CSVHeader, values map[string]string) []string {
+	row := make([]string, len(csvHeaderMap))
+	for name, value := range values {
+		row[csvHeaderMap[name].Index] = value
+	}
+	return row
+}
+
+func TestGuestInfoIndexMatch(t *testing.T) {
+	headerList, err := core.GetCSVHeaders(sampleHeaderJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csvHeaderMap := getCanonicalHeaderMap(headerList)
+	index, guestHeaderMap := loadSampleGuestIndex(t)
+	rules := GuestMatchRules{MinConfidence: 0.8}
+
+	// guest export sample has no stay dates
+	rowDates := roomKeyRowDates{
+		DateIn:  date(2018, time.May, 1),
+		DateOut: date(2018, time.August, 30),
+		Valid:   true,
+	}
+
+	tests := []struct {
+		name       string
+		values     map[string]string
+		line       int
+		confidence float64
+		candidates []int
+		warning    bool
+	}{
+		{"name", map[string]string{"Guest": "Adams, Andrew"}, 3, guestMatchByFullName, nil, false},
+		{"name with spaces", map[string]string{"Guest": " Dunn, Schiler"}, 2, guestMatchByFullName, nil, false},
+		{"first name first", map[string]string{"Guest": "Andrew Adams"}, 3, guestMatchByFullName, nil, false},
+		{"middle initial", map[string]string{"Guest": "Adams, Andrew J."}, 3, guestMatchByShortName, nil, true},
+		{"guest id", map[string]string{"Guest": "Walker, John", "GuestID": "97220"}, 230, guestMatchByID, nil, false},
+		{"same name", map[string]string{"Guest": "Walker, John"}, 0, 0, []int{229, 230}, true},
+		{"unknown", map[string]string{"Guest": "Doe, Jane"}, 0, 0, nil, false},
+	}
+
+	for _, tt := range tests {
+		m := index.match(getRoomKeyRow(csvHeaderMap, tt.values), csvHeaderMap, rowDates, guestHeaderMap)
+		if m.Line != tt.line || m.Confidence != tt.confidence {
+			t.Errorf("%s: line %d (%.2f by %s), want line %d (%.2f)", tt.name, m.Line, m.Confidence, m.Method, tt.line, tt.confidence)
+		}
+		if len(m.Candidates) != len(tt.candidates) {
+			t.Errorf("%s: candidates %v, want %v", tt.name, m.Candidates, tt.candidates)
+		} else {
+			for i := range tt.candidates {
+				if m.Candidates[i] != tt.candidates[i] {
+					t.Errorf("%s: candidates %v, want %v", tt.name, m.Candidates, tt.candidates)
+					break
+				}
+			}
+		}
+		if warning := getGuestMatchWarning(tt.values["Guest"], m, rules); (warning != "") != tt.warning {
+			t.Errorf("%s: warning %q", tt.name, warning)
+		}
+	}
+}
+
+func TestGuestInfoIndexMatchStayDates(t *testing.T) {
+	headerList, err := core.GetCSVHeaders(sampleHeaderJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csvHeaderMap := getCanonicalHeaderMap(headerList)
+	guestHeaderMap := map[string]core.CSVHeader{
+		"GuestName":     {Name: "GuestName", Index: 0},
+		"ArrivalDate":   {Name: "ArrivalDate", Index: 1},
+		"DepartureDate": {Name: "DepartureDate", Index: 2},
+	}
+
+	// stays of "Walker, John" from lines 777 and 779 of roomkey.csv sample
+	index := newGuestInfoIndex()
+	index.add(2, []string{"Walker, John", "02/19/2018 03:00 PM", "08/01/2018"}, guestHeaderMap)
+	index.add(3, []string{"Walker, John", "05/01/2018", "09/30/2018"}, guestHeaderMap)
+	index.add(4, []string{"Walker, Bill", "05/02/2018", "05/22/2018"}, guestHeaderMap)
+
+	tests := []struct {
+		name       string
+		guest      string
+		dateIn     time.Time
+		dateOut    time.Time
+		line       int
+		confidence float64
+		candidates int
+	}{
+		{"same name, first stay", "Walker, John", date(2018, time.February, 19), date(2018, time.August, 1), 2, guestMatchByFullName + guestMatchDatesBonus, 0},
+		{"same name, second stay", "Walker, John", date(2018, time.May, 1), date(2018, time.September, 30), 3, guestMatchByFullName + guestMatchDatesBonus, 0},
+		{"same name, other stay", "Walker, John", date(2018, time.March, 8), date(2018, time.July, 13), 0, 0, 2},
+		{"stay dates match", "Walker, Bill", date(2018, time.May, 2), date(2018, time.May, 22), 4, guestMatchByFullName + guestMatchDatesBonus, 0},
+		{"stay dates differ", "Walker, Bill", date(2018, time.June, 2), date(2018, time.June, 22), 4, guestMatchByFullName / 2, 0},
+	}
+
+	for _, tt := range tests {
+		row := getRoomKeyRow(csvHeaderMap, map[string]string{"Guest": tt.guest})
+		rowDates := roomKeyRowDates{DateIn: tt.dateIn, DateOut: tt.dateOut, Valid: true}
+		m := index.match(row, csvHeaderMap, rowDates, guestHeaderMap)
+		if m.Line != tt.line || math.Abs(m.Confidence-tt.confidence) > 1e-9 || len(m.Candidates) != tt.candidates {
+			t.Errorf("%s: line %d (%.2f by %s), candidates %v", tt.name, m.Line, m.Confidence, m.Method, m.Candidates)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package roomkey
+
+import (
+	"importers/core"
+	"sort"
+	"strings"
+	"time"
+)
+
+// readRoomKeyKPI reads rooms of roomkey csv for kpis, guests of departure
+// and cancellation reports are not in the rooms
+func readRoomKeyKPI(roomKeyCSV string, reportDate time.Time) (*core.RentRollKPI, error) {
+	k := core.NewRentRollKPI(reportDate)
+
+	csvRowDataMap, csvHeaderMap, reportType, bannerDate, err := readRoomKeyCSV(roomKeyCSV)
+	if err != nil {
+		return k, err
+	}
+	occupied := !isUpdateReportAction(reportType.Action)
+
+	// always sort keys to iterate over csv rows from top to bottom
+	var csvRowDataMapKeys []int
+	for key := range csvRowDataMap {
+		csvRowDataMapKeys = append(csvRowDataMapKeys, key)
+	}
+	sort.Ints(csvRowDataMapKeys)
+
+	for _, rowIndex := range csvRowDataMapKeys {
+		csvRow := csvRowDataMap[rowIndex]
+
+		room := strings.TrimSpace(csvRow[csvHeaderMap["Room"].Index])
+		if room == "" {
+			continue
+		}
+
+		// first stay of room is taken
+		u, found := k.GetUnit(room)
+		if found {
+			continue
+		}
+		u.FloorPlan = strings.TrimSpace(csvRow[csvHeaderMap["RoomType"].Index])
+		u.Status = core.UnitVacant
+		if !occupied {
+			continue
+		}
+		u.Status = core.UnitOccupied
+
+		// invalid rates and dates are reported by import
+		u.LeaseRent, _ = core.ParseAmount(csvRow[csvHeaderMap["Rate"].Index])
+		rowDates := getRoomKeyRowDates(rowIndex, csvRow, csvHeaderMap, bannerDate, map[int][]string{})
+		u.SetLeaseEnd(formatRoomKeyDate(rowDates.DateOut))
+	}
+
+	return k, nil
+}
+
+// getKPIReport returns kpis of roomkey csv
+func getKPIReport(csvFile string, reportDate time.Time) string {
+	k, err := readRoomKeyKPI(csvFile, reportDate)
+	if err != nil {
+		return "Unable to compute KPIs: " + err.Error() + "\n"
+	}
+	return core.GetKPIReport(k)
+}
@@ -0,0 +1,278 @@
+package roomkey
+
+import (
+	"fmt"
+	"importers/core"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// LayoutRules holds the rules by which the layout of each page
+// of roomkey report is detected, loaded from profile
+type LayoutRules struct {
+	PageColumn        int               // column which holds page/print info
+	DescriptionColumn int               // default column of description rows
+	MaxShift          int               // max distance of data from its header
+	SampleRows        int               // data rows of page used for detection
+	MinConfidence     float64           // pages below it will be reported
+	ValuePatterns     map[string]string // header name to pattern of its values
+	patterns          map[string]*regexp.Regexp
+}
+
+// roomKeyPageLayout holds the detected columns of a page
+type roomKeyPageLayout struct {
+	DataColumns       map[string]int // header name to column of its data
+	DescriptionColumn int
+	Confidence        float64
+	LowConfidence     []string // headers which could not be detected safely
+}
+
+// compile compiles value patterns of layout rules
+func (l *LayoutRules) compile() error {
+	l.patterns = map[string]*regexp.Regexp{}
+	for name, pattern := range l.ValuePatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return err
+		}
+		l.patterns[name] = re
+	}
+	return nil
+}
+
+// getCanonicalHeaderMap returns header map in which the index of each
+// header is its position in header list, all data rows are loaded
+// in this order regardless of the layout of the page
+func getCanonicalHeaderMap(headerList []core.CSVHeader) map[string]core.CSVHeader {
+	csvHeaderMap := map[string]core.CSVHeader{}
+	for i, header := range headerList {
+		header.Index = i
+		csvHeaderMap[header.Name] = header
+	}
+	return csvHeaderMap
+}
+
+// detectRoomKeyPageLayout detects the column of data for each header of a page.
+// headerRowIndex is index of header row in t and headerColumns holds
+// the column of each header text found in that row.
+func detectRoomKeyPageLayout(
+	t [][]string,
+	headerRowIndex int,
+	headerColumns map[string]int,
+	rules LayoutRules,
+) roomKeyPageLayout {
+
+	layout := roomKeyPageLayout{
+		DataColumns:       map[string]int{},
+		DescriptionColumn: rules.DescriptionColumn,
+		Confidence:        1,
+	}
+
+	// columns which hold header text can't hold data of other header
+	headerAt := map[int]string{}
+	for name, col := range headerColumns {
+		headerAt[col] = name
+	}
+
+	// collect sample of data rows and description rows of this page
+	dataRows := [][]string{}
+	descriptionCols := map[int]int{}
+	for rowIndex := headerRowIndex + 1; rowIndex < len(t); rowIndex++ {
+		row := t[rowIndex]
+		if isRoomKeyPageRow(row, rules) || len(dataRows) >= rules.SampleRows {
+			break
+		}
+
+		filled := []int{}
+		for col, cell := range row {
+			if strings.TrimSpace(cell) != "" {
+				filled = append(filled, col)
+			}
+		}
+
+		switch {
+		case len(filled) == 0:
+			continue
+		case len(filled) == 1 && headerAt[filled[0]] == "":
+			// only one cell with text is the description
+			descriptionCols[filled[0]]++
+		default:
+			dataRows = append(dataRows, row)
+		}
+	}
+
+	// the most common column of description rows
+	maxCount := 0
+	for col, count := range descriptionCols {
+		if count > maxCount || (count == maxCount && col < layout.DescriptionColumn) {
+			layout.DescriptionColumn = col
+			maxCount = count
+		}
+	}
+
+	// detect in sorted order so the result is stable
+	names := []string{}
+	for name := range headerColumns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// candidate columns of each header with values they match, headers
+	// without pattern keep their column
+	candidates := map[string][]layoutCandidate{}
+	detected := []string{}
+	for _, name := range names {
+		headerCol := headerColumns[name]
+		pattern, ok := rules.patterns[name]
+		if !ok || len(dataRows) == 0 {
+			layout.DataColumns[name] = headerCol
+			continue
+		}
+		detected = append(detected, name)
+
+		// header's own column first, then nearest ones
+		for shift := 0; shift <= rules.MaxShift; shift++ {
+			cols := []int{headerCol}
+			if shift > 0 {
+				cols = []int{headerCol - shift, headerCol + shift}
+			}
+			for _, col := range cols {
+				if col < 0 || (col != headerCol && headerAt[col] != "") {
+					continue
+				}
+				c := layoutCandidate{col: col, shift: shift}
+				for _, row := range dataRows {
+					if col >= len(row) || strings.TrimSpace(row[col]) == "" {
+						continue
+					}
+					c.filled++
+					if pattern.MatchString(strings.TrimSpace(row[col])) {
+						c.matched++
+					}
+				}
+				candidates[name] = append(candidates[name], c)
+			}
+		}
+	}
+
+	// each column holds data of one header only
+	taken := map[int]bool{}
+	for _, col := range layout.DataColumns {
+		taken[col] = true
+	}
+	assigned := assignLayoutColumns(detected, candidates, taken)
+
+	scores := []float64{}
+	for i, name := range detected {
+		c := assigned[i]
+		layout.DataColumns[name] = c.col
+
+		// column which is blank in all sample rows tells nothing
+		if c.filled == 0 {
+			continue
+		}
+
+		score := float64(c.matched) / float64(c.filled)
+		scores = append(scores, score)
+		if score < rules.MinConfidence {
+			layout.LowConfidence = append(layout.LowConfidence, name)
+		}
+	}
+
+	for _, score := range scores {
+		layout.Confidence = math.Min(layout.Confidence, score)
+	}
+
+	return layout
+}
+
+// layoutCandidate holds a column which can hold data of a header
+type layoutCandidate struct {
+	col     int
+	shift   int // distance from column of header
+	matched int // sample values which match pattern of header
+	filled  int // sample values which are not blank
+}
+
+// layoutScore holds how well columns fit their headers, more matching
+// values are better, then more filled columns and then less shift.
+// Shift is summed in squares so columns rather shift together.
+type layoutScore struct {
+	matched, filled, shift int
+}
+
+// better checks score is better than other one
+func (s layoutScore) better(o layoutScore) bool {
+	if s.matched != o.matched {
+		return s.matched > o.matched
+	}
+	if s.filled != o.filled {
+		return s.filled > o.filled
+	}
+	return s.shift < o.shift
+}
+
+// assignLayoutColumns returns a column for each header in names so that
+// no column is taken twice and the columns fit their headers best. On tie
+// the first found wins, candidates start with column of header so it is
+// preferred. Columns already taken are not used.
+func assignLayoutColumns(names []string, candidates map[string][]layoutCandidate, taken map[int]bool) []layoutCandidate {
+	best := make([]layoutCandidate, len(names))
+	bestScore := layoutScore{matched: -1}
+	current := make([]layoutCandidate, len(names))
+
+	// values any header left can match at most, used to skip choices
+	// which can't be better
+	maxMatched := make([]int, len(names)+1)
+	for i := len(names) - 1; i >= 0; i-- {
+		most := 0
+		for _, c := range candidates[names[i]] {
+			if c.matched > most {
+				most = c.matched
+			}
+		}
+		maxMatched[i] = maxMatched[i+1] + most
+	}
+
+	var assign func(i int, score layoutScore)
+	assign = func(i int, score layoutScore) {
+		if score.matched+maxMatched[i] < bestScore.matched {
+			return
+		}
+		if i == len(names) {
+			if score.better(bestScore) {
+				bestScore = score
+				copy(best, current)
+			}
+			return
+		}
+		for _, c := range candidates[names[i]] {
+			if taken[c.col] {
+				continue
+			}
+			taken[c.col] = true
+			current[i] = c
+			next := layoutScore{matched: score.matched + c.matched, filled: score.filled, shift: score.shift + c.shift*c.shift}
+			if c.filled > 0 {
+				next.filled++
+			}
+			assign(i+1, next)
+			delete(taken, c.col)
+		}
+	}
+	assign(0, layoutScore{})
+
+	return best
+}
+
+// getLayoutWarning returns the warning text for a page
+// which layout is detected with low confidence
+func getLayoutWarning(pageNo int, layout roomKeyPageLayout) string {
+	return fmt.Sprintf(
+		"W:<%s>:Layout of page %d is detected with low confidence (%.0f%%), please verify columns: %s",
+		core.DBTypeMapStrings[core.DBRentalAgreement], pageNo,
+		layout.Confidence*100, strings.Join(layout.LowConfidence, ", "),
+	)
+}
@@ -0,0 +1,124 @@
+package roomkey
+
+import (
+	"importers/core"
+	"rentroll/rlib"
+	"testing"
+)
+
+func TestDetectRoomKeyPageLayout(t *testing.T) {
+	profile, err := loadProfile(sampleProfileJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	headerList, err := core.GetCSVHeaders(sampleHeaderJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// header row is line 6 of sample, date in is printed
+	// one column right of its header
+	sample := rlib.LoadCSV(sampleRoomKeyCSV)
+	if len(sample) < 6 {
+		t.Fatalf("unable to load %s", sampleRoomKeyCSV)
+	}
+	ok, headerColumns := isRoomKeyHeaderLine(sample[5], headerList)
+	if !ok {
+		t.Fatalf("line 6 of %s is not header line", sampleRoomKeyCSV)
+	}
+
+	// description rows can't be in a column of header text
+	header := []string{"", "Guest", "Res. ", "Date Res", "Date In", "Date Out", "Room"}
+	_, shortHeaderColumns := isRoomKeyHeaderLine(header, headerList)
+
+	// dates in and out are printed next to each other two columns
+	// right of their headers, both can't take the first of them
+	wideHeader := []string{"", "Guest", "Res. ", "Date Res", "Date In", "Date Out", "", "", "Room"}
+	_, wideHeaderColumns := isRoomKeyHeaderLine(wideHeader, headerList)
+
+	tests := []struct {
+		name          string
+		t             [][]string
+		headerRow     int
+		headerColumns map[string]int
+		want          map[string]int
+		description   int
+		lowConfidence bool
+	}{
+		{
+			name:          "sample",
+			t:             sample,
+			headerRow:     5,
+			headerColumns: headerColumns,
+			want:          map[string]int{"Guest": 1, "Res": 3, "DateRes": 4, "DateIn": 6, "DateOut": 7, "Room": 13, "Rate": 15},
+			description:   2,
+		},
+		{
+			name: "data shifted left",
+			t: [][]string{
+				header,
+				{"", "Adams, Andrew", "10806", "25-Apr-2018", "01-May-2018", "30-Aug-2018", "6373296"},
+				{"", "", "", "", "", "", "", "FAA Authorization Number: 418008988"},
+				{"", "Dunn, Schiler", "10828", "09-May-", "15-May-2018", "06-Jun-2018", "6387348"},
+			},
+			headerColumns: shortHeaderColumns,
+			want:          map[string]int{"Guest": 1, "Res": 2, "DateRes": 3, "DateIn": 4, "DateOut": 5, "Room": 6},
+			description:   7,
+		},
+		{
+			name: "adjacent date columns",
+			t: [][]string{
+				wideHeader,
+				{"", "Adams, Andrew", "10806", "25-Apr-2018", "", "", "01-May-2018", "30-Aug-2018", "6373296"},
+				{"", "Dunn, Schiler", "10828", "09-May-2018", "", "", "15-May-2018", "06-Jun-2018", "6387348"},
+			},
+			headerColumns: wideHeaderColumns,
+			want:          map[string]int{"Guest": 1, "Res": 2, "DateRes": 3, "DateIn": 6, "DateOut": 7, "Room": 8},
+			description:   profile.Layout.DescriptionColumn,
+		},
+		{
+			name: "no data rows",
+			t: [][]string{
+				header,
+				{"Page 1 of 1"},
+			},
+			headerColumns: shortHeaderColumns,
+			want:          shortHeaderColumns,
+			description:   profile.Layout.DescriptionColumn,
+		},
+		{
+			name: "unexpected values",
+			t: [][]string{
+				header,
+				{"", "Adams, Andrew", "10806", "25-Apr-2018", "TBD", "30-Aug-2018", "6373296"},
+				{"", "Dunn, Schiler", "10828", "09-May-", "15-May-2018", "06-Jun-2018", "6387348"},
+			},
+			headerColumns: shortHeaderColumns,
+			want:          map[string]int{"DateIn": 4},
+			description:   profile.Layout.DescriptionColumn,
+			lowConfidence: true,
+		},
+	}
+
+	for _, tt := range tests {
+		layout := detectRoomKeyPageLayout(tt.t, tt.headerRow, tt.headerColumns, profile.Layout)
+		for name, col := range tt.want {
+			if layout.DataColumns[name] != col {
+				t.Errorf("%s: column of %s = %d, want %d", tt.name, name, layout.DataColumns[name], col)
+			}
+		}
+		if layout.DescriptionColumn != tt.description {
+			t.Errorf("%s: description column = %d, want %d", tt.name, layout.DescriptionColumn, tt.description)
+		}
+		taken := map[int]string{}
+		for name, col := range layout.DataColumns {
+			if other, ok := taken[col]; ok {
+				t.Errorf("%s: column %d is taken by both %s and %s", tt.name, col, name, other)
+			}
+			taken[col] = name
+		}
+		if (len(layout.LowConfidence) > 0) != tt.lowConfidence {
+			t.Errorf("%s: low confidence %v, confidence %.2f", tt.name, layout.LowConfidence, layout.Confidence)
+		}
+	}
+}
@@ -3,9 +3,11 @@ package roomkey
 import (
 	"context"
 	"errors"
+	"fmt"
 	"importers/core"
 	"os"
 	"path"
+	"reflect"
 	"rentroll/rcsv"
 	"rentroll/rlib"
 	"sort"
@@ -19,7 +21,7 @@ import (
 func loadRoomKeyCSV(
 	ctx context.Context,
 	roomKeyCSV string,
-	guestInfo map[string][]string,
+	guestInfo guestInfoIndex,
 	guestHeaderMap map[string]core.CSVHeader,
 	guestCSVSupplied bool,
 	testMode int,
@@ -28,9 +30,13 @@ func loadRoomKeyCSV(
 	currentTime time.Time,
 	currentTimeFormat string,
 	summaryReport map[int]map[string]int,
-) (map[int][]string, bool) {
+	rowNotes map[int][]core.RowNote,
+	raTemplates map[int]core.RATemplateChoice,
+	duplicates map[int]core.PersonDuplicate,
+	importRecord *core.ImportRecord,
+) (map[int][]string, *roomKeyUpdate, bool) {
 
-	// returns csvError list, csv loaded?
+	// returns csvError list, updates of agreements, csv loaded?
 
 	// returned csv errors should be in format
 	// {
@@ -46,6 +52,9 @@ func loadRoomKeyCSV(
 	internalErrFlag := true
 	csvErrors := map[int][]string{}
 
+	// update holds changes of agreements made by report, nil if report loads them
+	var update *roomKeyUpdate
+
 	// this holds the records for each row index
 	csvRowDataMap := map[int][]string{}
 
@@ -56,7 +65,7 @@ func loadRoomKeyCSV(
 	folderPath, err := osext.ExecutableFolder()
 	if err != nil {
 		rlib.Ulog("INTERNAL ERROR <ROOMKEY GETTING FOLDERPATH>: %s\n", err.Error())
-		return csvErrors, internalErrFlag
+		return csvErrors, update, internalErrFlag
 	}
 
 	// read json file which contains mapping of onesite fields
@@ -66,7 +75,7 @@ func loadRoomKeyCSV(
 	err = core.GetFieldMapping(&RoomKeyFieldMap, mapperFilePath)
 	if err != nil {
 		rlib.Ulog("INTERNAL ERROR <ROOMKEY FIELD MAPPING>: %s\n", err.Error())
-		return csvErrors, internalErrFlag
+		return csvErrors, update, internalErrFlag
 	}
 
 	// get Headers of csv
@@ -75,87 +84,128 @@ func loadRoomKeyCSV(
 	csvHeaderList, err := core.GetCSVHeaders(headerFilePath)
 	if err != nil {
 		rlib.Ulog("INTERNAL ERROR <ROOMKEY GETTING CSV HEADERS>: %s\n", err.Error())
-		return csvErrors, internalErrFlag
+		return csvErrors, update, internalErrFlag
+	}
+
+	// read json file which contains rules to find duplicate people
+	matchFilePath := path.Join(folderPath, "match.json")
+
+	personMatchRules, err := core.GetPersonMatchRules(matchFilePath)
+	if err != nil {
+		rlib.Ulog("INTERNAL ERROR <ROOMKEY PERSON MATCH RULES>: %s\n", err.Error())
+		return csvErrors, update, internalErrFlag
+	}
+
+	// read json file which contains site specific rules
+	profileFilePath := path.Join(folderPath, "profile.json")
+
+	roomKeyProfile, err := loadProfile(profileFilePath)
+	if err != nil {
+		rlib.Ulog("INTERNAL ERROR <ROOMKEY PROFILE>: %s\n", err.Error())
+		return csvErrors, update, internalErrFlag
 	}
 
 	// load csv file and get data from csv
 	t := rlib.LoadCSV(roomKeyCSV)
 
-	// this will be helpful while we have "description" type of row
-	// so that we can put it in currentDataRowIndex's csvRow
-	currentDataRowIndex := 0
+	// type of report decides what to do with agreements
+	roomKeyReportType := detectRoomKeyReportType(t, csvHeaderList, roomKeyProfile, csvErrors)
 
-	headersFirstOccurenceFound := false
+	// years which roomkey drops from dates are inferred from date printed
+	// in banner, dates of rows which need it can't be read without it
+	reportDate := getRoomKeyReportDate(t, csvHeaderList)
 
 	// map for csv headers in onesite csv file to access data fastly
 	// by it's header name rather than iterating over slice every time
-	// to look for a specific CSVHeader
-	csvHeaderMap := map[string]core.CSVHeader{}
+	// to look for a specific CSVHeader, all data rows are loaded in
+	// the order of header list whatever the layout of page is
+	csvHeaderMap := getCanonicalHeaderMap(csvHeaderList)
 
-	isPageZero := true
-	for rowIndex := 1; rowIndex <= len(t); rowIndex++ {
+	// data rows with their description, keyed by line
+	csvRowDataMap = readRoomKeyCSVRows(t, csvHeaderList, csvHeaderMap, roomKeyProfile, csvErrors)
 
-		// if it is header line then skip it
-		if ok, headerMap := isRoomKeyHeaderLine(t[rowIndex-1], isPageZero, csvHeaderList); ok {
-			csvHeaderMap = headerMap
-			headersFirstOccurenceFound = true
-
-			continue
-		}
-
-		// if first time headers are not detected then do continue
-		if !headersFirstOccurenceFound {
-			continue
-		}
+	// if csvRowDataMap is empty, that means data could not be parsed from csv
+	if len(csvRowDataMap) == 0 {
+		internalErrFlag = false
+		csvErrors[-1] = append(csvErrors[-1], "There are no data rows present")
+		return csvErrors, update, internalErrFlag
+	}
 
-		// check it is page row
-		if isRoomKeyPageRow(t[rowIndex-1]) {
-			isPageZero = false
-			continue
+	// ==============================================================
+	// DEPARTURES, CANCELLATIONS AND GUEST HISTORY UPDATE AGREEMENTS OF
+	// STAYS IMPORTED BEFORE, BUSINESS IS NOT DELETED OR LOADED AGAIN
+	// ==============================================================
+	if isUpdateReportAction(roomKeyReportType.Action) {
+		// records exist already, none of them is imported
+		err = core.GetExistingCount(ctx, summaryReport, business.BID)
+		if err != nil {
+			rlib.Ulog("INTERNAL ERROR <EXISTING RECORDS>: %s\n", err.Error())
+			return csvErrors, update, internalErrFlag
 		}
 
-		// check it is description row
-		if isRoomKeyDescriptionRow(t[rowIndex-1]) {
-			csvRowDataMap[currentDataRowIndex][rowTypeDetectionCSVIndex["description"]] += descriptionFieldSep + strings.TrimSpace(t[rowIndex-1][rowTypeDetectionCSVIndex["description"]])
-			continue
+		var possible int
+		update, possible, err = updateRoomKeyAgreements(ctx, business.BID,
+			csvRowDataMap, csvHeaderMap, roomKeyReportType, reportDate, csvErrors, rowNotes)
+		if err != nil {
+			rlib.Ulog("INTERNAL ERROR <ROOMKEY UPDATE>: %s\n", err.Error())
+			return csvErrors, update, internalErrFlag
 		}
+		summaryReport[core.DBRentalAgreement]["possible"] = possible
 
-		skipRow, csvRow := loadRoomKeyCSVRow(csvHeaderMap, t[rowIndex-1], isPageZero)
+		internalErrFlag = false
+		return csvErrors, update, internalErrFlag
+	}
 
-		if skipRow {
-			// in case blank row detected
-			continue
+	// ==============================================================
+	// ARRIVALS ARE ADDED TO STAYS IMPORTED BEFORE, BUSINESS IS KEPT
+	// ==============================================================
+	// agreements of arrivals start at date in, which is in future
+	addOnly := isAddReportAction(roomKeyReportType.Action)
+	if addOnly {
+		err = core.GetExistingCount(ctx, summaryReport, business.BID)
+		if err != nil {
+			rlib.Ulog("INTERNAL ERROR <EXISTING RECORDS>: %s\n", err.Error())
+			return csvErrors, update, internalErrFlag
 		}
-
-		// map this row as currentDataRowIndex and also hold a reference in datamap
-		csvRowDataMap[rowIndex] = csvRow
-		currentDataRowIndex = rowIndex
-
+		// undo removes only what this run has loaded
+		importRecord.Mode = core.ImportModeDelta
 	}
 
-	// if csvRowDataMap is empty, that means data could not be parsed from csv
-	if len(csvRowDataMap) == 0 {
-		internalErrFlag = false
-		csvErrors[-1] = append(csvErrors[-1], "There are no data rows present")
-		return csvErrors, internalErrFlag
+	// ========================================================
+	// EXISTING PEOPLE OF BUSINESS ARE CANDIDATES OF DUPLICATES
+	// ========================================================
+	// they are loaded before business is deleted, so they are
+	// reported but not merged with, arrivals are merged with them
+	personMatcher := core.NewPersonMatcher(personMatchRules)
+	err = personMatcher.LoadTransactantRecords(ctx, business.BID)
+	if err != nil {
+		rlib.Ulog("INTERNAL ERROR <LOAD TRANSACTANTS>: %s\n", err.Error())
+		return csvErrors, update, internalErrFlag
 	}
 
 	// =================================
 	// DELETE DATA RELATED TO BUSINESS ID
 	// =================================
 	// delete business related data before starting to import in database
-	_, err = rlib.DeleteBusinessFromDB(ctx, business.BID)
-	if err != nil {
-		rlib.Ulog("INTERNAL ERROR <DELETE BUSINESS>: %s\n", err.Error())
-		return csvErrors, internalErrFlag
-	}
+	if !addOnly {
+		personMatcher.SetTransactantsDeleted()
 
-	_, err = rlib.InsertBusiness(ctx, business)
-	if err != nil {
-		rlib.Ulog("INTERNAL ERROR <INSERT BUSINESS>: %s\n", err.Error())
-		return csvErrors, internalErrFlag
+		_, err = rlib.DeleteBusinessFromDB(ctx, business.BID)
+		if err != nil {
+			rlib.Ulog("INTERNAL ERROR <DELETE BUSINESS>: %s\n", err.Error())
+			return csvErrors, update, internalErrFlag
+		}
+
+		_, err = rlib.InsertBusiness(ctx, business)
+		if err != nil {
+			rlib.Ulog("INTERNAL ERROR <INSERT BUSINESS>: %s\n", err.Error())
+			return csvErrors, update, internalErrFlag
+		}
 	}
 
+	// mergedPeople holds the person with which people of the row is merged
+	mergedPeople := map[int]core.PersonRecord{}
+
 	// ========================================================
 	// WRITE DATA FOR RENTABLE TYPE, PEOPLE CSV
 	// ========================================================
@@ -168,7 +218,18 @@ func loadRoomKeyCSV(
 		)
 	if !ok {
 		rlib.Ulog("INTERNAL ERROR <RENTABLE TYPE CSV>\n")
-		return csvErrors, internalErrFlag
+		return csvErrors, update, internalErrFlag
+	}
+
+	// get created customAttibutes csv and writer pointer
+	customAttributeCSVFile, customAttributeCSVWriter, ok :=
+		CreateCustomAttibutesCSV(
+			TempCSVStore, currentTimeFormat,
+			&RoomKeyFieldMap.CustomAttributeCSV,
+		)
+	if !ok {
+		rlib.Ulog("INTERNAL ERROR <CUSTOM ATTRIUTE CSV>\n")
+		return csvErrors, update, internalErrFlag
 	}
 
 	// get created people csv and writer pointer
@@ -179,7 +240,7 @@ func loadRoomKeyCSV(
 		)
 	if !ok {
 		rlib.Ulog("INTERNAL ERROR <PEOPLE CSV>: %s\n", err.Error())
-		return csvErrors, internalErrFlag
+		return csvErrors, update, internalErrFlag
 	}
 
 	// To store the keys in slice in sorted order
@@ -195,12 +256,16 @@ func loadRoomKeyCSV(
 	// so that duplicate entries can be avoided while creating rentableType csv file
 	avoidDuplicateRentableTypeData := []string{}
 	avoidDuplicatePeopleData := []string{}
+	avoidDuplicateCustomAttributeData := []string{}
 
 	// --------------------------- csv record count ----------------------------
 	// <TYPE>CSVRecordCount used to hold records count inserted in csv
 	// initialize with 1 because first row contains headers in target generated csv
 	// these are POSSIBLE record count that going to be imported
 	RentableTypeCSVRecordCount := 0
+	CustomAttributeCSVRecordCount := 0
+	CustomAttrRefRecordCount := 0
+	VehicleRecordCount, VehicleImportedCount := 0, 0
 	RentableCSVRecordCount := 0
 	PeopleCSVRecordCount := 0
 	RentalAgreementCSVRecordCount := 0
@@ -210,6 +275,7 @@ func loadRoomKeyCSV(
 	// by which we can traceout which records has been writtern to csv
 	// with key of row index of <TARGET_TYPE> CSV, value of original's imported csv rowNumber
 	traceRentableTypeCSVMap := map[int]int{}
+	traceCustomAttributeCSVMap := map[int]int{}
 	tracePeopleCSVMap := map[int]int{}
 	traceRentableCSVMap := map[int]int{}
 	traceRentalAgreementCSVMap := map[int]int{}
@@ -221,8 +287,19 @@ func loadRoomKeyCSV(
 	// tracePeopleNote holds people note with reference of original roomkey csv
 	tracePeopleNote := map[int]string{}
 
-	// peopleCollisions holds count of people with same name
-	peopleCollisions := map[string]int{}
+	// traceCustomAttributes holds custom attributes of guest for each row,
+	// found in description with the rules of profile
+	traceCustomAttributes := map[int][]core.CustomAttributeValue{}
+
+	// traceRowDates holds parsed dates for each row
+	traceRowDates := map[int]roomKeyRowDates{}
+
+	// traceRAFields holds rental agreement field values for each row,
+	// found in description with the rules of profile
+	traceRAFields := map[int]map[string]string{}
+
+	// traceGuestData holds matched row of guest export for each row
+	traceGuestData := map[int][]string{}
 
 	// traceDuplicatePeople holds records with unique string (name, email, phone)
 	// with duplicant match at row
@@ -236,6 +313,7 @@ func loadRoomKeyCSV(
 	// --------------------------- variables to hold the data to be written------------------
 	// <TYPE>CSVData used to hold the data of the <Type>.csv file
 	var rentableTypeCSVData [][]string
+	var customAttributeCSVData [][]string
 	var peopleCSVData [][]string
 	var rentableCSVData [][]string
 	var rentalAgreementCSVData [][]string
@@ -255,26 +333,56 @@ func loadRoomKeyCSV(
 			currentTime,
 			userRRValues,
 			&RoomKeyFieldMap.RentableTypeCSV,
+			RoomKeyFieldMap.Transforms["RentableTypeCSV"],
 			business,
 			&rentableTypeCSVData,
 			csvHeaderMap,
 		)
 
+		// parse dates of the row, missing years are taken from report date
+		traceRowDates[rowIndex] = getRoomKeyRowDates(
+			rowIndex, csvRow, csvHeaderMap, reportDate, csvErrors,
+		)
+
+		// pull structured values out of description
+		descriptionValues := extractDescriptionValues(
+			csvRow[csvHeaderMap["Description"].Index],
+			roomKeyProfile.DescriptionRules,
+		)
+		checkDescriptionDates(rowIndex, csvRow, traceRowDates[rowIndex], descriptionValues, csvErrors, csvHeaderMap)
+		traceRAFields[rowIndex] = getDescriptionRAFields(descriptionValues)
+		traceCustomAttributes[rowIndex] = getDescriptionCustomAttributes(descriptionValues)
+
 		guestdata := []string{}
 		if guestCSVSupplied {
-			if data, ok := guestInfo[csvRow[csvHeaderMap["Guest"].Index]]; ok {
-				guestdata = data
+			guestMatch := guestInfo.match(csvRow, csvHeaderMap, traceRowDates[rowIndex], guestHeaderMap)
+			if warning := getGuestMatchWarning(csvRow[csvHeaderMap["Guest"].Index], guestMatch, roomKeyProfile.GuestMatch); warning != "" {
+				csvErrors[rowIndex] = append(csvErrors[rowIndex], warning)
+			}
+			if guestMatch.Row != nil {
+				guestdata = guestMatch.Row
 			}
 		}
+		traceGuestData[rowIndex] = guestdata
+
+		// loyalty and consent of guest are kept as custom attributes
+		traceCustomAttributes[rowIndex] = append(traceCustomAttributes[rowIndex],
+			getGuestCustomAttributes(guestdata, guestHeaderMap, roomKeyProfile.GuestAttributes)...)
+
+		// Read data for custom attribute csv
+		ReadCustomAttributeCSVData(
+			&CustomAttributeCSVRecordCount,
+			rowIndex,
+			traceCustomAttributeCSVMap,
+			traceCustomAttributes[rowIndex],
+			&customAttributeCSVData,
+			&avoidDuplicateCustomAttributeData,
+			userRRValues,
+		)
 
 		traceTCIDMap[rowIndex] = ""
 		tracePeopleNote[rowIndex] = csvRow[csvHeaderMap["Description"].Index]
 
-		peopleCollisions[csvRow[csvHeaderMap["Guest"].Index]]++
-		if peopleCollisions[csvRow[csvHeaderMap["Guest"].Index]] > 1 {
-			guestdata = []string{}
-		}
-
 		// Read data for people csv
 		ReadPeopleCSVData(
 			&PeopleCSVRecordCount,
@@ -284,29 +392,44 @@ func loadRoomKeyCSV(
 			&avoidDuplicatePeopleData,
 			userRRValues,
 			&RoomKeyFieldMap.PeopleCSV,
+			RoomKeyFieldMap.Transforms["PeopleCSV"],
 			tracePeopleNote,
 			traceDuplicatePeople,
+			personMatcher,
+			mergedPeople,
 			csvErrors,
 			guestdata,
 			guestCSVSupplied,
 			guestHeaderMap,
+			roomKeyProfile.SecondContactIsEmergency,
 			&peopleCSVData,
 			csvHeaderMap,
 		)
 
 	}
 
+	// duplicates found are reported by line
+	for line, d := range personMatcher.GetDuplicates() {
+		duplicates[line] = d
+	}
+
 	for _, data := range rentableTypeCSVData {
 		rentableTypeCSVWriter.Write(data)
 		rentableTypeCSVWriter.Flush()
 	}
 
+	for _, data := range customAttributeCSVData {
+		customAttributeCSVWriter.Write(data)
+		customAttributeCSVWriter.Flush()
+	}
+
 	for _, data := range peopleCSVData {
 		peopleCSVWriter.Write(data)
 		peopleCSVWriter.Flush()
 	}
 	// Close all files as we are done here with writing data
 	rentableTypeCSVFile.Close()
+	customAttributeCSVFile.Close()
 	peopleCSVFile.Close()
 
 	// =======================
@@ -318,6 +441,8 @@ func loadRoomKeyCSV(
 		switch traceDataMapName {
 		case "traceRentableTypeCSVMap":
 			return traceRentableTypeCSVMap
+		case "traceCustomAttributeCSVMap":
+			return traceCustomAttributeCSVMap
 		case "tracePeopleCSVMap":
 			return tracePeopleCSVMap
 		case "traceRentableCSVMap":
@@ -338,11 +463,38 @@ func loadRoomKeyCSV(
 		return roomKeyIndex
 	}
 
+	// getLoadedKeys returns keys of rows written in csv of data type,
+	// import record finds the records loaded from csv by them
+	getLoadedKeys := func(dbType int) []string {
+		switch dbType {
+		case core.DBCustomAttr:
+			return core.GetCSVRowKeys(reflect.TypeOf(RoomKeyFieldMap.CustomAttributeCSV), customAttributeCSVData, "Name", "Value")
+		case core.DBRentableType:
+			return core.GetCSVRowKeys(reflect.TypeOf(RoomKeyFieldMap.RentableTypeCSV), rentableTypeCSVData, "Style")
+		case core.DBRentable:
+			return core.GetCSVRowKeys(reflect.TypeOf(RoomKeyFieldMap.RentableCSV), rentableCSVData, "Name")
+		case core.DBRentalAgreement:
+			return core.GetAgreementRowKeys(reflect.TypeOf(RoomKeyFieldMap.RentalAgreementCSV), rentalAgreementCSVData)
+		default:
+			return nil
+		}
+	}
+
 	// rrDoLoad is a nested function
 	// used to load data from csv with help of rcsv loaders
 	rrDoLoad := func(ctx context.Context, fname string, handler func(context.Context, string) []error, traceDataMapName string, dbType int) bool {
+		if err := importRecord.BeginLoad(ctx, dbType); err != nil {
+			rlib.Ulog("INTERNAL ERROR <IMPORT RECORD>: %s\n", err.Error())
+			return false
+		}
+
 		Errs := handler(ctx, fname)
 
+		if err := importRecord.EndLoad(ctx, business.BID, dbType, getLoadedKeys(dbType)); err != nil {
+			rlib.Ulog("INTERNAL ERROR <IMPORT RECORD>: %s\n", err.Error())
+			return false
+		}
+
 		for _, err := range Errs {
 			// skip warnings about already existing records
 			// if it's not kind of to skip then process it and count in error report
@@ -372,6 +524,12 @@ func loadRoomKeyCSV(
 	// rrPeopleDoLoad (SPECIAL METHOD TO LOAD PEOPLE)
 	// *****************************************************
 	rrPeopleDoLoad := func(ctx context.Context, fname string, handler func(context.Context, string) []error, traceDataMapName string, dbType int) bool {
+		// people loaded are known by their notes after load
+		if err := importRecord.BeginLoad(ctx, dbType); err != nil {
+			rlib.Ulog("INTERNAL ERROR <IMPORT RECORD>: %s\n", err.Error())
+			return false
+		}
+
 		Errs := handler(ctx, fname)
 
 		for _, err := range Errs {
@@ -391,17 +549,15 @@ func loadRoomKeyCSV(
 					continue
 				}
 
-				// load csvRow from dataMap troomkeyIndexo get email
-				csvRow := csvRowDataMap[roomkeyIndex]
-
+				// matched guest of the row holds the email
 				pEmail := ""
-				if guestCSVSupplied {
-					if data, ok := guestInfo[csvRow[csvHeaderMap["Guest"].Index]]; ok {
-						pEmail = data[guestHeaderMap["Email"].Index]
-					}
+				if data := traceGuestData[roomkeyIndex]; len(data) > 0 {
+					pEmail = data[guestHeaderMap["Email"].Index]
 				}
 
 				// get tcid from email
+				// people are stored with normalised email
+				pEmail, _ = core.NormalizeEmail(pEmail)
 				t, tErr := rlib.GetTransactantByPhoneOrEmail(ctx, business.BID, pEmail)
 				if tErr != nil {
 					// t = rlib.GetTransactantByName(business.BID, csvRow.Guest)
@@ -431,17 +587,15 @@ func loadRoomKeyCSV(
 				if _, ok := csvRowDataMap[roomkeyIndex]; !ok {
 					continue
 				}
-				// load csvRow from dataMap to get email
-				csvRow := csvRowDataMap[roomkeyIndex]
-				// pCellNo := csvRow.PhoneNumber
+				// matched guest of the row holds the phone number
 				pCellNo := ""
-				if guestCSVSupplied {
-					if data, ok := guestInfo[csvRow[csvHeaderMap["Guest"].Index]]; ok {
-						pCellNo = data[guestHeaderMap["MainPhone"].Index]
-					}
+				if data := traceGuestData[roomkeyIndex]; len(data) > 0 {
+					pCellNo = data[guestHeaderMap["MainPhone"].Index]
 				}
 
 				// get tcid from cellphonenumber
+				// people are stored with normalised phone
+				pCellNo, _ = core.NormalizePhone(pCellNo, userRRValues["DefaultCountry"])
 				t, tErr := rlib.GetTransactantByPhoneOrEmail(ctx, business.BID, pCellNo)
 				if tErr != nil {
 					// unable to get TCID
@@ -478,10 +632,14 @@ func loadRoomKeyCSV(
 		return true
 	}
 
-	// ======================
-	// LOAD RENTABLE TYPE CSV
-	// ======================
+	// =========================================
+	// LOAD CUSTOM ATTRIBUTE & RENTABLE TYPE CSV
+	// =========================================
 	var h = []csvLoadHandler{
+		{
+			Fname: customAttributeCSVFile.Name(), Handler: rcsv.LoadCustomAttributesCSV,
+			TraceDataMap: "traceCustomAttributeCSVMap", DBType: core.DBCustomAttr,
+		},
 		{
 			Fname: rentableTypeCSVFile.Name(), Handler: rcsv.LoadRentableTypesCSV,
 			TraceDataMap: "traceRentableTypeCSVMap", DBType: core.DBRentableType,
@@ -493,11 +651,19 @@ func loadRoomKeyCSV(
 			if !rrDoLoad(ctx, h[i].Fname, h[i].Handler, h[i].TraceDataMap, h[i].DBType) {
 				// INTERNAL ERROR
 				rlib.Ulog("INTERNAL ERROR <RENTABLE TYPE CSV>\n")
-				return csvErrors, internalErrFlag
+				return csvErrors, update, internalErrFlag
 			}
 		}
 	}
 
+	// people of earlier imports carry notes of the same form,
+	// only the ones loaded by this run are taken after load
+	notedTCIDs, err := rlib.GetTCIDByNote(ctx, "%"+roomkeyNotesPrefix+"%")
+	if err != nil {
+		rlib.Ulog("INTERNAL ERROR <PEOPLE NOTES>: %s\n", err.Error())
+		return csvErrors, update, internalErrFlag
+	}
+
 	// ================
 	// LOAD PEOPLE CSV
 	// ================
@@ -512,7 +678,7 @@ func loadRoomKeyCSV(
 		if len(h[i].Fname) > 0 {
 			if !rrPeopleDoLoad(ctx, h[i].Fname, h[i].Handler, h[i].TraceDataMap, h[i].DBType) {
 				// INTERNAL ERROR
-				return csvErrors, internalErrFlag
+				return csvErrors, update, internalErrFlag
 			}
 		}
 	}
@@ -523,14 +689,61 @@ func loadRoomKeyCSV(
 
 	tcidMap, _ := rlib.GetTCIDByNote(ctx, "%"+roomkeyNotesPrefix+"%")
 
+	loadedTCIDs := []string{}
 	for tcid, note := range tcidMap {
+		if _, ok := notedTCIDs[tcid]; ok {
+			continue
+		}
 		note_temp := strings.SplitN(note, ".", 2)
 		note_temp = strings.SplitN(note_temp[0], ":", 2)
 		roomkeyIndex, _ := strconv.Atoi(note_temp[1])
 
 		traceTCIDMap[roomkeyIndex] = tcidPrefix + strconv.Itoa(int(tcid))
+		loadedTCIDs = append(loadedTCIDs, strconv.FormatInt(tcid, 10))
+	}
+	if err = importRecord.EndLoad(ctx, business.BID, core.DBPeople, loadedTCIDs); err != nil {
+		rlib.Ulog("INTERNAL ERROR <IMPORT RECORD>: %s\n", err.Error())
+		return csvErrors, update, internalErrFlag
+	}
+
+	// rows merged with other person take TCID of that person, agreement
+	// of row is not loaded if that person could not be loaded
+	noPayorRows := map[int]bool{}
+	for rowIndex, person := range mergedPeople {
+		switch {
+		case person.TCID > 0:
+			traceTCIDMap[rowIndex] = tcidPrefix + strconv.FormatInt(person.TCID, 10)
+			rowNotes[rowIndex] = append(rowNotes[rowIndex], core.RowNote{Status: core.RowStatusMerged,
+				Reason: fmt.Sprintf("guest is merged with transactant %d of business", person.TCID)})
+		case traceTCIDMap[person.Row] == "":
+			noPayorRows[rowIndex] = true
+			errText := fmt.Sprintf("E:<%s>:Guest is merged with guest of line %d who could not be loaded",
+				core.DBTypeMapStrings[core.DBPeople], person.Row)
+			csvErrors[rowIndex] = append(csvErrors[rowIndex], errText)
+		default:
+			traceTCIDMap[rowIndex] = traceTCIDMap[person.Row]
+			rowNotes[rowIndex] = append(rowNotes[rowIndex], core.RowNote{Status: core.RowStatusMerged,
+				Reason: fmt.Sprintf("guest is merged with guest of line %d", person.Row)})
+		}
 	}
 
+	// ========================================================
+	// INSERT CUSTOM ATTRIBUTE REF OF GUESTS AFTER TCID IS FOUND
+	// ========================================================
+	CustomAttrRefRecordCount = insertPersonCustomAttributeRefs(
+		ctx, business, traceCustomAttributes, csvRowDataMapKeys,
+		traceTCIDMap, csvErrors, importRecord,
+	)
+
+	// ========================================================
+	// INSERT VEHICLES OF GUESTS AFTER TCID IS FOUND
+	// ========================================================
+	VehicleRecordCount, VehicleImportedCount = insertPersonVehicles(
+		ctx, business, traceGuestData, guestHeaderMap,
+		traceRowDates, csvRowDataMapKeys,
+		traceTCIDMap, currentTime, csvErrors, importRecord,
+	)
+
 	// ==============================================================
 	// AFTER POSSIBLE TCID FOUND, WRITE RENTABLE & RENTAL AGREEMENT CSV
 	// ==============================================================
@@ -543,7 +756,7 @@ func loadRoomKeyCSV(
 		)
 	if !ok {
 		rlib.Ulog("INTERNAL ERROR <RENTABLE CSV>: %s\n", err.Error())
-		return csvErrors, internalErrFlag
+		return csvErrors, update, internalErrFlag
 	}
 
 	// get created rental agreement csv and writer pointer
@@ -554,7 +767,7 @@ func loadRoomKeyCSV(
 		)
 	if !ok {
 		rlib.Ulog("INTERNAL ERROR <RENTAL AGREEMENT CSV>: %s\n", err.Error())
-		return csvErrors, internalErrFlag
+		return csvErrors, update, internalErrFlag
 	}
 
 	// iteration over csv row data structure and write data to csv
@@ -572,12 +785,18 @@ func loadRoomKeyCSV(
 			currentTime,
 			userRRValues,
 			&RoomKeyFieldMap.RentableCSV,
+			RoomKeyFieldMap.Transforms["RentableCSV"],
 			traceTCIDMap,
 			csvErrors,
 			&rentableCSVData,
 			csvHeaderMap,
 		)
 
+		// agreement of guest who could not be loaded has no payor
+		if noPayorRows[rowIndex] {
+			continue
+		}
+
 		// Read data for Rentable csv
 		ReadRentalAgreementCSVData(
 			&RentalAgreementCSVRecordCount,
@@ -587,10 +806,16 @@ func loadRoomKeyCSV(
 			currentTime,
 			userRRValues,
 			&RoomKeyFieldMap.RentalAgreementCSV,
+			RoomKeyFieldMap.Transforms["RentalAgreementCSV"],
 			traceTCIDMap,
+			traceRowDates[rowIndex],
+			traceRAFields[rowIndex],
+			roomKeyReportType,
 			csvErrors,
 			&rentalAgreementCSVData,
 			csvHeaderMap,
+			roomKeyProfile.RATemplateRules,
+			raTemplates,
 		)
 	}
 
@@ -620,7 +845,7 @@ func loadRoomKeyCSV(
 		if len(h[i].Fname) > 0 {
 			if !rrDoLoad(ctx, h[i].Fname, h[i].Handler, h[i].TraceDataMap, h[i].DBType) {
 				// INTERNAL ERROR
-				return csvErrors, internalErrFlag
+				return csvErrors, update, internalErrFlag
 			}
 		}
 	}
@@ -641,20 +866,25 @@ func loadRoomKeyCSV(
 	summaryReport[core.DBRentable]["possible"] = RentableCSVRecordCount
 	summaryReport[core.DBRentalAgreement]["possible"] = RentalAgreementCSVRecordCount
 	summaryReport[core.DBRentableType]["possible"] = RentableTypeCSVRecordCount
+	summaryReport[core.DBCustomAttr]["possible"] = CustomAttributeCSVRecordCount
+	summaryReport[core.DBCustomAttrRef]["possible"] = CustomAttrRefRecordCount
+	summaryReport[core.DBVehicle]["possible"] = VehicleRecordCount
+	summaryReport[core.DBVehicle]["imported"] = VehicleImportedCount
 	summaryReport[core.DBPeople]["possible"] = PeopleCSVRecordCount
 
 	internalErrFlag = false
 	// RETURN
-	return csvErrors, internalErrFlag
+	return csvErrors, update, internalErrFlag
 
 }
 
 func loadGuestInfoCSV(
 	guestInfoCSV string,
-) (map[string][]string, map[string]core.CSVHeader, error) {
+) (guestInfoIndex, map[string]core.CSVHeader, error) {
 
-	// store all guest info in guestInfoMap
-	guestInfoMap := make(map[string][]string)
+	// store all guest info in guestInfoMap, indexed by the keys
+	// with which guests of roomkey report are matched
+	guestInfoMap := newGuestInfoIndex()
 
 	// map for csv headers in roomkey csv file to access data fastly
 	// by it's header name rather than iterating over slice every time
@@ -769,8 +999,7 @@ func loadGuestInfoCSV(
 			break
 		}
 
-		guestName := t[rowIndex][guestHeaderMap["GuestName"].Index]
-		guestInfoMap[guestName] = t[rowIndex]
+		guestInfoMap.add(rowIndex+1, t[rowIndex], guestHeaderMap)
 	}
 
 	return guestInfoMap, guestHeaderMap, nil
@@ -802,6 +1031,8 @@ func CSVHandler(
 	testMode int,
 	userRRValues map[string]string,
 	business *rlib.Business,
+	htmlReport string,
+	annotatedCSV string,
 	debugMode int,
 ) (string, bool, bool) {
 
@@ -811,6 +1042,20 @@ func CSVHandler(
 	// report text
 	csvReport := ""
 
+	// ===== lock business for the whole import =====
+	importLock, err := core.AcquireImportLock(business.Designation)
+	if err != nil {
+		rlib.Ulog("IMPORT LOCK: %s\n", err.Error())
+		csvLoaded = false
+		csvReport = err.Error() + "\n"
+		return csvReport, false, csvLoaded
+	}
+	defer func() {
+		if err := importLock.Release(); err != nil {
+			rlib.Ulog("IMPORT LOCK: %s\n", err.Error())
+		}
+	}()
+
 	// get current timestamp used for creating csv files unique way
 	currentTime := time.Now()
 
@@ -823,10 +1068,13 @@ func CSVHandler(
 	// summaryReportCount contains each type csv as a key
 	// with count of total imported, possible, issues in csv data
 	summaryReportCount := map[int]map[string]int{
+		core.DBCustomAttr:      {"imported": 0, "possible": 0, "issues": 0},
 		core.DBRentableType:    {"imported": 0, "possible": 0, "issues": 0},
+		core.DBCustomAttrRef:   {"imported": 0, "possible": 0, "issues": 0},
 		core.DBPeople:          {"imported": 0, "possible": 0, "issues": 0},
 		core.DBRentable:        {"imported": 0, "possible": 0, "issues": 0},
 		core.DBRentalAgreement: {"imported": 0, "possible": 0, "issues": 0},
+		core.DBVehicle:         {"imported": 0, "possible": 0, "issues": 0},
 	}
 
 	// --------------------------------------------------------------------------------------------------------- //
@@ -836,7 +1084,10 @@ func CSVHandler(
 	// guestHeaderMap := getGuestHeaders()
 	var guestHeaderMap map[string]core.CSVHeader
 
-	var guestInfo map[string][]string
+	// record of this run in import history
+	importRecord := core.NewImportRecord("roomkey", business.Designation, []string{csvPath, GuestInfoCSV}, userRRValues, currentTime)
+
+	var guestInfo guestInfoIndex
 	var guestCSVError error
 
 	guestCSVSupplied := false
@@ -847,25 +1098,58 @@ func CSVHandler(
 		guestCSVSupplied = true
 		guestInfo, guestHeaderMap, guestCSVError = loadGuestInfoCSV(GuestInfoCSV)
 		if guestCSVError != nil {
+			importRecord.Finish(ctx, 0, core.ImportStatusFailed, summaryReportCount, map[int][]string{}, nil)
 			csvReport = "\n\n" + guestCSVError.Error()
 			return csvReport, false, false
 		}
 	}
 
+	// rows which are not imported as they are, with the reason
+	rowNotes := map[int][]core.RowNote{}
+
+	// templates chosen for agreements, keyed by line
+	raTemplates := map[int]core.RATemplateChoice{}
+
+	// possible duplicates of people, keyed by line
+	duplicates := map[int]core.PersonDuplicate{}
+
 	// ---------------------- call roomkey loader ----------------------------------------
-	csvErrs, internalErr := loadRoomKeyCSV(ctx,
+	csvErrs, update, internalErr := loadRoomKeyCSV(ctx,
 		csvPath, guestInfo, guestHeaderMap, guestCSVSupplied, testMode, userRRValues,
 		business, currentTime, currentTimeFormat,
-		summaryReportCount)
+		summaryReportCount, rowNotes, raTemplates, duplicates, importRecord)
+
+	// changes are reverted by undo, report tells which agreements are changed
+	updateReport := ""
+	if update != nil {
+		importRecord.Mode = core.ImportModeDelta
+		importRecord.Changes = update.RecordChanges
+		updateReport = "\n" + getUpdateReport(update)
+	}
 
 	// if internal error then just return from here, nothing to do
 	if internalErr {
+		importRecord.Finish(ctx, business.BID, core.ImportStatusFailed, summaryReportCount, csvErrs, nil)
 		return csvReport, internalErr, csvLoaded
 	}
 
+	// issues are kept with room of their line
+	lineUnits, headerLines := getRoomKeyLines(csvPath)
+
 	// check if there any errors from onesite loader
 	if len(csvErrs) > 0 {
-		csvReport, csvLoaded = errorReporting(ctx, business, csvErrs, summaryReportCount, csvPath, GuestInfoCSV, debugMode, currentTime)
+		csvReport, csvLoaded = errorReporting(ctx, business, csvErrs, summaryReportCount, raTemplates, duplicates, csvPath, GuestInfoCSV, debugMode, currentTime)
+
+		status := core.ImportStatusImported
+		if !csvLoaded {
+			status = core.ImportStatusIssues
+		}
+		importRecord.Finish(ctx, business.BID, status, summaryReportCount, csvErrs, lineUnits)
+		reconcileReport := getReconcileReport(ctx, business, csvPath, currentTime)
+		csvReport = "Import ID: " + importRecord.ImportID + "\n\n" + csvReport + updateReport
+		csvReport += "\n" + reconcileReport
+		csvReport += writeHTMLReport(htmlReport, importRecord, headerLines, getKPIReport(csvPath, currentTime), updateReport, reconcileReport)
+		csvReport += writeAnnotatedCSV(annotatedCSV, csvPath, headerLines, lineUnits, csvErrs, rowNotes)
 
 		// if not testmode then only do rollback
 		if testMode != 1 {
@@ -876,7 +1160,16 @@ func CSVHandler(
 	}
 
 	// ===== 4. Geneate Report =====
-	csvReport = successReport(ctx, business, summaryReportCount, csvPath, GuestInfoCSV, debugMode, currentTime)
+	csvReport = successReport(ctx, business, summaryReportCount, raTemplates, csvPath, GuestInfoCSV, debugMode, currentTime)
+
+	importRecord.Finish(ctx, business.BID, core.ImportStatusImported, summaryReportCount, csvErrs, lineUnits)
+	csvReport = "Import ID: " + importRecord.ImportID + "\n\n" + csvReport + updateReport
+
+	// rates of csv are reconciled with what business holds now
+	reconcileReport := getReconcileReport(ctx, business, csvPath, currentTime)
+	csvReport += "\n" + reconcileReport
+	csvReport += writeHTMLReport(htmlReport, importRecord, headerLines, getKPIReport(csvPath, currentTime), updateReport, reconcileReport)
+	csvReport += writeAnnotatedCSV(annotatedCSV, csvPath, headerLines, lineUnits, csvErrs, rowNotes)
 
 	// ===== 5. Return =====
 	return csvReport, internalErr, csvLoaded
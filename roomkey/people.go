@@ -62,12 +62,16 @@ func ReadPeopleCSVData(
 	avoidData *[]string,
 	suppliedValues map[string]string,
 	peopleStruct *core.PeopleCSV,
+	transforms core.FieldTransforms,
 	tracePeopleNote map[int]string,
 	traceDuplicatePeople map[string][]string,
+	personMatcher *core.PersonMatcher,
+	mergedPeople map[int]core.PersonRecord,
 	csvErrors map[int][]string,
 	guestData []string,
 	guestCSVSupplied bool,
 	guestHeaderMap map[string]core.CSVHeader,
+	secondContactIsEmergency bool,
 	peopleCSVData *[][]string,
 	csvHeaderMap map[string]core.CSVHeader,
 ) {
@@ -90,15 +94,45 @@ func ReadPeopleCSVData(
 		}
 	}
 
+	// parse name, guest export has name in separate columns so prefer it
+	fullName := rowName
+	if len(guestData) > 0 {
+		firstName := getGuestCell(guestData, guestHeaderMap, "FirstName")
+		lastName := getGuestCell(guestData, guestHeaderMap, "LastName")
+		if firstName != "" && lastName != "" {
+			fullName = lastName + ", " + firstName
+		}
+	}
+	personName := core.ParsePersonName(fullName, getGuestCell(guestData, guestHeaderMap, "Title"))
+	if warning := core.GetNameWarning(fullName, personName); warning != "" {
+		csvErrors[rowIndex] = append(csvErrors[rowIndex], warning)
+	}
+
 	// get csv row data
 	csvRowData := GetPeopleCSVRow(
 		csvRow, peopleStruct,
 		suppliedValues, rowIndex,
-		tracePeopleNote,
+		personName, tracePeopleNote,
 		guestData, guestCSVSupplied,
-		guestHeaderMap, csvHeaderMap,
+		guestHeaderMap, secondContactIsEmergency,
+		transforms, csvHeaderMap,
 	)
 
+	// clean up contact values, staff can see the changes in report
+	changes := core.NormalizePeopleCSVRow(csvRowData, suppliedValues["DefaultCountry"])
+	csvErrors[rowIndex] = append(csvErrors[rowIndex], core.GetNormalizeWarnings(changes)...)
+
+	// merge duplicate people, report the ones which need review
+	record := core.GetPersonRecord(csvRowData, rowIndex, rowIndex)
+	if match, ok := personMatcher.Match(record); ok {
+		csvErrors[rowIndex] = append(csvErrors[rowIndex], personMatcher.GetPersonMatchWarning(match))
+		if personMatcher.IsAutoMerge(match) {
+			mergedPeople[rowIndex] = match.Candidate
+			return
+		}
+	}
+	personMatcher.Add(record)
+
 	*peopleCSVData = append(*peopleCSVData, csvRowData)
 
 	// entry this rowindex with unit value in the map
@@ -113,10 +147,13 @@ func GetPeopleCSVRow(
 	fieldMap *core.PeopleCSV,
 	DefaultValues map[string]string,
 	rowIndex int,
+	personName core.PersonName,
 	tracePeopleNote map[int]string,
 	guestData []string,
 	guestCSVSupplied bool,
 	guestHeaderMap map[string]core.CSVHeader,
+	secondContactIsEmergency bool,
+	transforms core.FieldTransforms,
 	csvHeaderMap map[string]core.CSVHeader,
 ) []string {
 
@@ -131,6 +168,9 @@ func GetPeopleCSVRow(
 	// return data array
 	dataMap := make(map[int]string)
 
+	// fields from second contact block of guest export
+	secondContact := getGuestSecondContact(guestData, guestHeaderMap, secondContactIsEmergency)
+
 	for i := 0; i < pplLength; i++ {
 		// get people field
 		peopleField := reflectedPeopleFieldMap.Type().Field(i)
@@ -145,12 +185,6 @@ func GetPeopleCSVRow(
 		if guestCSVSupplied {
 
 			if len(guestData) > 0 && guestData[guestHeaderMap["GuestName"].Index] != "" {
-				if peopleField.Name == "FirstName" {
-					dataMap[i] = strings.TrimSpace(guestData[guestHeaderMap["FirstName"].Index])
-				}
-				if peopleField.Name == "LastName" {
-					dataMap[i] = strings.TrimSpace(guestData[guestHeaderMap["LastName"].Index])
-				}
 				if peopleField.Name == "PrimaryEmail" {
 					if core.IsValidEmail(guestData[guestHeaderMap["Email"].Index]) {
 						dataMap[i] = strings.TrimSpace(guestData[guestHeaderMap["Email"].Index])
@@ -162,9 +196,6 @@ func GetPeopleCSVRow(
 				if peopleField.Name == "Address" {
 					dataMap[i] = strings.TrimSpace(guestData[guestHeaderMap["Address"].Index])
 				}
-				if peopleField.Name == "Address2" {
-					dataMap[i] = strings.TrimSpace(guestData[guestHeaderMap["Address2"].Index])
-				}
 				if peopleField.Name == "City" {
 					dataMap[i] = strings.TrimSpace(guestData[guestHeaderMap["City"].Index])
 				}
@@ -177,8 +208,19 @@ func GetPeopleCSVRow(
 				if peopleField.Name == "Country" {
 					dataMap[i] = strings.TrimSpace(guestData[guestHeaderMap["Country"].Index])
 				}
-				if peopleField.Name == "AlternateAddress" {
-					dataMap[i] = strings.TrimSpace(guestData[guestHeaderMap["Address2"].Index])
+				if value, ok := secondContact[peopleField.Name]; ok {
+					dataMap[i] = value
+				}
+				if peopleField.Name == "Points" {
+					dataMap[i] = getGuestCell(guestData, guestHeaderMap, "RoomNights")
+				}
+				if peopleField.Name == "EligibleFutureUser" {
+					if eligible := getGuestEligibility(guestData, guestHeaderMap); eligible != "" {
+						dataMap[i] = eligible
+					}
+				}
+				if peopleField.Name == "OtherPreferences" {
+					dataMap[i] = getGuestPreferences(guestData, guestHeaderMap)
 				}
 			}
 		}
@@ -186,16 +228,13 @@ func GetPeopleCSVRow(
 		// these conditions have been put here because it's mapping field does not exist
 		// =========================================================
 		if peopleField.Name == "FirstName" {
-			nameSlice := strings.Split(roomkeyRow[csvHeaderMap["Guest"].Index], ",")
-			dataMap[i] = strings.TrimSpace(nameSlice[0])
+			dataMap[i] = personName.First
+		}
+		if peopleField.Name == "MiddleName" {
+			dataMap[i] = personName.Middle
 		}
 		if peopleField.Name == "LastName" {
-			nameSlice := strings.Split(roomkeyRow[csvHeaderMap["Guest"].Index], ",")
-			if len(nameSlice) > 1 {
-				dataMap[i] = strings.TrimSpace(nameSlice[1])
-			} else {
-				dataMap[i] = ""
-			}
+			dataMap[i] = personName.LastNameWithSuffix()
 		}
 
 		// Special notes for people to get TCID in future with below value
@@ -207,6 +246,9 @@ func GetPeopleCSVRow(
 			if roomkeyRow[csvHeaderMap["Description"].Index] != "" {
 				des += descriptionFieldSep + strings.TrimSpace(roomkeyRow[csvHeaderMap["Description"].Index])
 			}
+			if note := getGuestVIPNote(guestData, guestHeaderMap); note != "" {
+				des += descriptionFieldSep + note
+			}
 			dataMap[i] = des
 			tracePeopleNote[rowIndex] = des
 		}
@@ -222,6 +264,10 @@ func GetPeopleCSVRow(
 		}
 	}
 
+	// fields which have transforms in mapper take their values from them,
+	// transforms of FirstName, MiddleName and LastName replace parsed name
+	transforms.Apply(reflectedPeopleFieldMap.Type(), dataMap, roomkeyRow, csvHeaderMap)
+
 	dataArray := []string{}
 
 	for i := 0; i < pplLength; i++ {
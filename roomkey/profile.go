@@ -0,0 +1,65 @@
+package roomkey
+
+import (
+	"encoding/json"
+	"fmt"
+	"importers/core"
+	"io/ioutil"
+	"regexp"
+)
+
+// Profile holds the site specific rules of roomkey importer
+// which are kept out of the go code, loaded from profile.json
+type Profile struct {
+	DescriptionRules  []DescriptionRule
+	Layout            LayoutRules
+	ReportTypes       []ReportType
+	DefaultReportType string
+	GuestMatch        GuestMatchRules
+	GuestAttributes   []GuestAttributeRule
+	RATemplateRules   []core.RATemplateRule
+
+	// second contact block of guest export is an emergency contact
+	SecondContactIsEmergency bool
+}
+
+// loadProfile reads profile json file and compiles the rules
+// defined in it so they are ready to use while parsing rows
+func loadProfile(profileFilePath string) (Profile, error) {
+	var profile Profile
+
+	data, err := ioutil.ReadFile(profileFilePath)
+	if err != nil {
+		return profile, err
+	}
+
+	err = json.Unmarshal(data, &profile)
+	if err != nil {
+		return profile, err
+	}
+
+	for i := range profile.DescriptionRules {
+		profile.DescriptionRules[i].re, err = regexp.Compile(profile.DescriptionRules[i].Pattern)
+		if err != nil {
+			return profile, err
+		}
+	}
+
+	for _, reportType := range profile.ReportTypes {
+		if !isValidReportAction(reportType.Action) {
+			return profile, fmt.Errorf("unknown action %q of report type %q", reportType.Action, reportType.Name)
+		}
+	}
+
+	err = profile.Layout.compile()
+	if err != nil {
+		return profile, err
+	}
+
+	err = core.CompileRATemplateRules(profile.RATemplateRules)
+	if err != nil {
+		return profile, err
+	}
+
+	return profile, nil
+}
@@ -0,0 +1,63 @@
+package roomkey
+
+import (
+	"context"
+	"errors"
+	"importers/core"
+	"rentroll/rlib"
+	"sort"
+	"strings"
+	"time"
+)
+
+// readRoomKeyReconciliation sums rate of stays in roomkey csv by room,
+// agreements of rentroll are compared on the days guests check in
+func readRoomKeyReconciliation(roomKeyCSV string, reportDate time.Time) (*core.Reconciliation, error) {
+	r := core.NewReconciliation(reportDate)
+
+	csvRowDataMap, csvHeaderMap, reportType, bannerDate, err := readRoomKeyCSV(roomKeyCSV)
+	if err != nil {
+		return r, err
+	}
+
+	// cancelled reservations have no agreements in business
+	if reportType.Action == reportActionCancellation {
+		return r, errors.New("Report " + reportType.Name + " has cancelled reservations only, there is nothing to reconcile")
+	}
+
+	// always sort keys to iterate over csv rows from top to bottom
+	var csvRowDataMapKeys []int
+	for k := range csvRowDataMap {
+		csvRowDataMapKeys = append(csvRowDataMapKeys, k)
+	}
+	sort.Ints(csvRowDataMapKeys)
+
+	for _, rowIndex := range csvRowDataMapKeys {
+		csvRow := csvRowDataMap[rowIndex]
+
+		room := strings.TrimSpace(csvRow[csvHeaderMap["Room"].Index])
+		if room == "" {
+			continue
+		}
+
+		// invalid rates and dates are reported by import
+		rate, _ := core.ParseAmount(csvRow[csvHeaderMap["Rate"].Index])
+		rowDates := getRoomKeyRowDates(rowIndex, csvRow, csvHeaderMap, bannerDate, map[int][]string{})
+
+		u := r.GetUnit(room)
+		u.SetDate(formatRoomKeyDate(rowDates.DateIn))
+		u.Source.ContractRent += rate
+	}
+
+	return r, nil
+}
+
+// getReconcileReport returns report comparing rates of csv
+// with rent business holds after import
+func getReconcileReport(ctx context.Context, business *rlib.Business, csvPath string, reportDate time.Time) string {
+	r, err := readRoomKeyReconciliation(csvPath, reportDate)
+	if err != nil {
+		return "Unable to reconcile amounts: " + err.Error() + "\n"
+	}
+	return core.GetReconcileReport(ctx, business, csvPath, r)
+}
@@ -63,6 +63,7 @@ func ReadRentableCSVData(
 	currentTime time.Time,
 	suppliedValues map[string]string,
 	rentableStruct *core.RentableCSV,
+	transforms core.FieldTransforms,
 	traceTCIDMap map[int]string,
 	csvErrors map[int][]string,
 	rentableCSVData *[][]string,
@@ -103,7 +104,7 @@ func ReadRentableCSVData(
 	csvRowData := GetRentableCSVRow(
 		csvRow, rentableStruct,
 		rentableDefaultData,
-		csvHeaderMap,
+		transforms, csvHeaderMap,
 	)
 
 	*rentableCSVData = append(*rentableCSVData, csvRowData)
@@ -120,6 +121,7 @@ func GetRentableCSVRow(
 	roomkeyRow []string,
 	fieldMap *core.RentableCSV,
 	DefaultValues map[string]string,
+	transforms core.FieldTransforms,
 	csvHeaderMap map[string]core.CSVHeader,
 ) []string {
 
@@ -174,6 +176,9 @@ func GetRentableCSVRow(
 		}
 	}
 
+	// fields which have transforms in mapper take their values from them
+	transforms.Apply(reflectedRentableFieldMap.Type(), dataMap, roomkeyRow, csvHeaderMap)
+
 	dataArray := []string{}
 
 	for i := 0; i < rRTLength; i++ {
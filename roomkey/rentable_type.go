@@ -64,6 +64,7 @@ func ReadRentableTypeCSVData(
 	currentTime time.Time,
 	suppliedValues map[string]string,
 	rentableTypeStruct *core.RentableTypeCSV,
+	transforms core.FieldTransforms,
 	business *rlib.Business,
 	rentableTypeCSVData *[][]string,
 	csvHeaderMap map[string]core.CSVHeader,
@@ -95,7 +96,7 @@ func ReadRentableTypeCSVData(
 	csvRowData := GetRentableTypeCSVRow(
 		csvRow, rentableTypeStruct,
 		rentableTypeDefaultData,
-		csvHeaderMap,
+		transforms, csvHeaderMap,
 	)
 
 	*rentableTypeCSVData = append(*rentableTypeCSVData, csvRowData)
@@ -113,6 +114,7 @@ func GetRentableTypeCSVRow(
 	roomkeyRow []string,
 	fieldMap *core.RentableTypeCSV,
 	DefaultValues map[string]string,
+	transforms core.FieldTransforms,
 	csvHeaderMap map[string]core.CSVHeader,
 ) []string {
 
@@ -149,6 +151,9 @@ func GetRentableTypeCSVRow(
 		}
 	}
 
+	// fields which have transforms in mapper take their values from them
+	transforms.Apply(reflectedRentableTypeFieldMap.Type(), dataMap, roomkeyRow, csvHeaderMap)
+
 	dataArray := []string{}
 
 	for i := 0; i < rRTLength; i++ {
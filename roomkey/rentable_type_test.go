@@ -0,0 +1,39 @@
+package roomkey
+
+import (
+	"importers/core"
+	"reflect"
+	"testing"
+)
+
+func TestGetRentableTypeCSVRowDtStart(t *testing.T) {
+	var fieldMap core.CSVFieldMap
+	if err := core.GetFieldMapping(&fieldMap, sampleMapperJSON); err != nil {
+		t.Fatal(err)
+	}
+	headerList, err := core.GetCSVHeaders(sampleHeaderJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csvHeaderMap := getCanonicalHeaderMap(headerList)
+
+	defaults := map[string]string{"DtStart": "5/1/2018", "DtStop": "12/31/9999"}
+	tests := []struct {
+		name   string
+		dateIn string
+		want   string
+	}{
+		// date in of line 7 of roomkey.csv sample
+		{"date in", "15-May-2018", "2018-05-15"},
+		{"no date in", "", "5/1/2018"},
+	}
+
+	field, _ := reflect.TypeOf(fieldMap.RentableTypeCSV).FieldByName("DtStart")
+	for _, tt := range tests {
+		row := getRoomKeyRow(csvHeaderMap, map[string]string{"RoomType": "2 BDR 1 Bath NSNP-", "DateIn": tt.dateIn})
+		data := GetRentableTypeCSVRow(row, &fieldMap.RentableTypeCSV, defaults, fieldMap.Transforms["RentableTypeCSV"], csvHeaderMap)
+		if got := data[field.Index[0]]; got != tt.want {
+			t.Errorf("%s: DtStart = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
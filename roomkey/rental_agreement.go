@@ -8,7 +8,6 @@ import (
 	"path"
 	"reflect"
 	"rentroll/rlib"
-	"strconv"
 	"strings"
 	"time"
 )
@@ -64,12 +63,24 @@ func ReadRentalAgreementCSVData(
 	currentTime time.Time,
 	suppliedValues map[string]string,
 	rentalAgreementStruct *core.RentalAgreementCSV,
+	transforms core.FieldTransforms,
 	traceTCIDMap map[int]string,
+	rowDates roomKeyRowDates,
+	descriptionRAFields map[string]string,
+	reportType ReportType,
 	csvErrors map[int][]string,
 	rentalAgreementCSVData *[][]string,
 	csvHeaderMap map[string]core.CSVHeader,
+	raTemplateRules []core.RATemplateRule,
+	raTemplates map[int]core.RATemplateChoice,
 ) {
 
+	// dates of this row could not be recovered, which has been
+	// reported already, so don't import the agreement with wrong dates
+	if !rowDates.Valid {
+		return
+	}
+
 	currentYear, currentMonth, currentDate := currentTime.Date()
 	DtStart := fmt.Sprintf("%d/%d/%d", currentMonth, currentDate, currentYear)
 	DtStop := "12/31/9999" // no end date
@@ -99,11 +110,26 @@ func ReadRentalAgreementCSVData(
 	rentableDefaultData["DtStop"] = DtStop
 	rentableDefaultData["TCID"] = traceTCIDMap[rowIndex]
 
+	// values found in description by the rules of profile
+	for k, v := range descriptionRAFields {
+		rentableDefaultData[k] = v
+	}
+
+	// template of agreement is chosen by the rules of profile
+	template, rule := core.ChooseRATemplate(raTemplateRules, getRATemplateAgreement(csvRow, rowDates, reportType, csvHeaderMap))
+	rentableDefaultData["RATemplateName"] = template
+	raTemplates[rowIndex] = core.RATemplateChoice{
+		Unit:     strings.TrimSpace(csvRow[csvHeaderMap["Room"].Index]),
+		Payor:    strings.TrimSpace(csvRow[csvHeaderMap["Guest"].Index]),
+		Template: template,
+		Rule:     rule,
+	}
+
 	// get csv row data
 	csvRowData := GetRentalAgreementCSVRow(
 		csvRow, rentalAgreementStruct,
-		rentableDefaultData, currentTime,
-		csvHeaderMap,
+		rentableDefaultData, rowDates,
+		transforms, csvHeaderMap,
 	)
 
 	*rentalAgreementCSVData = append(*rentalAgreementCSVData, csvRowData)
@@ -113,13 +139,32 @@ func ReadRentalAgreementCSVData(
 	traceCSVData[*recordCount+1] = rowIndex
 }
 
+// getRATemplateAgreement returns what template rules match on of row,
+// stay is paid by company if row has group or corporate account of it
+func getRATemplateAgreement(
+	csvRow []string,
+	rowDates roomKeyRowDates,
+	reportType ReportType,
+	csvHeaderMap map[string]core.CSVHeader,
+) core.RATemplateAgreement {
+	return core.RATemplateAgreement{
+		Unit:         strings.TrimSpace(csvRow[csvHeaderMap["Room"].Index]),
+		FloorPlan:    strings.TrimSpace(csvRow[csvHeaderMap["RoomType"].Index]),
+		RateName:     strings.TrimSpace(csvRow[csvHeaderMap["RateName"].Index]),
+		Status:       reportType.Name,
+		TermDays:     core.GetTermDays(rowDates.DateIn, rowDates.DateOut),
+		CompanyPayor: strings.TrimSpace(csvRow[csvHeaderMap["GroupCorporate"].Index]) != "",
+	}
+}
+
 // GetRentalAgreementCSVRow used to create RentalAgreement
 // csv row from roomkey csv
 func GetRentalAgreementCSVRow(
 	roomkeyRow []string,
 	fieldMap *core.RentalAgreementCSV,
 	DefaultValues map[string]string,
-	currentTime time.Time,
+	rowDates roomKeyRowDates,
+	transforms core.FieldTransforms,
 	csvHeaderMap map[string]core.CSVHeader,
 ) []string {
 
@@ -134,10 +179,19 @@ func GetRentalAgreementCSVRow(
 	// return data array
 	dataMap := make(map[int]string)
 
+	// dates of agreement come from parsed dates of row whatever the mapper
+	// holds, years which roomkey drops are only known there
+	agreementDates := getRentalAgreementDates(rowDates, DefaultValues)
+
 	for i := 0; i < rRTLength; i++ {
 		// get rentalAgreement field
 		rentalAgreementField := reflectedRentalAgreementFieldMap.Type().Field(i)
 
+		if date, ok := agreementDates[rentalAgreementField.Name]; ok {
+			dataMap[i] = date
+			continue
+		}
+
 		// if rentalAgreementField value exist in DefaultValues map
 		// then set it first
 		suppliedValue, found := DefaultValues[rentalAgreementField.Name]
@@ -149,10 +203,10 @@ func GetRentalAgreementCSVRow(
 		// this condition has been put here because it's mapping field does not exist
 		// =========================================================
 		if rentalAgreementField.Name == "PayorSpec" {
-			dataMap[i] = getPayorSpec(roomkeyRow, DefaultValues, csvHeaderMap)
+			dataMap[i] = getPayorSpec(rowDates, DefaultValues)
 		}
 		if rentalAgreementField.Name == "UserSpec" {
-			dataMap[i] = getUserSpec(roomkeyRow, DefaultValues, csvHeaderMap)
+			dataMap[i] = getUserSpec(rowDates, DefaultValues)
 		}
 		if rentalAgreementField.Name == "RentableSpec" {
 			dataMap[i] = getRentableSpec(roomkeyRow, csvHeaderMap)
@@ -164,32 +218,13 @@ func GetRentalAgreementCSVRow(
 		// if has not value then continue
 		if header, ok := csvHeaderMap[MappedFieldName]; ok {
 			dataMap[i] = strings.TrimSpace(roomkeyRow[header.Index])
-		} else {
-			continue
 		}
-
-		// Formatting dates to RentRoll importable format
-		if rentalAgreementField.Name == "AgreementStart" {
-
-			if len(strings.TrimSpace(roomkeyRow[csvHeaderMap["DateRes"].Index])) < 11 {
-				currentYear, _, _ := currentTime.Date()
-				dataMap[i] = getFormattedDate(strings.TrimSpace(roomkeyRow[csvHeaderMap["DateRes"].Index]) + strconv.Itoa(currentYear))
-			} else {
-				dataMap[i] = getFormattedDate(strings.TrimSpace(roomkeyRow[csvHeaderMap["DateRes"].Index]))
-			}
-		}
-		if rentalAgreementField.Name == "PossessionStart" ||
-			rentalAgreementField.Name == "RentStart" {
-			dataMap[i] = getFormattedDate(strings.TrimSpace(roomkeyRow[csvHeaderMap["DateIn"].Index]))
-		}
-		if rentalAgreementField.Name == "AgreementStop" ||
-			rentalAgreementField.Name == "PossessionStop" ||
-			rentalAgreementField.Name == "RentStop" {
-			dataMap[i] = getFormattedDate(strings.TrimSpace(roomkeyRow[csvHeaderMap["DateOut"].Index]))
-		}
-
 	}
 
+	// fields which have transforms in mapper take their values from them,
+	// transforms of PayorSpec, UserSpec and RentableSpec replace the specs made above
+	transforms.Apply(reflectedRentalAgreementFieldMap.Type(), dataMap, roomkeyRow, csvHeaderMap)
+
 	dataArray := []string{}
 
 	for i := 0; i < rRTLength; i++ {
@@ -199,11 +234,42 @@ func GetRentalAgreementCSVRow(
 	return dataArray
 }
 
+// getRentalAgreementDates returns dates of agreement by field name,
+// possession and rent start on date in so agreements of arrivals start
+// in future and updates find stays by it. Default dates are taken
+// for the dates which row doesn't have.
+func getRentalAgreementDates(
+	rowDates roomKeyRowDates,
+	defaults map[string]string,
+) map[string]string {
+
+	start := formatRoomKeyDate(rowDates.DateIn)
+	if start == "" {
+		start = defaults["DtStart"]
+	}
+	stop := formatRoomKeyDate(rowDates.DateOut)
+	if stop == "" {
+		stop = defaults["DtStop"]
+	}
+	agreementStart := formatRoomKeyDate(rowDates.DateRes)
+	if agreementStart == "" {
+		agreementStart = start
+	}
+
+	return map[string]string{
+		"AgreementStart":  agreementStart,
+		"AgreementStop":   stop,
+		"PossessionStart": start,
+		"PossessionStop":  stop,
+		"RentStart":       start,
+		"RentStop":        stop,
+	}
+}
+
 // getPayorSpec used to get payor spec in format of rentroll system
 func getPayorSpec(
-	csvRow []string,
+	rowDates roomKeyRowDates,
 	defaults map[string]string,
-	csvHeaderMap map[string]core.CSVHeader,
 ) string {
 
 	orderedFields := []string{}
@@ -213,17 +279,17 @@ func getPayorSpec(
 
 	if defaults["TCID"] != "" {
 		// append rent start
-		if csvRow[csvHeaderMap["DateIn"].Index] == "" {
+		if rowDates.DateIn.IsZero() {
 			orderedFields = append(orderedFields, defaults["DtStart"])
 		} else {
-			orderedFields = append(orderedFields, getFormattedDate(csvRow[csvHeaderMap["DateIn"].Index]))
+			orderedFields = append(orderedFields, formatRoomKeyDate(rowDates.DateIn))
 		}
 
 		// append date out
-		if csvRow[csvHeaderMap["DateOut"].Index] == "" {
+		if rowDates.DateOut.IsZero() {
 			orderedFields = append(orderedFields, defaults["DtStop"])
 		} else {
-			orderedFields = append(orderedFields, getFormattedDate(csvRow[csvHeaderMap["DateOut"].Index]))
+			orderedFields = append(orderedFields, formatRoomKeyDate(rowDates.DateOut))
 		}
 	}
 
@@ -232,9 +298,8 @@ func getPayorSpec(
 
 // getUserSpec used to get user spec in format of rentroll system
 func getUserSpec(
-	csvRow []string,
+	rowDates roomKeyRowDates,
 	defaults map[string]string,
-	csvHeaderMap map[string]core.CSVHeader,
 ) string {
 
 	orderedFields := []string{}
@@ -243,17 +308,17 @@ func getUserSpec(
 
 	if defaults["TCID"] != "" {
 		// append rent start
-		if csvRow[csvHeaderMap["DateIn"].Index] == "" {
+		if rowDates.DateIn.IsZero() {
 			orderedFields = append(orderedFields, defaults["DtStart"])
 		} else {
-			orderedFields = append(orderedFields, getFormattedDate(csvRow[csvHeaderMap["DateIn"].Index]))
+			orderedFields = append(orderedFields, formatRoomKeyDate(rowDates.DateIn))
 		}
 
 		// append date out
-		if csvRow[csvHeaderMap["DateOut"].Index] == "" {
+		if rowDates.DateOut.IsZero() {
 			orderedFields = append(orderedFields, defaults["DtStop"])
 		} else {
-			orderedFields = append(orderedFields, getFormattedDate(csvRow[csvHeaderMap["DateOut"].Index]))
+			orderedFields = append(orderedFields, formatRoomKeyDate(rowDates.DateOut))
 		}
 	}
 
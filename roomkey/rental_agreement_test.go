@@ -0,0 +1,75 @@
+package roomkey
+
+import (
+	"importers/core"
+	"reflect"
+	"rentroll/rlib"
+	"testing"
+	"time"
+)
+
+// mapper of roomkey importer
+const sampleMapperJSON = "../admin/roomkey/mapper.json"
+
+func TestGetRentalAgreementCSVRowDates(t *testing.T) {
+	var fieldMap core.CSVFieldMap
+	if err := core.GetFieldMapping(&fieldMap, sampleMapperJSON); err != nil {
+		t.Fatal(err)
+	}
+	profile, err := loadProfile(sampleProfileJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	headerList, err := core.GetCSVHeaders(sampleHeaderJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csvHeaderMap := getCanonicalHeaderMap(headerList)
+	rows := readRoomKeyCSVRows(rlib.LoadCSV(sampleRoomKeyCSV), headerList, csvHeaderMap, profile, map[int][]string{})
+
+	defaults := map[string]string{"DtStart": "5/1/2018", "DtStop": "12/31/9999"}
+	tests := []struct {
+		name   string
+		row    []string
+		dates  roomKeyRowDates
+		values map[string]string
+	}{
+		{
+			// line 7 of sample, reserved on "09-May-"
+			name:  "in house",
+			row:   rows[7],
+			dates: roomKeyRowDates{DateRes: date(2018, time.May, 9), DateIn: date(2018, time.May, 15), DateOut: date(2018, time.June, 6), Valid: true},
+			values: map[string]string{
+				"AgreementStart": "2018-05-09", "PossessionStart": "2018-05-15", "RentStart": "2018-05-15",
+				"AgreementStop": "2018-06-06", "PossessionStop": "2018-06-06", "RentStop": "2018-06-06",
+			},
+		},
+		{
+			name:  "arrival without reservation date",
+			row:   rows[8],
+			dates: roomKeyRowDates{DateIn: date(2018, time.June, 1), DateOut: date(2018, time.August, 30), Valid: true},
+			values: map[string]string{
+				"AgreementStart": "2018-06-01", "PossessionStart": "2018-06-01", "RentStart": "2018-06-01",
+			},
+		},
+		{
+			name:  "no date out",
+			row:   rows[8],
+			dates: roomKeyRowDates{DateRes: date(2018, time.April, 25), DateIn: date(2018, time.May, 1), Valid: true},
+			values: map[string]string{
+				"PossessionStart": "2018-05-01", "AgreementStop": "12/31/9999", "RentStop": "12/31/9999",
+			},
+		},
+	}
+
+	fields := reflect.TypeOf(fieldMap.RentalAgreementCSV)
+	for _, tt := range tests {
+		row := GetRentalAgreementCSVRow(tt.row, &fieldMap.RentalAgreementCSV, defaults, tt.dates, fieldMap.Transforms["RentalAgreementCSV"], csvHeaderMap)
+		for name, want := range tt.values {
+			field, _ := fields.FieldByName(name)
+			if got := row[field.Index[0]]; got != want {
+				t.Errorf("%s: %s = %q, want %q", tt.name, name, got, want)
+			}
+		}
+	}
+}
@@ -5,12 +5,15 @@ import (
 	"fmt"
 	"gotable"
 	"importers/core"
+	"path"
 	"rentroll/rlib"
 	"rentroll/rrpt"
 	"sort"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/kardianos/osext"
 )
 
 // getSummaryReportSection1 used to get summary for table's section1
@@ -90,7 +93,9 @@ func generateSummaryReport(
 	if err != nil {
 		rlib.Ulog("generateDetailedReport: error = %s", err)
 	}
-	return s
+
+	// kpis of csv tell at a glance whether import looks right
+	return s + "\n" + getKPIReport(csvFile, currentTime)
 }
 
 // generateDetailedReport gives detailed report with (rowNumber, db type, reason)
@@ -222,6 +227,7 @@ func generateRCSVReport(
 	ctx context.Context,
 	business *rlib.Business,
 	summaryCount map[int]map[string]int,
+	raTemplates map[int]core.RATemplateChoice,
 	csvFile string,
 ) string {
 
@@ -230,6 +236,8 @@ func generateRCSVReport(
 		{ReportNo: 6, OutputFormat: gotable.TABLEOUTTEXT, Handler: rrpt.RRreportRentables, Bid: business.BID},
 		{ReportNo: 7, OutputFormat: gotable.TABLEOUTTEXT, Handler: rrpt.RRreportPeople, Bid: business.BID},
 		{ReportNo: 9, OutputFormat: gotable.TABLEOUTTEXT, Handler: rrpt.RRreportRentalAgreements, Bid: business.BID},
+		{ReportNo: 14, OutputFormat: gotable.TABLEOUTTEXT, Handler: rrpt.RRreportCustomAttributes, Bid: business.BID},
+		{ReportNo: 15, OutputFormat: gotable.TABLEOUTTEXT, Handler: rrpt.RRreportCustomAttributeRefs, Bid: business.BID},
 	}
 
 	var rcsvReport string
@@ -246,6 +254,9 @@ func generateRCSVReport(
 		rcsvReport += "\n"
 	}
 
+	// template chosen by rules of profile for each agreement
+	rcsvReport += core.GetRATemplateReport(raTemplates)
+
 	return rcsvReport
 }
 
@@ -254,6 +265,7 @@ func successReport(
 	ctx context.Context,
 	business *rlib.Business,
 	summaryCount map[int]map[string]int,
+	raTemplates map[int]core.RATemplateChoice,
 	csvFile string,
 	guestCsv string,
 	debugMode int,
@@ -268,7 +280,7 @@ func successReport(
 
 	// csv report for all types if testmode is on
 	if debugMode == 1 {
-		report += generateRCSVReport(ctx, business, summaryCount, csvFile)
+		report += generateRCSVReport(ctx, business, summaryCount, raTemplates, csvFile)
 	}
 
 	// return
@@ -281,6 +293,8 @@ func errorReporting(
 	business *rlib.Business,
 	csvErrors map[int][]string,
 	summaryCount map[int]map[string]int,
+	raTemplates map[int]core.RATemplateChoice,
+	duplicates map[int]core.PersonDuplicate,
 	csvFile string,
 	guestCsv string,
 	debugMode int,
@@ -294,6 +308,12 @@ func errorReporting(
 	detailedReport, csvReportGenerate := generateDetailedReport(csvErrors, summaryCount)
 	detailedReport += "\n"
 
+	// guests which may be duplicates, with their scores
+	if len(duplicates) > 0 {
+		detailedReport += core.GetPersonDuplicateReport(duplicates)
+		detailedReport += "\n"
+	}
+
 	// append summary report
 	errReport += generateSummaryReport(ctx, summaryCount, business.BID, currentTime, csvFile, guestCsv)
 	errReport += "\n"
@@ -304,9 +324,82 @@ func errorReporting(
 	// if true then generate csv report
 	// specia case: when there are only warnings but no errors
 	if csvReportGenerate && debugMode == 1 {
-		errReport += generateRCSVReport(ctx, business, summaryCount, csvFile)
+		errReport += generateRCSVReport(ctx, business, summaryCount, raTemplates, csvFile)
 	}
 
 	// return
 	return errReport, csvReportGenerate
 }
+
+// getRoomKeyLines returns room of data lines and header lines of roomkey
+// csv, rooms of lines are not known to loader once rows are written
+func getRoomKeyLines(roomKeyCSV string) (map[int]string, []int) {
+	lineUnits := map[int]string{}
+	headerLines := []int{}
+
+	folderPath, err := osext.ExecutableFolder()
+	if err != nil {
+		return lineUnits, headerLines
+	}
+	csvHeaderList, err := core.GetCSVHeaders(path.Join(folderPath, "roomkeyHeader.json"))
+	if err != nil {
+		return lineUnits, headerLines
+	}
+
+	// every page of report has header line of its own
+	t := rlib.LoadCSV(roomKeyCSV)
+	for rowIndex := 1; rowIndex <= len(t); rowIndex++ {
+		if ok, _ := isRoomKeyHeaderLine(t[rowIndex-1], csvHeaderList); ok {
+			headerLines = append(headerLines, rowIndex)
+		}
+	}
+
+	csvRowDataMap, csvHeaderMap, _, _, err := readRoomKeyCSV(roomKeyCSV)
+	if err != nil {
+		return lineUnits, headerLines
+	}
+	for rowIndex, csvRow := range csvRowDataMap {
+		lineUnits[rowIndex] = strings.TrimSpace(csvRow[csvHeaderMap["Room"].Index])
+	}
+	return lineUnits, headerLines
+}
+
+// writeHTMLReport writes html report of import if path of it is given,
+// it returns the line which tells where report is for text report
+func writeHTMLReport(htmlReport string, importRecord *core.ImportRecord, headerLines []int, sections ...string) string {
+	if htmlReport == "" {
+		return ""
+	}
+
+	if err := core.WriteHTMLReport(htmlReport, importRecord, headerLines, sections...); err != nil {
+		rlib.Ulog("Error <HTML REPORT>: %s\n", err.Error())
+		return "\nUnable to write HTML report " + htmlReport + ": " + err.Error() + "\n"
+	}
+	return "\nHTML report: " + htmlReport + "\n"
+}
+
+// writeAnnotatedCSV writes copy of csv with status and issues of rows if
+// path of it is given, it returns the line which tells where it is
+func writeAnnotatedCSV(
+	annotatedCSV string,
+	csvFile string,
+	headerLines []int,
+	lineUnits map[int]string,
+	csvErrors map[int][]string,
+	rowNotes map[int][]core.RowNote,
+) string {
+	if annotatedCSV == "" {
+		return ""
+	}
+
+	dataLines := []int{}
+	for line := range lineUnits {
+		dataLines = append(dataLines, line)
+	}
+
+	if err := core.WriteAnnotatedCSV(annotatedCSV, csvFile, headerLines, dataLines, csvErrors, rowNotes); err != nil {
+		rlib.Ulog("Error <ANNOTATED CSV>: %s\n", err.Error())
+		return "\nUnable to write annotated CSV " + annotatedCSV + ": " + err.Error() + "\n"
+	}
+	return "\nAnnotated CSV: " + annotatedCSV + "\n"
+}
@@ -0,0 +1,98 @@
+package roomkey
+
+import (
+	"fmt"
+	"importers/core"
+	"strings"
+)
+
+// actions which can be taken on rental agreements for a report type,
+// in-house report loads the business again, arrivals are added to it
+// and the others update agreements of stays which have been imported before
+const (
+	reportActionInHouse      = "InHouse"
+	reportActionArrival      = "Arrival"
+	reportActionDeparture    = "Departure"
+	reportActionCancellation = "Cancellation"
+	reportActionGuestHistory = "GuestHistory"
+)
+
+// ReportType holds the banner text of a roomkey report
+// and the action to take on its rental agreements, loaded from profile
+type ReportType struct {
+	Name   string // banner text printed on top of the report
+	Action string // one of the report actions
+}
+
+// isValidReportAction checks the action of report type is known
+func isValidReportAction(action string) bool {
+	return core.StringInSlice(action, []string{
+		reportActionInHouse,
+		reportActionArrival,
+		reportActionDeparture,
+		reportActionCancellation,
+		reportActionGuestHistory,
+	})
+}
+
+// isUpdateReportAction checks the action updates agreements of business
+// instead of loading new ones, guests of such reports are not in the rooms
+func isUpdateReportAction(action string) bool {
+	return core.StringInSlice(action, []string{
+		reportActionDeparture,
+		reportActionCancellation,
+		reportActionGuestHistory,
+	})
+}
+
+// isAddReportAction checks the action adds agreements to business,
+// stays which have been imported before are kept as they are
+func isAddReportAction(action string) bool {
+	return action == reportActionArrival
+}
+
+// detectRoomKeyReportType looks for the banner of the report in the rows
+// above the first header line and returns the matched report type.
+// If no banner matches then default report type of profile is returned
+// with a warning.
+func detectRoomKeyReportType(
+	t [][]string,
+	headerList []core.CSVHeader,
+	profile Profile,
+	csvErrors map[int][]string,
+) ReportType {
+
+	for rowIndex := 1; rowIndex <= len(t); rowIndex++ {
+		// banner rows are only above the headers
+		if ok, _ := isRoomKeyHeaderLine(t[rowIndex-1], headerList); ok {
+			break
+		}
+
+		for _, cell := range t[rowIndex-1] {
+			cellText := strings.ToLower(core.SpecialCharsReplacer.Replace(cell))
+			if cellText == "" {
+				continue
+			}
+			for _, reportType := range profile.ReportTypes {
+				if cellText == strings.ToLower(core.SpecialCharsReplacer.Replace(reportType.Name)) {
+					return reportType
+				}
+			}
+		}
+	}
+
+	reportType := ReportType{Name: profile.DefaultReportType, Action: reportActionInHouse}
+	for _, rt := range profile.ReportTypes {
+		if rt.Name == profile.DefaultReportType {
+			reportType = rt
+			break
+		}
+	}
+
+	warnPrefix := "W:<" + core.DBTypeMapStrings[core.DBRentalAgreement] + ">:"
+	csvErrors[1] = append(csvErrors[1],
+		warnPrefix+fmt.Sprintf("Unable to detect type of report, importing it as %q report", reportType.Name),
+	)
+
+	return reportType
+}
@@ -0,0 +1,155 @@
+package roomkey
+
+import (
+	"context"
+	"fmt"
+	"gotable"
+	"importers/core"
+	"rentroll/rlib"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// roomKeyAgreementUpdate holds what a row changes in agreement of stay
+type roomKeyAgreementUpdate struct {
+	Line   int
+	Room   string
+	Guest  string
+	RAID   int64
+	Change string
+}
+
+// roomKeyUpdate holds changes which a report of departures, cancellations or
+// guest history makes in agreements of stays which have been imported before
+type roomKeyUpdate struct {
+	ReportType ReportType
+
+	// Updates holds changed agreements for report
+	Updates []roomKeyAgreementUpdate
+
+	// RecordChanges holds dated changes made in existing records
+	RecordChanges []core.RecordChange
+}
+
+// updateRoomKeyAgreements finds the agreement of stay of each row by room and
+// check in, and stops or cancels it. Rows of which agreement is not found are
+// reported, business is not deleted or loaded again.
+func updateRoomKeyAgreements(
+	ctx context.Context,
+	BID int64,
+	csvRowDataMap map[int][]string,
+	csvHeaderMap map[string]core.CSVHeader,
+	reportType ReportType,
+	reportDate time.Time,
+	csvErrors map[int][]string,
+	rowNotes map[int][]core.RowNote,
+) (*roomKeyUpdate, int, error) {
+
+	update := &roomKeyUpdate{ReportType: reportType}
+	possible := 0
+	warnPrefix := "W:<" + core.DBTypeMapStrings[core.DBRentalAgreement] + ">:"
+
+	updater, err := core.NewRecordUpdater(ctx, BID)
+	if err != nil {
+		return update, possible, err
+	}
+
+	// always sort keys to iterate over csv rows from top to bottom
+	var csvRowDataMapKeys []int
+	for k := range csvRowDataMap {
+		csvRowDataMapKeys = append(csvRowDataMapKeys, k)
+	}
+	sort.Ints(csvRowDataMapKeys)
+
+	for _, rowIndex := range csvRowDataMapKeys {
+		csvRow := csvRowDataMap[rowIndex]
+
+		// dates which could not be recovered are reported already
+		rowDates := getRoomKeyRowDates(rowIndex, csvRow, csvHeaderMap, reportDate, csvErrors)
+		if !rowDates.Valid {
+			continue
+		}
+		possible++
+
+		room := strings.TrimSpace(csvRow[csvHeaderMap["Room"].Index])
+		guest := strings.TrimSpace(csvRow[csvHeaderMap["Guest"].Index])
+		stay := fmt.Sprintf("room %s checked in on %s", room, formatRoomKeyDate(rowDates.DateIn))
+
+		RAIDs, err := updater.FindRentalAgreements(room, rowDates.DateIn)
+		if err != nil {
+			updater.Rollback()
+			return update, possible, err
+		}
+
+		switch {
+		case len(RAIDs) == 0 && reportType.Action == reportActionGuestHistory:
+			// past stays which were never imported have nothing to update
+			rowNotes[rowIndex] = append(rowNotes[rowIndex], core.RowNote{Status: core.RowStatusSkipped,
+				Reason: "no rental agreement of " + stay + " in business"})
+			continue
+		case len(RAIDs) == 0:
+			csvErrors[rowIndex] = append(csvErrors[rowIndex],
+				warnPrefix+"No rental agreement of "+stay+" is found, it is not updated")
+			continue
+		case len(RAIDs) > 1:
+			csvErrors[rowIndex] = append(csvErrors[rowIndex],
+				warnPrefix+fmt.Sprintf("%d rental agreements of %s are found, none of them is updated", len(RAIDs), stay))
+			continue
+		}
+
+		RAID := RAIDs[0]
+		var change string
+		if reportType.Action == reportActionCancellation {
+			err = updater.CancelRentalAgreement(RAID, rowDates.DateIn)
+			change = "Cancelled"
+		} else {
+			err = updater.SetRentalAgreementStop(RAID, rowDates.DateOut)
+			change = "Stopped on " + formatRoomKeyDate(rowDates.DateOut)
+		}
+		if err != nil {
+			updater.Rollback()
+			return update, possible, err
+		}
+
+		update.Updates = append(update.Updates, roomKeyAgreementUpdate{
+			Line: rowIndex, Room: room, Guest: guest, RAID: RAID, Change: change,
+		})
+	}
+
+	if err = updater.Commit(); err != nil {
+		return update, possible, err
+	}
+	update.RecordChanges = updater.Changes
+	return update, possible, nil
+}
+
+// getUpdateReport returns agreements changed by report of departures,
+// cancellations or guest history
+func getUpdateReport(update *roomKeyUpdate) string {
+	var tbl gotable.Table
+	tbl.Init()
+	tbl.SetTitle("RENTAL AGREEMENT UPDATES (" + update.ReportType.Name + ")")
+
+	tbl.AddColumn("Input Line", 6, gotable.CELLSTRING, gotable.COLJUSTIFYLEFT)
+	tbl.AddColumn("Room", 10, gotable.CELLSTRING, gotable.COLJUSTIFYLEFT)
+	tbl.AddColumn("Guest", 30, gotable.CELLSTRING, gotable.COLJUSTIFYLEFT)
+	tbl.AddColumn("RAID", 10, gotable.CELLINT, gotable.COLJUSTIFYLEFT)
+	tbl.AddColumn("Change", 30, gotable.CELLSTRING, gotable.COLJUSTIFYLEFT)
+
+	for _, u := range update.Updates {
+		tbl.AddRow()
+		tbl.Puts(-1, 0, strconv.Itoa(u.Line))
+		tbl.Puts(-1, 1, u.Room)
+		tbl.Puts(-1, 2, u.Guest)
+		tbl.Puti(-1, 3, u.RAID)
+		tbl.Puts(-1, 4, u.Change)
+	}
+
+	s, err := tbl.SprintTable()
+	if err != nil {
+		rlib.Ulog("getUpdateReport: error = %s", err.Error())
+	}
+	return s
+}
@@ -5,22 +5,8 @@ import (
 	"rentroll/rlib"
 	"strconv"
 	"strings"
-	"time"
 )
 
-// getFormattedDate returns rentroll accepted date string
-func getFormattedDate(
-	dateString string,
-) string {
-
-	const shortForm = "02-Jan-2006"
-	const layout = "2006-01-02"
-
-	parsedDate, _ := time.Parse(shortForm, dateString)
-	return parsedDate.Format(layout)
-
-}
-
 // csvRecordsToSkip function that should check an error
 // which contains such a thing that needs to be discard
 // such as. already exists, already done. etc. . . .
@@ -123,3 +109,8 @@ func parseLineAndErrorFromRCSV(rcsvErr error, dbType int) (int, int, string, boo
 	//return
 	return lineNo, itemNo, errText, true
 }
+
+// GetBusinessName returns the name of property from the title of roomkey report
+func GetBusinessName(csvPath string) string {
+	return core.GetReportTitle(rlib.LoadCSV(csvPath))
+}
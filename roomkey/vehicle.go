@@ -0,0 +1,99 @@
+package roomkey
+
+import (
+	"context"
+	"importers/core"
+	"rentroll/rlib"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// insertPersonVehicles inserts vehicles of guests found in guest export,
+// linked to the transactant of the row. It should be called once TCID
+// of each row is known. Returns possible and imported vehicle count.
+func insertPersonVehicles(
+	ctx context.Context,
+	business *rlib.Business,
+	traceGuestData map[int][]string,
+	guestHeaderMap map[string]core.CSVHeader,
+	traceRowDates map[int]roomKeyRowDates,
+	rowIndexes []int,
+	traceTCIDMap map[int]string,
+	currentTime time.Time,
+	csvErrors map[int][]string,
+	importRecord *core.ImportRecord,
+) (int, int) {
+
+	possible, imported := 0, 0
+	errPrefix := "E:<" + core.DBTypeMapStrings[core.DBVehicle] + ">:"
+
+	// same guest can have many reservations, insert vehicle only once
+	avoidDuplicate := []string{}
+
+	for _, rowIndex := range rowIndexes {
+		guestData := traceGuestData[rowIndex]
+		if len(guestData) == 0 {
+			continue
+		}
+
+		vehicleMake := getGuestCell(guestData, guestHeaderMap, "VehicleMake")
+		model := getGuestCell(guestData, guestHeaderMap, "VehicleModel")
+		color := getGuestCell(guestData, guestHeaderMap, "VehicleColor")
+		plate := getGuestCell(guestData, guestHeaderMap, "LicensePlateNumber")
+		if vehicleMake == "" && model == "" && plate == "" {
+			continue
+		}
+
+		key := traceTCIDMap[rowIndex] + "|" + strings.ToLower(vehicleMake+"|"+model+"|"+plate)
+		if core.StringInSlice(key, avoidDuplicate) {
+			continue
+		}
+		avoidDuplicate = append(avoidDuplicate, key)
+		possible++
+
+		// person must be there to hold the vehicle
+		tcid, err := strconv.ParseInt(strings.TrimPrefix(traceTCIDMap[rowIndex], "TC"), 10, 64)
+		if err != nil || tcid == 0 {
+			csvErrors[rowIndex] = append(csvErrors[rowIndex], errPrefix+"Unable to insert vehicle, guest has not been imported")
+			continue
+		}
+
+		// take state of guest if plate state is not given
+		plateState := getGuestCell(guestData, guestHeaderMap, "LicensePlateState")
+		if plateState == "" {
+			plateState = getGuestCell(guestData, guestHeaderMap, "StateProvince")
+		}
+
+		var v rlib.Vehicle
+		v.BID = business.BID
+		v.TCID = tcid
+		v.VehicleMake = vehicleMake
+		v.VehicleModel = model
+		v.VehicleColor = color
+		v.VehicleYear, _ = strconv.ParseInt(getGuestCell(guestData, guestHeaderMap, "VehicleYear"), 10, 64)
+		v.LicensePlateNumber = plate
+		v.LicensePlateState = plateState
+
+		// vehicle is allowed for the stay of guest
+		rowDates := traceRowDates[rowIndex]
+		v.DtStart, v.DtStop = rowDates.DateIn, rowDates.DateOut
+		if !rowDates.Valid || v.DtStart.IsZero() {
+			v.DtStart = currentTime
+		}
+		if !rowDates.Valid || v.DtStop.IsZero() {
+			v.DtStop = time.Date(9999, time.December, 31, 0, 0, 0, 0, time.UTC)
+		}
+
+		vid, err := rlib.InsertVehicle(ctx, &v)
+		if err != nil {
+			rlib.Ulog("ERROR <VEHICLE INSERTION>: %s", err.Error())
+			csvErrors[rowIndex] = append(csvErrors[rowIndex], errPrefix+"Unable to insert vehicle with license plate \""+plate+"\"")
+			continue
+		}
+		importRecord.AddCreated(core.DBVehicle, vid)
+		imported++
+	}
+
+	return possible, imported
+}